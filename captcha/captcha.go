@@ -0,0 +1,100 @@
+// Package captcha keeps bots from filling providers' days with fake bookings.
+// CheckForm applies cheap heuristics to every public booking, a honeypot field
+// and a minimum time to fill in the form, then asks the configured CAPTCHA
+// provider to verify the token the booking page obtained.
+package captcha
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"example.com/config"
+	"example.com/logging"
+	"example.com/models"
+)
+
+// Verifier checks a token a CAPTCHA widget issued to the booking page
+type Verifier interface {
+	Name() string
+	// SiteKey is the public key the booking page renders the widget with
+	SiteKey() string
+	// Verify returns ErrRejected when the provider refuses the token, and
+	// other errors when it couldn't be asked
+	Verify(ctx context.Context, token, remoteIP string) error
+}
+
+var ErrRejected = errors.New("captcha token rejected")
+
+var (
+	ErrCaptchaFailed = models.Forbidden("captcha_failed", "the CAPTCHA challenge was not passed, please try again")
+	ErrBotSuspected  = models.Forbidden("bot_suspected", "the booking form was not filled in as expected, please try again")
+)
+
+// Default is the configured verifier, or nil when CAPTCHA is disabled
+var Default Verifier
+
+// minFillTime is the least time a person takes to fill in the booking form
+var minFillTime time.Duration
+
+func Init(cfg config.CaptchaConfig) {
+	minFillTime = cfg.MinFillTime
+	switch cfg.Provider {
+	case "hcaptcha":
+		Default = NewHCaptcha(cfg.SiteKey, cfg.Secret)
+	case "turnstile":
+		Default = NewTurnstile(cfg.SiteKey, cfg.Secret)
+	case "recaptcha":
+		Default = NewReCAPTCHA(cfg.SiteKey, cfg.Secret, cfg.MinScore)
+	case "fake":
+		Default = NewFake()
+	case "":
+		Default = nil
+	default:
+		logging.Logger.Warnf("Unknown CAPTCHA_PROVIDER %q, CAPTCHA disabled", cfg.Provider)
+		Default = nil
+	}
+}
+
+// Form is what the booking page sends along with a booking to show a person
+// filled it in
+type Form struct {
+	CaptchaToken string `json:"captchaToken,omitempty"`
+	// Website is a honeypot: the booking page hides the field, so only bots
+	// fill it in
+	Website string `json:"website,omitempty"`
+	// FormStartedAt is when the booking page showed the form, in Unix
+	// milliseconds. Booking pages that don't send it skip the fill time
+	// check.
+	FormStartedAt int64 `json:"formStartedAt,omitempty"`
+}
+
+// CheckForm returns ErrBotSuspected when the form looks automated and, if
+// requireCaptcha is set and a verifier is configured, ErrCaptchaFailed when
+// the CAPTCHA token doesn't verify. Bookings go through when the provider
+// can't be reached, so an outage doesn't stop all bookings.
+func CheckForm(ctx context.Context, form Form, remoteIP string, requireCaptcha bool) error {
+	if form.Website != "" {
+		return ErrBotSuspected
+	}
+	if minFillTime > 0 && form.FormStartedAt > 0 {
+		if time.Since(time.UnixMilli(form.FormStartedAt)) < minFillTime {
+			return ErrBotSuspected
+		}
+	}
+
+	if !requireCaptcha || Default == nil {
+		return nil
+	}
+	if form.CaptchaToken == "" {
+		return ErrCaptchaFailed
+	}
+	err := Default.Verify(ctx, form.CaptchaToken, remoteIP)
+	if errors.Is(err, ErrRejected) {
+		return ErrCaptchaFailed
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("provider", Default.Name()).Warn("CAPTCHA verification unavailable, allowing booking")
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSiteVerify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("secret") != "s3cret" || r.Form.Get("remoteip") != "203.0.113.7" {
+			t.Errorf("form = %v", r.Form)
+		}
+		switch r.Form.Get("response") {
+		case "good":
+			w.Write([]byte(`{"success": true, "score": 0.9}`))
+		case "low":
+			w.Write([]byte(`{"success": true, "score": 0.1}`))
+		case "down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+		}
+	}))
+	defer server.Close()
+
+	v := NewReCAPTCHA("site", "s3cret", 0.5)
+	v.verifyURL = server.URL
+	v.client = server.Client()
+
+	tests := []struct {
+		token    string
+		rejected bool
+		failed   bool
+	}{
+		{token: "good"},
+		{token: "low", rejected: true, failed: true},
+		{token: "forged", rejected: true, failed: true},
+		{token: "down", failed: true},
+	}
+	for _, tt := range tests {
+		err := v.Verify(context.Background(), tt.token, "203.0.113.7")
+		if (err != nil) != tt.failed || errors.Is(err, ErrRejected) != tt.rejected {
+			t.Errorf("Verify(%q) = %v, want rejected %v, failed %v", tt.token, err, tt.rejected, tt.failed)
+		}
+	}
+}
+
+func TestCheckForm(t *testing.T) {
+	savedDefault, savedFill := Default, minFillTime
+	t.Cleanup(func() { Default, minFillTime = savedDefault, savedFill })
+	Default, minFillTime = NewFake(), 3*time.Second
+
+	started := time.Now().Add(-time.Minute).UnixMilli()
+	tests := []struct {
+		name     string
+		form     Form
+		required bool
+		want     error
+	}{
+		{"person", Form{CaptchaToken: FakePassToken, FormStartedAt: started}, true, nil},
+		{"honeypot filled in", Form{CaptchaToken: FakePassToken, FormStartedAt: started, Website: "http://spam.example"}, true, ErrBotSuspected},
+		{"submitted instantly", Form{CaptchaToken: FakePassToken, FormStartedAt: time.Now().UnixMilli()}, true, ErrBotSuspected},
+		{"no start time", Form{CaptchaToken: FakePassToken}, true, nil},
+		{"bad token", Form{CaptchaToken: "forged", FormStartedAt: started}, true, ErrCaptchaFailed},
+		{"no token", Form{FormStartedAt: started}, true, ErrCaptchaFailed},
+		{"provider turned it off", Form{FormStartedAt: started}, false, nil},
+	}
+	for _, tt := range tests {
+		if err := CheckForm(context.Background(), tt.form, "203.0.113.7", tt.required); err != tt.want {
+			t.Errorf("%s: CheckForm() = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package captcha
+
+import "context"
+
+// FakePassToken is the only token the fake verifier accepts
+const FakePassToken = "fake-captcha-pass"
+
+// Fake is a verifier for local development and tests that accepts
+// FakePassToken and rejects anything else
+type Fake struct{}
+
+func NewFake() *Fake { return &Fake{} }
+
+func (f *Fake) Name() string    { return "fake" }
+func (f *Fake) SiteKey() string { return "fake-site-key" }
+
+func (f *Fake) Verify(ctx context.Context, token, remoteIP string) error {
+	if token != FakePassToken {
+		return ErrRejected
+	}
+	return nil
+}
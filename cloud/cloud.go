@@ -1,204 +1,252 @@
+// Package cloud turns files uploaded with services into media items kept in
+// the configured storage.
 package cloud
 
 import (
 	"bytes"
 	"context"
-	"crypto/sha1"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"mime"
 	"mime/multipart"
-	"net/http"
-	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"example.com/config"
+	"example.com/imaging"
+	"example.com/logging"
+	"example.com/metrics"
 	"example.com/models"
-	"github.com/cloudinary/cloudinary-go/v2"
-	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
-	"github.com/gin-gonic/gin"
+	"example.com/storage"
+	"example.com/tracing"
+	"example.com/video"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type CloudProvider struct {
-	name    string
-	secret  string
-	api_key string
-}
-
-func New() *CloudProvider {
-	return &CloudProvider{
-		os.Getenv("CLOUDINARY_NAME"),
-		os.Getenv("CLOUDINARY_API_SECRET"),
-		os.Getenv("CLOUDINARY_API_KEY"),
-	}
-}
-
-func (cloud *CloudProvider) GetCloudinarySignature(context *gin.Context) {
-	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
-
-	params := "timestamp=" + timestamp
-
-	h := sha1.New()
-	h.Write([]byte(params + cloud.secret))
-	signature := hex.EncodeToString(h.Sum(nil))
+// limits are what uploaded photos and clips are held to, set by Init
+var (
+	limits      = imaging.Limits{MaxBytes: 10 << 20, MaxSide: 8000}
+	videoLimits = video.Limits{MaxBytes: 50 << 20, MaxDuration: time.Minute}
+	ffmpeg      = "ffmpeg"
+)
 
-	context.JSON(http.StatusOK, gin.H{
-		"timestamp": timestamp,
-		"signature": signature,
-		"apiKey":    cloud.api_key,
-		"cloudName": cloud.name,
-	})
+func Init(cfg config.MediaConfig) {
+	limits = imaging.Limits{MaxBytes: cfg.MaxImageBytes, MaxSide: cfg.MaxImageSide}
+	videoLimits = video.Limits{MaxBytes: cfg.MaxVideoBytes, MaxDuration: cfg.MaxVideoDuration}
+	ffmpeg = cfg.FFmpegPath
 }
 
-// func UploadHandler(c *gin.Context) {
-// 	form, err := c.MultipartForm()
-// 	if err != nil {
-// 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid multipart form"})
-// 		return
-// 	}
-
-// 	files := form.File["files"]
-// 	if len(files) == 0 {
-// 		c.JSON(http.StatusBadRequest, gin.H{"error": "No files received"})
-// 		return
-// 	}
-
-// 	var urls []string
-
-// 	for _, file := range files {
-// 		openedFile, err := file.Open()
-// 		if err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open uploaded file"})
-// 			return
-// 		}
-// 		defer openedFile.Close()
-
-// 		ext, reader, err := getFileExtension(openedFile)
-// 		if err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to detect file type for: " + file.Filename})
-// 			return
-// 		}
-
-// 		_, err = uploadToCloudinary(reader, file.Filename, ext)
-// 		if err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Upload failed for: " + file.Filename, "details": err.Error()})
-// 			return
-// 		}
-
-// 	}
-
-// 	c.JSON(http.StatusOK, gin.H{"url": urls})
-// }
-
-func HandleFile(file *multipart.FileHeader) (models.MediaItem, error) {
+// HandleFile checks an uploaded photo or video clip and stores it in the
+// configured storage, photos as renditions and clips along with a poster
+// frame. Files that aren't acceptable are refused with a validation error
+// naming the file.
+func HandleFile(ctx context.Context, file *multipart.FileHeader) (models.MediaItem, error) {
+	// Which limit applies is known once the file is read; nothing is allowed
+	// more than the larger
+	if maxBytes := max(limits.MaxBytes, videoLimits.MaxBytes); file.Size > maxBytes {
+		return models.MediaItem{}, rejectedFile(file, fmt.Sprintf("files must be at most %d MB", maxBytes>>20))
+	}
 	openedFile, err := file.Open()
 	if err != nil {
 		return models.MediaItem{}, err
 	}
 	defer openedFile.Close()
 
-	ext, reader, err := getFileExtension(openedFile)
-	name := strings.TrimSuffix(file.Filename, ext)
-	mimeType := file.Header.Get("Content-Type")
-	if mimeType == "" {
-		mimeType = "image/jpeg"
+	ctx, span := tracing.Tracer.Start(ctx, "media.upload", trace.WithAttributes(
+		attribute.String("storage.driver", storage.Default.Name()),
+		attribute.String("file.name", file.Filename),
+		attribute.Int64("file.size", file.Size),
+	))
+	defer span.End()
+
+	head := make([]byte, 12)
+	if _, err := openedFile.ReadAt(head, 0); err != nil && !errors.Is(err, io.EOF) {
+		return models.MediaItem{}, uploadFailed(ctx, span, file, err)
 	}
-	if err != nil {
-		return models.MediaItem{}, err
+	if _, ok := video.Detect(head); ok {
+		span.SetAttributes(attribute.String("media.kind", string(models.MediaVideo)))
+		return handleVideo(ctx, span, file, openedFile)
 	}
+	span.SetAttributes(attribute.String("media.kind", string(models.MediaImage)))
+	return handleImage(ctx, span, file, openedFile)
+}
 
-	mediaItem, err := uploadToCloudinary(reader, file.Filename, name, mimeType)
+func handleImage(ctx context.Context, span trace.Span, file *multipart.FileHeader, f multipart.File) (models.MediaItem, error) {
+	variants, err := imaging.Process(f, limits)
+	var rejected *imaging.RejectedError
+	if errors.As(err, &rejected) {
+		span.SetStatus(codes.Error, "file rejected")
+		return models.MediaItem{}, rejectedFile(file, rejected.Reason)
+	}
 	if err != nil {
-		return models.MediaItem{}, err
+		return models.MediaItem{}, uploadFailed(ctx, span, file, err)
 	}
 
-	return mediaItem, nil
+	item := newItem(file, models.MediaImage)
+	if err := putVariants(ctx, &item, item.PublicID, variants); err != nil {
+		discard(ctx, item)
+		return models.MediaItem{}, uploadFailed(ctx, span, file, err)
+	}
+	full := item.Variants[fullSize]
+	item.URI = full.URI
+	item.MimeType = contentType(variants, fullSize)
+	item.Width = full.Width
+	item.Height = full.Height
+	return item, nil
 }
 
-func DeleteMedia(c *gin.Context, publicID string) {
-	cld, err := cloudinary.NewFromParams(
-		os.Getenv("CLOUDINARY_NAME"),
-		os.Getenv("CLOUDINARY_API_KEY"),
-		os.Getenv("CLOUDINARY_API_SECRET"),
-	)
+func handleVideo(ctx context.Context, span trace.Span, file *multipart.FileHeader, f multipart.File) (models.MediaItem, error) {
+	info, err := video.Probe(f, file.Size, videoLimits)
+	var rejected *video.RejectedError
+	if errors.As(err, &rejected) {
+		span.SetStatus(codes.Error, "file rejected")
+		return models.MediaItem{}, rejectedFile(file, rejected.Reason)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to initialize Cloudinary: " + err.Error()})
-		return
+		return models.MediaItem{}, uploadFailed(ctx, span, file, err)
 	}
 
-	resp, err := cld.Upload.Destroy(c, uploader.DestroyParams{
-		PublicID:     publicID,
-		ResourceType: "image",
+	item := newItem(file, models.MediaVideo)
+	obj, err := storage.Default.Put(ctx, item.PublicID, io.NewSectionReader(f, 0, file.Size), storage.PutOptions{
+		ContentType: info.ContentType,
+		Size:        file.Size,
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to delete media: " + err.Error()})
-		return
+		return models.MediaItem{}, uploadFailed(ctx, span, file, err)
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Media deleted successfully",
-		"result":  resp.Result,
-	})
+	item.URI = obj.URL
+	item.MimeType = info.ContentType
+	item.Width = info.Width
+	item.Height = info.Height
+	item.Duration = info.Duration.Seconds()
+
+	// A clip without a poster still plays, so failing to make one only
+	// costs the gallery its preview
+	poster, err := posterVariants(ctx, f, file.Size, info.Duration)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("file", file.Filename).Warn("no poster frame for video")
+		return item, nil
+	}
+	if err := putVariants(ctx, &item, posterKey(item.PublicID), poster); err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("file", file.Filename).Warn("failed to store poster frame for video")
+		discardPoster(ctx, &item)
+	}
+	return item, nil
 }
 
-func uploadToCloudinary(file io.Reader, filename, name, mimeType string) (models.MediaItem, error) {
-	// Don't load .env here - it's already loaded in main.go
-	// This function is called for each file upload and doesn't need to reload env
-	cld, err := cloudinary.NewFromParams(
-		os.Getenv("CLOUDINARY_NAME"),
-		os.Getenv("CLOUDINARY_API_KEY"),
-		os.Getenv("CLOUDINARY_API_SECRET"),
-	)
+// posterVariants extracts a frame from early in the clip and renders it at
+// each size
+func posterVariants(ctx context.Context, f io.ReaderAt, size int64, duration time.Duration) ([]imaging.Variant, error) {
+	frame, err := video.Poster(ctx, ffmpeg, io.NewSectionReader(f, 0, size), min(time.Second, duration/2))
 	if err != nil {
-		return models.MediaItem{}, fmt.Errorf("cloudinary init failed: %w", err)
+		return nil, err
 	}
+	return imaging.Process(bytes.NewReader(frame), limits)
+}
 
-	publicID := uuid.New().String()
+func newItem(file *multipart.FileHeader, kind models.MediaKind) models.MediaItem {
+	return models.MediaItem{
+		PublicID: uuid.New().String(),
+		FileName: strings.TrimSuffix(file.Filename, filepath.Ext(file.Filename)),
+		Kind:     kind,
+		Variants: map[string]models.MediaVariant{},
+	}
+}
 
-	// Check if the file is HEIC/HEIF and needs conversion
-	uploadParams := uploader.UploadParams{
-		PublicID: publicID,
+// putVariants stores renditions under keys derived from base and records
+// them on item
+func putVariants(ctx context.Context, item *models.MediaItem, base string, variants []imaging.Variant) error {
+	for _, v := range variants {
+		obj, err := storage.Default.Put(ctx, variantKey(base, v.Name), bytes.NewReader(v.Data), storage.PutOptions{
+			ContentType: v.ContentType,
+			Size:        int64(len(v.Data)),
+		})
+		if err != nil {
+			return err
+		}
+		item.Variants[v.Name] = models.MediaVariant{URI: obj.URL, Width: v.Width, Height: v.Height}
 	}
+	return nil
+}
 
-	// Convert HEIC/HEIF to JPG
-	if strings.Contains(strings.ToLower(mimeType), "heic") ||
-		strings.Contains(strings.ToLower(mimeType), "heif") ||
-		strings.HasSuffix(strings.ToLower(filename), ".heic") ||
-		strings.HasSuffix(strings.ToLower(filename), ".heif") {
-		uploadParams.Format = "jpg"
-		mimeType = "image/jpeg"
+func contentType(variants []imaging.Variant, name string) string {
+	for _, v := range variants {
+		if v.Name == name {
+			return v.ContentType
+		}
 	}
+	return ""
+}
 
-	uploadResp, err := cld.Upload.Upload(context.Background(), file, uploadParams)
-	if err != nil {
-		return models.MediaItem{}, err
+// discard removes what was stored of a failed upload
+func discard(ctx context.Context, item models.MediaItem) {
+	if err := DeleteMedia(context.WithoutCancel(ctx), item); err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("publicId", item.PublicID).Warn("failed to clean up partial upload")
 	}
+}
 
-	return models.MediaItem{
-		PublicID: publicID,
-		URI:      uploadResp.SecureURL,
-		MimeType: mimeType,
-		FileName: name,
-	}, nil
+// discardPoster removes what was stored of a clip's poster, leaving the clip
+func discardPoster(ctx context.Context, item *models.MediaItem) {
+	for name := range item.Variants {
+		key := variantKey(posterKey(item.PublicID), name)
+		if err := storage.Default.Delete(context.WithoutCancel(ctx), key, storage.DeleteOptions{}); err != nil {
+			logging.FromContext(ctx).WithError(err).WithField("key", key).Warn("failed to clean up partial poster")
+		}
+	}
+	clear(item.Variants)
 }
 
-func getFileExtension(file io.Reader) (string, io.Reader, error) {
-	head := make([]byte, 512)
-	n, err := file.Read(head)
-	if err != nil && err != io.EOF {
-		return "", nil, err
+// DeleteMedia removes an uploaded photo and its renditions, or a clip and
+// its poster, from the configured storage
+func DeleteMedia(ctx context.Context, item models.MediaItem) error {
+	var errs []error
+	del := func(key, contentType string) {
+		if err := storage.Default.Delete(ctx, key, storage.DeleteOptions{ContentType: contentType}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	renditions, renditionType := item.PublicID, item.MimeType
+	if item.IsVideo() {
+		del(item.PublicID, item.MimeType)
+		// Posters are PNG or JPEG depending on the frame
+		renditions, renditionType = posterKey(item.PublicID), ""
 	}
+	for _, size := range imaging.Sizes {
+		del(variantKey(renditions, size.Name), renditionType)
+	}
+	return errors.Join(errs...)
+}
+
+// fullSize is the rendition stored under the media's public ID, which is all
+// media uploaded before renditions existed has
+const fullSize = "full"
 
-	mimeType := http.DetectContentType(head[:n])
-	exts, _ := mime.ExtensionsByType(mimeType)
-	ext := ".bin"
-	if len(exts) > 0 {
-		ext = exts[0]
+// variantKey is where the rendition of the given size is kept; base is the
+// public ID of a photo, or the poster key of a clip
+func variantKey(base, size string) string {
+	if size == fullSize {
+		return base
 	}
+	return base + "_" + size
+}
+
+func posterKey(publicID string) string {
+	return publicID + "_poster"
+}
+
+func rejectedFile(file *multipart.FileHeader, reason string) error {
+	return &models.ValidationError{Field: "media", Message: file.Filename + ": " + reason}
+}
 
-	fullReader := io.MultiReader(bytes.NewReader(head[:n]), file)
-	return ext, fullReader, nil
+func uploadFailed(ctx context.Context, span trace.Span, file *multipart.FileHeader, err error) error {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, "upload failed")
+	metrics.MediaUploadFailures.Inc()
+	logging.FromContext(ctx).WithError(err).WithField("file", file.Filename).Error("media upload failed")
+	return err
 }
@@ -0,0 +1,755 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/nyaruka/phonenumbers"
+)
+
+// Environments the server can run in. Production refuses the development
+// defaults below.
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+const (
+	defaultFrontendURL = "http://localhost:5173"
+	defaultBackendURL  = "http://localhost:8080"
+	defaultJWTSecret   = "dummy_key"
+)
+
+var defaultCORSOrigins = []string{"http://localhost:5173", "http://localhost:8081", "http://localhost:8082", "https://glowbook-booking.vercel.app"}
+
+// Config is the server configuration, loaded once at startup by Load
+type Config struct {
+	Env  string // APP_ENV, development by default and production on Fly.io
+	Port int    // PORT
+
+	// ShutdownTimeout bounds how long shutdown waits for requests in flight
+	// and background workers (SHUTDOWN_TIMEOUT, default 10s)
+	ShutdownTimeout time.Duration
+
+	FrontendURL string   // FRONTEND_URL
+	BackendURL  string   // BACKEND_URL
+	CORSOrigins []string // CORS_ORIGINS, comma separated
+
+	Proxy ProxyConfig
+
+	JWTSecret string // JWT_SECRET
+
+	Database  DatabaseConfig
+	OAuth     OAuthConfig
+	Storage   StorageConfig
+	Media     MediaConfig
+	Payments  PaymentsConfig
+	Notifier  NotifierConfig
+	Captcha   CaptchaConfig
+	Tracing   TracingConfig
+	Metrics   MetricsConfig
+	Log       LogConfig
+	RateLimit RateLimitConfig
+	Locale    LocaleConfig
+}
+
+// ProxyConfig says where the client address of a request comes from. With
+// neither set, forwarding headers are ignored and the peer address is used.
+type ProxyConfig struct {
+	// TrustedPlatform is the header the hosting platform puts the client
+	// address in (TRUSTED_PLATFORM), Fly-Client-IP by default on Fly.io
+	TrustedPlatform string
+	// TrustedProxies are the addresses or CIDR ranges whose X-Forwarded-For
+	// is believed (TRUSTED_PROXIES, comma separated)
+	TrustedProxies []string
+}
+
+type DatabaseConfig struct {
+	URL string // DATABASE_URL, or built from PG_USERNAME and PG_PASSWORD
+}
+
+type OAuthConfig struct {
+	StateSecret          string // OAUTH_STATE_SECRET
+	GoogleClientID       string // GOOGLE_CLIENT_ID
+	GoogleClientSecret   string // GOOGLE_CLIENT_SECRET
+	FacebookClientID     string // FACEBOOK_CLIENT_ID
+	FacebookClientSecret string // FACEBOOK_CLIENT_SECRET
+}
+
+type StorageConfig struct {
+	// Driver is where uploaded media is kept (STORAGE_DRIVER: "cloudinary",
+	// "s3" or "local"). Development defaults to local unless Cloudinary is
+	// configured; production to cloudinary.
+	Driver     string
+	Cloudinary CloudinaryConfig
+	S3         S3Config
+	Local      LocalStorageConfig
+}
+
+type MediaConfig struct {
+	MaxImageBytes    int64         // MEDIA_MAX_IMAGE_MB a photo may have, default 10
+	MaxImageSide     int           // MEDIA_MAX_IMAGE_SIDE, the longest width or height of a photo in pixels, default 8000
+	MaxVideoBytes    int64         // MEDIA_MAX_VIDEO_MB a clip may have, default 50
+	MaxVideoDuration time.Duration // MEDIA_MAX_VIDEO_DURATION, default 60s
+	// FFmpegPath is the ffmpeg binary poster frames are extracted with
+	// (MEDIA_FFMPEG, default "ffmpeg" in PATH). Clips get no poster without it.
+	FFmpegPath string
+}
+
+type S3Config struct {
+	Endpoint        string // S3_ENDPOINT, default https://s3.amazonaws.com
+	Region          string // S3_REGION, default us-east-1
+	Bucket          string // S3_BUCKET
+	AccessKeyID     string // S3_ACCESS_KEY_ID
+	SecretAccessKey string // S3_SECRET_ACCESS_KEY
+	PublicURL       string // S3_PUBLIC_URL objects are served from, default the bucket's URL on the endpoint
+}
+
+type LocalStorageConfig struct {
+	Dir string // STORAGE_LOCAL_DIR, default uploads
+	URL string // STORAGE_LOCAL_URL files are served from, default BACKEND_URL/media
+}
+
+type CloudinaryConfig struct {
+	Name      string // CLOUDINARY_NAME
+	APIKey    string // CLOUDINARY_API_KEY
+	APISecret string // CLOUDINARY_API_SECRET
+}
+
+type PaymentsConfig struct {
+	Gateway             string // PAYMENT_GATEWAY: "stripe", "fake" or empty to disable
+	StripeSecretKey     string // STRIPE_SECRET_KEY
+	StripeWebhookSecret string // STRIPE_WEBHOOK_SECRET
+	FakeWebhookSecret   string // FAKE_PAYMENTS_WEBHOOK_SECRET
+}
+
+type CaptchaConfig struct {
+	Provider string  // CAPTCHA_PROVIDER: "hcaptcha", "turnstile", "recaptcha", "fake" or empty to disable
+	SiteKey  string  // CAPTCHA_SITE_KEY, shown to the booking page
+	Secret   string  // CAPTCHA_SECRET
+	MinScore float64 // RECAPTCHA_MIN_SCORE a reCAPTCHA v3 token must reach, default 0.5
+
+	// MinFillTime is how long a person takes at least to fill in the booking
+	// form; faster submissions are treated as bots. Only booking pages that
+	// send formStartedAt are checked. (BOOKING_MIN_FILL_TIME, default 3s, 0
+	// to turn off)
+	MinFillTime time.Duration
+}
+
+type NotifierConfig struct {
+	Kind         string // NOTIFIER: "smtp", or "log" (the default)
+	SMTPHost     string // SMTP_HOST
+	SMTPPort     string // SMTP_PORT
+	SMTPUsername string // SMTP_USERNAME
+	SMTPPassword string // SMTP_PASSWORD
+	SMTPFrom     string // SMTP_FROM
+}
+
+type TracingConfig struct {
+	Exporter    string  // TRACING_EXPORTER: "otlp", or "none" (the default)
+	Endpoint    string  // OTEL_EXPORTER_OTLP_ENDPOINT, default http://localhost:4318
+	ServiceName string  // OTEL_SERVICE_NAME, default booking-server
+	SampleRatio float64 // TRACING_SAMPLE_RATIO of new traces to record, default 1
+}
+
+// LocaleConfig says how to read the dates, times and phone numbers clients
+// give without saying where they are
+type LocaleConfig struct {
+	// TimeZone is the IANA zone schedules and bookings are in (TIME_ZONE,
+	// default UTC)
+	TimeZone string
+	// PhoneRegion is the ISO 3166 country phone numbers without a country
+	// code are dialled in (PHONE_REGION, e.g. GB). Unset, clients must give
+	// the country code.
+	PhoneRegion string
+}
+
+// MetricsConfig keeps /metrics from the public. In production at least one
+// of its fields is required.
+type MetricsConfig struct {
+	// Addr serves /metrics on its own listener, such as :9091, rather than
+	// on PORT (METRICS_ADDR)
+	Addr string
+	// Token is the bearer token /metrics requires (METRICS_TOKEN)
+	Token string
+}
+
+type LogConfig struct {
+	Level  string // LOG_LEVEL: debug, info, warn or error; debug in development and info in production by default
+	Format string // LOG_FORMAT: json (the default) or text
+}
+
+type RateLimitConfig struct {
+	Backend string // RATE_LIMIT_BACKEND: memory (the default), postgres, or none
+
+	// Policies by name, each set by RATE_LIMIT_<NAME> as requests/period,
+	// such as RATE_LIMIT_AUTH=10/1m, or "off"
+	Policies map[string]RatePolicy
+}
+
+// RatePolicy allows Limit requests per Period. A zero Limit turns it off.
+type RatePolicy struct {
+	Limit  int
+	Period time.Duration
+}
+
+// defaultRateLimits are the policies the routes use: auth per IP on the
+// login and signup endpoints, booking per IP and provider per alias on the
+// public booking endpoints, public per IP on public reads and api per user
+// on authenticated endpoints. Every client of a provider shares its bucket,
+// so provider is only a ceiling against floods from many addresses: set low,
+// one client could lock everyone else out of booking.
+var defaultRateLimits = map[string]RatePolicy{
+	"auth":     {Limit: 10, Period: time.Minute},
+	"booking":  {Limit: 10, Period: time.Minute},
+	"provider": {Limit: 600, Period: time.Minute},
+	"public":   {Limit: 120, Period: time.Minute},
+	"api":      {Limit: 300, Period: time.Minute},
+}
+
+// Production reports whether the server runs in production mode
+func (c *Config) Production() bool {
+	return c.Env == EnvProduction
+}
+
+// Addr is the address the server listens on
+func (c *Config) Addr() string {
+	return ":" + strconv.Itoa(c.Port)
+}
+
+// Load reads the configuration from the environment, falling back to the
+// dotenv file named by CONFIG_FILE and then to .env, and validates it.
+// Variables set in the environment always win over files.
+func Load() (*Config, error) {
+	values := map[string]string{}
+	if dotenv, err := godotenv.Read(); err == nil {
+		values = dotenv
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read .env: %w", err)
+	}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		file, err := godotenv.Read(path)
+		if err != nil {
+			return nil, fmt.Errorf("read CONFIG_FILE: %w", err)
+		}
+		for k, v := range file {
+			values[k] = v
+		}
+	}
+	lookup := func(key string) string {
+		if v, ok := os.LookupEnv(key); ok {
+			return v
+		}
+		return values[key]
+	}
+
+	cfg := parse(lookup)
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg.applyDevelopmentDefaults()
+	// Media kept on local disk is served by this server
+	if cfg.Storage.Local.URL == "" {
+		cfg.Storage.Local.URL = cfg.BackendURL + "/media"
+	}
+	return cfg, nil
+}
+
+// parse builds the configuration from lookup. Unset values are left empty,
+// and numbers that don't parse out of range, for Validate to judge.
+func parse(lookup func(string) string) *Config {
+	cfg := &Config{
+		Env:         strings.ToLower(strings.TrimSpace(lookup("APP_ENV"))),
+		FrontendURL: strings.TrimSuffix(lookup("FRONTEND_URL"), "/"),
+		BackendURL:  strings.TrimSuffix(lookup("BACKEND_URL"), "/"),
+		JWTSecret:   lookup("JWT_SECRET"),
+		Database: DatabaseConfig{
+			URL: lookup("DATABASE_URL"),
+		},
+		OAuth: OAuthConfig{
+			StateSecret:          lookup("OAUTH_STATE_SECRET"),
+			GoogleClientID:       lookup("GOOGLE_CLIENT_ID"),
+			GoogleClientSecret:   lookup("GOOGLE_CLIENT_SECRET"),
+			FacebookClientID:     lookup("FACEBOOK_CLIENT_ID"),
+			FacebookClientSecret: lookup("FACEBOOK_CLIENT_SECRET"),
+		},
+		Storage: StorageConfig{
+			Driver: strings.ToLower(lookup("STORAGE_DRIVER")),
+			Cloudinary: CloudinaryConfig{
+				Name:      lookup("CLOUDINARY_NAME"),
+				APIKey:    lookup("CLOUDINARY_API_KEY"),
+				APISecret: lookup("CLOUDINARY_API_SECRET"),
+			},
+			S3: S3Config{
+				Endpoint:        strings.TrimSuffix(lookup("S3_ENDPOINT"), "/"),
+				Region:          lookup("S3_REGION"),
+				Bucket:          lookup("S3_BUCKET"),
+				AccessKeyID:     lookup("S3_ACCESS_KEY_ID"),
+				SecretAccessKey: lookup("S3_SECRET_ACCESS_KEY"),
+				PublicURL:       strings.TrimSuffix(lookup("S3_PUBLIC_URL"), "/"),
+			},
+			Local: LocalStorageConfig{
+				Dir: lookup("STORAGE_LOCAL_DIR"),
+				URL: strings.TrimSuffix(lookup("STORAGE_LOCAL_URL"), "/"),
+			},
+		},
+		Payments: PaymentsConfig{
+			Gateway:             lookup("PAYMENT_GATEWAY"),
+			StripeSecretKey:     lookup("STRIPE_SECRET_KEY"),
+			StripeWebhookSecret: lookup("STRIPE_WEBHOOK_SECRET"),
+			FakeWebhookSecret:   lookup("FAKE_PAYMENTS_WEBHOOK_SECRET"),
+		},
+		Captcha: CaptchaConfig{
+			Provider: strings.ToLower(lookup("CAPTCHA_PROVIDER")),
+			SiteKey:  lookup("CAPTCHA_SITE_KEY"),
+			Secret:   lookup("CAPTCHA_SECRET"),
+			MinScore: 0.5,
+		},
+		Notifier: NotifierConfig{
+			Kind:         lookup("NOTIFIER"),
+			SMTPHost:     lookup("SMTP_HOST"),
+			SMTPPort:     lookup("SMTP_PORT"),
+			SMTPUsername: lookup("SMTP_USERNAME"),
+			SMTPPassword: lookup("SMTP_PASSWORD"),
+			SMTPFrom:     lookup("SMTP_FROM"),
+		},
+		Log: LogConfig{
+			Level:  strings.ToLower(lookup("LOG_LEVEL")),
+			Format: strings.ToLower(lookup("LOG_FORMAT")),
+		},
+		Metrics: MetricsConfig{
+			Addr:  strings.TrimSpace(lookup("METRICS_ADDR")),
+			Token: lookup("METRICS_TOKEN"),
+		},
+		Locale: LocaleConfig{
+			TimeZone:    lookup("TIME_ZONE"),
+			PhoneRegion: strings.ToUpper(strings.TrimSpace(lookup("PHONE_REGION"))),
+		},
+		Tracing: TracingConfig{
+			Exporter:    lookup("TRACING_EXPORTER"),
+			Endpoint:    lookup("OTEL_EXPORTER_OTLP_ENDPOINT"),
+			ServiceName: lookup("OTEL_SERVICE_NAME"),
+			SampleRatio: 1,
+		},
+	}
+	// Deployments on Fly.io run in production unless told otherwise, so a
+	// forgotten APP_ENV can't fall back to the development defaults
+	if cfg.Env == "" {
+		cfg.Env = EnvDevelopment
+		if lookup("FLY_APP_NAME") != "" {
+			cfg.Env = EnvProduction
+		}
+	}
+	if cfg.Log.Level == "" {
+		cfg.Log.Level = "debug"
+		if cfg.Env == EnvProduction {
+			cfg.Log.Level = "info"
+		}
+	}
+	if cfg.Locale.TimeZone == "" {
+		cfg.Locale.TimeZone = "UTC"
+	}
+	if cfg.Log.Format == "" {
+		cfg.Log.Format = "json"
+	}
+	if cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = "booking-server"
+	}
+	if ratio := lookup("TRACING_SAMPLE_RATIO"); ratio != "" {
+		var err error
+		if cfg.Tracing.SampleRatio, err = strconv.ParseFloat(ratio, 64); err != nil {
+			cfg.Tracing.SampleRatio = -1
+		}
+	}
+	if cfg.Storage.Driver == "" {
+		cfg.Storage.Driver = "local"
+		if cfg.Env == EnvProduction || cfg.Storage.Cloudinary.Name != "" {
+			cfg.Storage.Driver = "cloudinary"
+		}
+	}
+	if cfg.Storage.S3.Endpoint == "" {
+		cfg.Storage.S3.Endpoint = "https://s3.amazonaws.com"
+	}
+	if cfg.Storage.S3.Region == "" {
+		cfg.Storage.S3.Region = "us-east-1"
+	}
+	if cfg.Storage.S3.PublicURL == "" && cfg.Storage.S3.Bucket != "" {
+		cfg.Storage.S3.PublicURL = cfg.Storage.S3.Endpoint + "/" + cfg.Storage.S3.Bucket
+	}
+	if cfg.Storage.Local.Dir == "" {
+		cfg.Storage.Local.Dir = "uploads"
+	}
+
+	cfg.Media.MaxImageBytes = 10 << 20
+	if mb := lookup("MEDIA_MAX_IMAGE_MB"); mb != "" {
+		n, err := strconv.Atoi(mb)
+		if err != nil {
+			n = -1
+		}
+		cfg.Media.MaxImageBytes = int64(n) << 20
+	}
+	cfg.Media.MaxImageSide = 8000
+	if side := lookup("MEDIA_MAX_IMAGE_SIDE"); side != "" {
+		cfg.Media.MaxImageSide, _ = strconv.Atoi(side)
+	}
+	cfg.Media.MaxVideoBytes = 50 << 20
+	if mb := lookup("MEDIA_MAX_VIDEO_MB"); mb != "" {
+		n, err := strconv.Atoi(mb)
+		if err != nil {
+			n = -1
+		}
+		cfg.Media.MaxVideoBytes = int64(n) << 20
+	}
+	cfg.Media.MaxVideoDuration = 60 * time.Second
+	if d := lookup("MEDIA_MAX_VIDEO_DURATION"); d != "" {
+		var err error
+		if cfg.Media.MaxVideoDuration, err = time.ParseDuration(d); err != nil {
+			cfg.Media.MaxVideoDuration = -1
+		}
+	}
+	cfg.Media.FFmpegPath = lookup("MEDIA_FFMPEG")
+	if cfg.Media.FFmpegPath == "" {
+		cfg.Media.FFmpegPath = "ffmpeg"
+	}
+
+	if score := lookup("RECAPTCHA_MIN_SCORE"); score != "" {
+		var err error
+		if cfg.Captcha.MinScore, err = strconv.ParseFloat(score, 64); err != nil {
+			cfg.Captcha.MinScore = -1
+		}
+	}
+	cfg.Captcha.MinFillTime = 3 * time.Second
+	if fill := lookup("BOOKING_MIN_FILL_TIME"); fill != "" {
+		var err error
+		if cfg.Captcha.MinFillTime, err = time.ParseDuration(fill); err != nil {
+			cfg.Captcha.MinFillTime = -1
+		}
+	}
+
+	cfg.RateLimit.Backend = strings.ToLower(lookup("RATE_LIMIT_BACKEND"))
+	if cfg.RateLimit.Backend == "" {
+		cfg.RateLimit.Backend = "memory"
+	}
+	cfg.RateLimit.Policies = map[string]RatePolicy{}
+	for name, policy := range defaultRateLimits {
+		if spec := lookup("RATE_LIMIT_" + strings.ToUpper(name)); spec != "" {
+			policy = parseRatePolicy(spec)
+		}
+		cfg.RateLimit.Policies[name] = policy
+	}
+
+	cfg.Port = 8080
+	if port := lookup("PORT"); port != "" {
+		cfg.Port, _ = strconv.Atoi(port)
+	}
+
+	cfg.ShutdownTimeout = 10 * time.Second
+	if timeout := lookup("SHUTDOWN_TIMEOUT"); timeout != "" {
+		cfg.ShutdownTimeout, _ = time.ParseDuration(timeout)
+	}
+
+	if origins := lookup("CORS_ORIGINS"); origins != "" {
+		for _, origin := range strings.Split(origins, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				cfg.CORSOrigins = append(cfg.CORSOrigins, strings.TrimSuffix(origin, "/"))
+			}
+		}
+	}
+
+	cfg.Proxy.TrustedPlatform = lookup("TRUSTED_PLATFORM")
+	if cfg.Proxy.TrustedPlatform == "" && lookup("FLY_APP_NAME") != "" {
+		cfg.Proxy.TrustedPlatform = "Fly-Client-IP"
+	}
+	for _, proxy := range strings.Split(lookup("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			cfg.Proxy.TrustedProxies = append(cfg.Proxy.TrustedProxies, proxy)
+		}
+	}
+
+	if cfg.Database.URL == "" {
+		if username := lookup("PG_USERNAME"); username != "" {
+			cfg.Database.URL = fmt.Sprintf("postgres://%s:%s@localhost:5432/mydb?sslmode=disable",
+				url.PathEscape(username), url.PathEscape(lookup("PG_PASSWORD")))
+		}
+	}
+
+	return cfg
+}
+
+// Validate reports every problem with the configuration at once. In
+// production it also refuses settings that are only safe for development:
+// missing secrets, the well-known JWT key and localhost URLs.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	switch c.Env {
+	case EnvDevelopment, EnvProduction:
+	default:
+		fail("APP_ENV: %q must be %q or %q", c.Env, EnvDevelopment, EnvProduction)
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		fail("PORT must be a number between 1 and 65535")
+	}
+	if c.ShutdownTimeout <= 0 {
+		fail("SHUTDOWN_TIMEOUT must be a positive duration such as 10s")
+	}
+
+	checkURL := func(name, value string) {
+		if value == "" {
+			return
+		}
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("%s: %q must be an absolute http(s) URL", name, value)
+		}
+	}
+	checkURL("FRONTEND_URL", c.FrontendURL)
+	checkURL("BACKEND_URL", c.BackendURL)
+	for _, origin := range c.CORSOrigins {
+		checkURL("CORS_ORIGINS", origin)
+	}
+
+	for _, proxy := range c.Proxy.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				fail("TRUSTED_PROXIES: %q is not an IP address or CIDR range", proxy)
+			}
+		}
+	}
+
+	switch c.Payments.Gateway {
+	case "":
+	case "stripe":
+		if c.Payments.StripeSecretKey == "" || c.Payments.StripeWebhookSecret == "" {
+			fail("PAYMENT_GATEWAY=stripe needs STRIPE_SECRET_KEY and STRIPE_WEBHOOK_SECRET")
+		}
+	case "fake":
+		if c.Production() {
+			fail("PAYMENT_GATEWAY: the fake gateway can't be used in production")
+		}
+	default:
+		fail("PAYMENT_GATEWAY: unknown gateway %q", c.Payments.Gateway)
+	}
+
+	switch c.Storage.Driver {
+	case "cloudinary":
+		cld := c.Storage.Cloudinary
+		if cld.Name == "" || cld.APIKey == "" || cld.APISecret == "" {
+			fail("CLOUDINARY_NAME, CLOUDINARY_API_KEY and CLOUDINARY_API_SECRET are required with STORAGE_DRIVER=cloudinary")
+		}
+	case "s3":
+		s3 := c.Storage.S3
+		if s3.Bucket == "" || s3.AccessKeyID == "" || s3.SecretAccessKey == "" {
+			fail("STORAGE_DRIVER=s3 needs S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY")
+		}
+		checkURL("S3_ENDPOINT", s3.Endpoint)
+		checkURL("S3_PUBLIC_URL", s3.PublicURL)
+	case "local":
+		checkURL("STORAGE_LOCAL_URL", c.Storage.Local.URL)
+	default:
+		fail("STORAGE_DRIVER: unknown driver %q", c.Storage.Driver)
+	}
+
+	if c.Media.MaxImageBytes <= 0 {
+		fail("MEDIA_MAX_IMAGE_MB must be a positive number")
+	}
+	if c.Media.MaxImageSide <= 0 {
+		fail("MEDIA_MAX_IMAGE_SIDE must be a positive number")
+	}
+	if c.Media.MaxVideoBytes <= 0 {
+		fail("MEDIA_MAX_VIDEO_MB must be a positive number")
+	}
+	if c.Media.MaxVideoDuration <= 0 {
+		fail("MEDIA_MAX_VIDEO_DURATION must be a positive duration such as 60s")
+	}
+
+	switch c.Captcha.Provider {
+	case "":
+	case "hcaptcha", "turnstile", "recaptcha":
+		if c.Captcha.SiteKey == "" || c.Captcha.Secret == "" {
+			fail("CAPTCHA_PROVIDER=%s needs CAPTCHA_SITE_KEY and CAPTCHA_SECRET", c.Captcha.Provider)
+		}
+	case "fake":
+		if c.Production() {
+			fail("CAPTCHA_PROVIDER: the fake verifier can't be used in production")
+		}
+	default:
+		fail("CAPTCHA_PROVIDER: unknown provider %q", c.Captcha.Provider)
+	}
+	if c.Captcha.MinScore < 0 || c.Captcha.MinScore > 1 {
+		fail("RECAPTCHA_MIN_SCORE must be a number between 0 and 1")
+	}
+	if c.Captcha.MinFillTime < 0 {
+		fail("BOOKING_MIN_FILL_TIME must be a duration such as 3s")
+	}
+
+	switch c.Notifier.Kind {
+	case "", "log":
+	case "smtp":
+		if c.Notifier.SMTPHost == "" || c.Notifier.SMTPFrom == "" {
+			fail("NOTIFIER=smtp needs SMTP_HOST and SMTP_FROM")
+		}
+	default:
+		fail("NOTIFIER: unknown notifier %q", c.Notifier.Kind)
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		fail("LOG_LEVEL: %q must be debug, info, warn or error", c.Log.Level)
+	}
+	switch c.Log.Format {
+	case "json", "text":
+	default:
+		fail("LOG_FORMAT: %q must be json or text", c.Log.Format)
+	}
+
+	if _, err := time.LoadLocation(c.Locale.TimeZone); err != nil {
+		fail("TIME_ZONE: %q is not a known time zone such as Europe/London", c.Locale.TimeZone)
+	}
+	if c.Locale.PhoneRegion != "" && phonenumbers.GetCountryCodeForRegion(c.Locale.PhoneRegion) == 0 {
+		fail("PHONE_REGION: %q is not a two-letter country code such as GB", c.Locale.PhoneRegion)
+	}
+
+	switch c.Tracing.Exporter {
+	case "", "none", "otlp":
+	default:
+		fail("TRACING_EXPORTER: unknown exporter %q", c.Tracing.Exporter)
+	}
+	checkURL("OTEL_EXPORTER_OTLP_ENDPOINT", c.Tracing.Endpoint)
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		fail("TRACING_SAMPLE_RATIO must be a number between 0 and 1")
+	}
+
+	switch c.RateLimit.Backend {
+	case "memory", "postgres", "none":
+	default:
+		fail("RATE_LIMIT_BACKEND: %q must be memory, postgres or none", c.RateLimit.Backend)
+	}
+	for name, policy := range c.RateLimit.Policies {
+		if policy.Limit < 0 || policy.Limit > 0 && policy.Period <= 0 {
+			fail("RATE_LIMIT_%s must be requests/period, such as 10/1m, or off", strings.ToUpper(name))
+		}
+	}
+
+	if c.Metrics.Addr != "" {
+		_, port, err := net.SplitHostPort(c.Metrics.Addr)
+		if err != nil || port == "" {
+			fail("METRICS_ADDR: %q must be an address such as :9091", c.Metrics.Addr)
+		} else if port == strconv.Itoa(c.Port) {
+			fail("METRICS_ADDR: %q must not use PORT", c.Metrics.Addr)
+		}
+	}
+	if c.Metrics.Token != "" && len(c.Metrics.Token) < 16 {
+		fail("METRICS_TOKEN must be at least 16 characters")
+	}
+
+	if c.Production() {
+		if c.Metrics.Addr == "" && c.Metrics.Token == "" {
+			fail("METRICS_ADDR or METRICS_TOKEN is required in production, so /metrics isn't public")
+		}
+		if c.Database.URL == "" {
+			fail("DATABASE_URL is required in production")
+		}
+		if c.FrontendURL == "" || c.BackendURL == "" {
+			fail("FRONTEND_URL and BACKEND_URL are required in production")
+		}
+		if isLocalhost(c.FrontendURL) {
+			fail("FRONTEND_URL: %q is a localhost URL", c.FrontendURL)
+		}
+		if isLocalhost(c.BackendURL) {
+			fail("BACKEND_URL: %q is a localhost URL", c.BackendURL)
+		}
+		if len(c.CORSOrigins) == 0 {
+			fail("CORS_ORIGINS is required in production")
+		}
+		for _, origin := range c.CORSOrigins {
+			if isLocalhost(origin) {
+				fail("CORS_ORIGINS: %q is a localhost origin", origin)
+			}
+		}
+		if len(c.JWTSecret) < 32 || c.JWTSecret == defaultJWTSecret {
+			fail("JWT_SECRET must be set to at least 32 characters in production")
+		}
+		if len(c.OAuth.StateSecret) < 16 || c.OAuth.StateSecret == "random-state-string" {
+			fail("OAUTH_STATE_SECRET must be set to at least 16 characters in production")
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// applyDevelopmentDefaults fills in what Validate lets development run
+// without, logging the insecure ones so they aren't used unknowingly
+func (c *Config) applyDevelopmentDefaults() {
+	if c.FrontendURL == "" {
+		c.FrontendURL = defaultFrontendURL
+	}
+	if c.BackendURL == "" {
+		c.BackendURL = defaultBackendURL
+	}
+	if len(c.CORSOrigins) == 0 {
+		c.CORSOrigins = defaultCORSOrigins
+	}
+	if c.Database.URL == "" {
+		c.Database.URL = "postgres://localhost:5432/mydb?sslmode=disable"
+	}
+	if c.JWTSecret == "" {
+		log.Println("JWT_SECRET is not set, signing tokens with an insecure development key")
+		c.JWTSecret = defaultJWTSecret
+	}
+	if c.OAuth.StateSecret == "" {
+		// A random state still protects the OAuth flow; it just changes on
+		// every restart
+		b := make([]byte, 16)
+		rand.Read(b)
+		c.OAuth.StateSecret = hex.EncodeToString(b)
+	}
+}
+
+// parseRatePolicy reads "10/1m" as 10 requests a minute. A spec that doesn't
+// parse gets a negative limit for Validate to report.
+func parseRatePolicy(spec string) RatePolicy {
+	spec = strings.TrimSpace(spec)
+	if strings.EqualFold(spec, "off") {
+		return RatePolicy{}
+	}
+	limit, period, ok := strings.Cut(spec, "/")
+	if !ok {
+		return RatePolicy{Limit: -1}
+	}
+	var policy RatePolicy
+	var err error
+	if policy.Limit, err = strconv.Atoi(strings.TrimSpace(limit)); err != nil || policy.Limit <= 0 {
+		return RatePolicy{Limit: -1}
+	}
+	if policy.Period, err = time.ParseDuration(strings.TrimSpace(period)); err != nil {
+		return RatePolicy{Limit: -1}
+	}
+	return policy
+}
+
+func isLocalhost(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func lookupFrom(env map[string]string) func(string) string {
+	return func(key string) string { return env[key] }
+}
+
+func TestDevelopmentRunsOnDefaults(t *testing.T) {
+	cfg := parse(lookupFrom(nil))
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() = %v, want nil", err)
+	}
+	cfg.applyDevelopmentDefaults()
+	if cfg.Addr() != ":8080" || cfg.FrontendURL != defaultFrontendURL || cfg.OAuth.StateSecret == "" {
+		t.Errorf("defaults = %+v", cfg)
+	}
+}
+
+func TestProductionRefusesInsecureDefaults(t *testing.T) {
+	cfg := parse(lookupFrom(map[string]string{
+		"APP_ENV":            "production",
+		"JWT_SECRET":         "dummy_key",
+		"OAUTH_STATE_SECRET": "random-state-string",
+		"CORS_ORIGINS":       "http://localhost:5173",
+		"PAYMENT_GATEWAY":    "fake",
+	}))
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil, want an error")
+	}
+	for _, want := range []string{"DATABASE_URL", "FRONTEND_URL", "localhost origin", "JWT_SECRET", "OAUTH_STATE_SECRET", "CLOUDINARY_NAME", "fake gateway", "METRICS_ADDR"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %q, want it to mention %s", err, want)
+		}
+	}
+}
+
+func TestProductionAcceptsCompleteConfig(t *testing.T) {
+	cfg := parse(lookupFrom(map[string]string{
+		"APP_ENV":               "production",
+		"PORT":                  "3000",
+		"DATABASE_URL":          "postgres://booking@db:5432/booking",
+		"FRONTEND_URL":          "https://glowbook-booking.vercel.app/",
+		"BACKEND_URL":           "https://booking-server.fly.dev",
+		"CORS_ORIGINS":          "https://glowbook-booking.vercel.app, https://admin.example.com",
+		"JWT_SECRET":            strings.Repeat("k", 32),
+		"OAUTH_STATE_SECRET":    strings.Repeat("s", 16),
+		"CLOUDINARY_NAME":       "booking",
+		"CLOUDINARY_API_KEY":    "key",
+		"CLOUDINARY_API_SECRET": "secret",
+		"METRICS_ADDR":          ":9091",
+	}))
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() = %v, want nil", err)
+	}
+	if cfg.Addr() != ":3000" || cfg.FrontendURL != "https://glowbook-booking.vercel.app" || len(cfg.CORSOrigins) != 2 {
+		t.Errorf("parsed %+v", cfg)
+	}
+}
+
+func TestProductionRefusesLocalhostURLs(t *testing.T) {
+	for _, tc := range []struct{ key, value string }{
+		{"FRONTEND_URL", "http://localhost:5173"},
+		{"BACKEND_URL", "http://127.0.0.1:8080"},
+		{"BACKEND_URL", "http://[::1]:8080"},
+	} {
+		env := map[string]string{
+			"APP_ENV":               "production",
+			"DATABASE_URL":          "postgres://booking@db:5432/booking",
+			"FRONTEND_URL":          "https://glowbook-booking.vercel.app",
+			"BACKEND_URL":           "https://booking-server.fly.dev",
+			"CORS_ORIGINS":          "https://glowbook-booking.vercel.app",
+			"JWT_SECRET":            strings.Repeat("k", 32),
+			"OAUTH_STATE_SECRET":    strings.Repeat("s", 16),
+			"CLOUDINARY_NAME":       "booking",
+			"CLOUDINARY_API_KEY":    "key",
+			"CLOUDINARY_API_SECRET": "secret",
+			"METRICS_ADDR":          ":9091",
+		}
+		env[tc.key] = tc.value
+		err := parse(lookupFrom(env)).Validate()
+		if err == nil || !strings.Contains(err.Error(), tc.key+": ") {
+			t.Errorf("Validate() with %s=%s = %v, want it to mention %s", tc.key, tc.value, err, tc.key)
+		}
+	}
+}
+
+func TestInvalidValuesAreReportedTogether(t *testing.T) {
+	cfg := parse(lookupFrom(map[string]string{
+		"APP_ENV":                  "staging",
+		"PORT":                     "http",
+		"SHUTDOWN_TIMEOUT":         "soon",
+		"NOTIFIER":                 "smtp",
+		"RATE_LIMIT_AUTH":          "ten a minute",
+		"CAPTCHA_PROVIDER":         "turnstile",
+		"MEDIA_MAX_VIDEO_DURATION": "a minute",
+		"TIME_ZONE":                "Mars/Olympus_Mons",
+		"PHONE_REGION":             "UK",
+		"METRICS_TOKEN":            "short",
+	}))
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil, want an error")
+	}
+	for _, want := range []string{"APP_ENV", "PORT", "SHUTDOWN_TIMEOUT", "SMTP_HOST", "RATE_LIMIT_AUTH", "CAPTCHA_SITE_KEY", "MEDIA_MAX_VIDEO_DURATION", "TIME_ZONE", "PHONE_REGION", "METRICS_TOKEN"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %q, want it to mention %s", err, want)
+		}
+	}
+}
+
+func TestRateLimitPolicies(t *testing.T) {
+	cfg := parse(lookupFrom(map[string]string{
+		"RATE_LIMIT_BACKEND": "postgres",
+		"RATE_LIMIT_AUTH":    "5/30s",
+		"RATE_LIMIT_API":     "off",
+	}))
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() = %v, want nil", err)
+	}
+	policies := cfg.RateLimit.Policies
+	if got := policies["auth"]; got.Limit != 5 || got.Period != 30*time.Second {
+		t.Errorf("auth = %+v, want 5/30s", got)
+	}
+	if got := policies["api"]; got.Limit != 0 {
+		t.Errorf("api = %+v, want off", got)
+	}
+	if got := policies["booking"]; got != defaultRateLimits["booking"] {
+		t.Errorf("booking = %+v, want the default", got)
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	cfg := parse(lookupFrom(nil))
+	if cfg.Proxy.TrustedPlatform != "" || len(cfg.Proxy.TrustedProxies) != 0 {
+		t.Errorf("proxy = %+v, want forwarding headers ignored by default", cfg.Proxy)
+	}
+
+	cfg = parse(lookupFrom(map[string]string{"FLY_APP_NAME": "booking-server"}))
+	if cfg.Proxy.TrustedPlatform != "Fly-Client-IP" {
+		t.Errorf("TrustedPlatform on Fly = %q, want Fly-Client-IP", cfg.Proxy.TrustedPlatform)
+	}
+
+	cfg = parse(lookupFrom(map[string]string{"TRUSTED_PROXIES": "10.0.0.0/8, 192.0.2.1, proxy.internal"}))
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "proxy.internal") {
+		t.Errorf("Validate() = %v, want it to reject proxy.internal", err)
+	}
+	if len(cfg.Proxy.TrustedProxies) != 3 {
+		t.Errorf("TrustedProxies = %v, want 3 entries", cfg.Proxy.TrustedProxies)
+	}
+}
+
+func TestFlyDefaultsToProduction(t *testing.T) {
+	cfg := parse(lookupFrom(map[string]string{"FLY_APP_NAME": "booking-server"}))
+	if !cfg.Production() {
+		t.Fatalf("Env on Fly = %q, want production", cfg.Env)
+	}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "JWT_SECRET") {
+		t.Errorf("Validate() = %v, want it to require JWT_SECRET", err)
+	}
+
+	cfg = parse(lookupFrom(map[string]string{"FLY_APP_NAME": "booking-server", "APP_ENV": "development"}))
+	if cfg.Production() {
+		t.Error("an explicit APP_ENV=development on Fly was overridden")
+	}
+}
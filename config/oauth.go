@@ -1,8 +1,6 @@
 package config
 
 import (
-	"os"
-
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/facebook"
 	"golang.org/x/oauth2/google"
@@ -15,25 +13,14 @@ var (
 	FrontendURL         string
 )
 
-func InitOAuth() {
-	FrontendURL = os.Getenv("FRONTEND_URL")
-	if FrontendURL == "" {
-		FrontendURL = "http://localhost:5173"
-	}
-
-	backendURL := os.Getenv("BACKEND_URL")
-	if backendURL == "" {
-		backendURL = "http://localhost:8080"
-	}
-
-	OAuthStateString = os.Getenv("OAUTH_STATE_SECRET")
-	if OAuthStateString == "" {
-		OAuthStateString = "random-state-string" // Should be set in production
-	}
+func InitOAuth(cfg *Config) {
+	FrontendURL = cfg.FrontendURL
+	backendURL := cfg.BackendURL
+	OAuthStateString = cfg.OAuth.StateSecret
 
 	GoogleOAuthConfig = &oauth2.Config{
-		ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
-		ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+		ClientID:     cfg.OAuth.GoogleClientID,
+		ClientSecret: cfg.OAuth.GoogleClientSecret,
 		RedirectURL:  backendURL + "/api/auth/google/callback",
 		Scopes: []string{
 			"https://www.googleapis.com/auth/userinfo.email",
@@ -43,8 +30,8 @@ func InitOAuth() {
 	}
 
 	FacebookOAuthConfig = &oauth2.Config{
-		ClientID:     os.Getenv("FACEBOOK_CLIENT_ID"),
-		ClientSecret: os.Getenv("FACEBOOK_CLIENT_SECRET"),
+		ClientID:     cfg.OAuth.FacebookClientID,
+		ClientSecret: cfg.OAuth.FacebookClientSecret,
 		RedirectURL:  backendURL + "/api/auth/facebook/callback",
 		Scopes: []string{
 			"email",
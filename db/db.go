@@ -1,30 +1,49 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
-	"os"
+	"sync/atomic"
 	"time"
 
-	_ "github.com/lib/pq"
+	"example.com/logging"
+	"github.com/XSAM/otelsql"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var DB *sql.DB
 
-func InitDB() {
-	var dsn string
+// CurrencyCodes are the ISO 4217 codes service prices can be in, which the
+// models package registers. Legacy free-text currencies are migrated to them.
+var CurrencyCodes []string
 
-	dsn = os.Getenv("DATABASE_URL")
+// ready is set once InitDB has connected and created the tables
+var ready atomic.Bool
 
-	if dsn == "" {
-		username := os.Getenv("PG_USERNAME")
-		password := os.Getenv("PG_PASSWORD")
-		dsn = fmt.Sprintf("postgres://%s:%s@localhost:5432/mydb?sslmode=disable", username, password)
+// Ready reports whether the database is connected and migrated
+func Ready() bool {
+	return ready.Load()
+}
+
+// Open creates the connection pool for dsn without connecting, so
+// repositories can be constructed before InitDB has reached the database
+func Open(dsn string) *sql.DB {
+	if DB != nil {
+		return DB
 	}
 
+	// Every query becomes a span of the request that ran it
 	var err error
-	DB, err = sql.Open("postgres", dsn)
+	DB, err = otelsql.Open("postgres", dsn,
+		otelsql.WithAttributes(attribute.String("db.system.name", "postgresql")),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}),
+	)
 	if err != nil {
 		panic("Could not connect to DB: " + err.Error())
 	}
@@ -34,28 +53,52 @@ func InitDB() {
 	DB.SetMaxIdleConns(5)
 	DB.SetConnMaxLifetime(5 * time.Minute)
 	DB.SetConnMaxIdleTime(5 * time.Minute)
+	return DB
+}
 
+// InitDB connects the pool created by Open, retrying while the database
+// starts up, and creates the tables. It gives up when ctx is cancelled or
+// the database stays unreachable.
+func InitDB(ctx context.Context) error {
 	// Verify connection with retries
+	var err error
 	maxRetries := 10
 	for i := 0; i < maxRetries; i++ {
-		err = DB.Ping()
+		err = DB.PingContext(ctx)
 		if err == nil {
-			log.Println("Successfully connected to database")
+			logging.Logger.Info("Successfully connected to database")
 			break
 		}
-		log.Printf("Failed to ping database (attempt %d/%d): %v", i+1, maxRetries, err)
+		logging.Logger.WithError(err).Warnf("Failed to ping database (attempt %d/%d)", i+1, maxRetries)
 		if i < maxRetries-1 {
-			time.Sleep(2 * time.Second)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(2 * time.Second):
+			}
 		}
 	}
 	if err != nil {
-		panic("Could not verify DB connection after retries: " + err.Error())
+		return fmt.Errorf("could not verify DB connection after retries: %w", err)
 	}
 
-	createTables()
+	if err := createTables(); err != nil {
+		return err
+	}
+	ready.Store(true)
+	return nil
+}
+
+// Close closes the connection pool, waiting for queries in flight
+func Close() error {
+	ready.Store(false)
+	if DB == nil {
+		return nil
+	}
+	return DB.Close()
 }
 
-func createTables() {
+func createTables() error {
 	createUsersTable := `
     CREATE TABLE IF NOT EXISTS users (
         id BIGSERIAL PRIMARY KEY,
@@ -139,7 +182,7 @@ func createTables() {
 	for _, stmt := range statements {
 		_, err := DB.Exec(stmt)
 		if err != nil {
-			panic("Could not create table: " + err.Error())
+			return fmt.Errorf("could not create table: %w", err)
 		}
 	}
 
@@ -150,7 +193,7 @@ func createTables() {
 	`
 	_, err := DB.Exec(alterServicesTable)
 	if err != nil {
-		panic("Could not alter services table: " + err.Error())
+		return fmt.Errorf("could not alter services table: %w", err)
 	}
 
 	// Add alias column to users table (for existing databases)
@@ -160,13 +203,13 @@ func createTables() {
 	`
 	_, err = DB.Exec(alterUsersTable)
 	if err != nil {
-		panic("Could not alter users table: " + err.Error())
+		return fmt.Errorf("could not alter users table: %w", err)
 	}
 
 	// Backfill alias for existing users that have NULL
 	_, err = DB.Exec(`UPDATE users SET alias = gen_random_uuid()::text WHERE alias IS NULL`)
 	if err != nil {
-		panic("Could not backfill user aliases: " + err.Error())
+		return fmt.Errorf("could not backfill user aliases: %w", err)
 	}
 
 	// Add OAuth columns to users table (for SSO support)
@@ -178,7 +221,7 @@ func createTables() {
 	`
 	_, err = DB.Exec(addOAuthColumns)
 	if err != nil {
-		panic("Could not add OAuth columns to users table: " + err.Error())
+		return fmt.Errorf("could not add OAuth columns to users table: %w", err)
 	}
 
 	// Make password nullable for OAuth users
@@ -200,8 +243,429 @@ func createTables() {
 	`
 	_, err = DB.Exec(addOAuthUniqueConstraint)
 	if err != nil {
-		panic("Could not add OAuth unique constraint: " + err.Error())
+		return fmt.Errorf("could not add OAuth unique constraint: %w", err)
+	}
+
+	// Service variants (e.g. "with gel") and optional add-ons
+	createServiceOptionsTables := `
+		CREATE TABLE IF NOT EXISTS service_variants (
+			id         BIGSERIAL PRIMARY KEY,
+			service_id BIGINT NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+			name       TEXT   NOT NULL,
+			price      BIGINT NOT NULL DEFAULT 0,
+			duration   BIGINT NOT NULL DEFAULT 0,
+			position   INT    NOT NULL DEFAULT 0
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_service_variants_service_id
+		ON service_variants (service_id);
+
+		CREATE TABLE IF NOT EXISTS service_addons (
+			id         BIGSERIAL PRIMARY KEY,
+			service_id BIGINT NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+			name       TEXT   NOT NULL,
+			price      BIGINT NOT NULL DEFAULT 0,
+			duration   BIGINT NOT NULL DEFAULT 0,
+			position   INT    NOT NULL DEFAULT 0
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_service_addons_service_id
+		ON service_addons (service_id);
+	`
+	_, err = DB.Exec(createServiceOptionsTables)
+	if err != nil {
+		return fmt.Errorf("could not create service options tables: %w", err)
+	}
+
+	// Store the total duration on appointments; the chosen variant and
+	// add-ons are kept per service on appointment_items
+	_, err = DB.Exec(`ALTER TABLE appointments ADD COLUMN IF NOT EXISTS duration BIGINT`)
+	if err != nil {
+		return fmt.Errorf("could not add duration column to appointments table: %w", err)
+	}
+
+	// Line items for appointments booking several services back to back
+	createAppointmentItemsTable := `
+		CREATE TABLE IF NOT EXISTS appointment_items (
+			id             BIGSERIAL PRIMARY KEY,
+			appointment_id UUID   NOT NULL REFERENCES appointments(id) ON DELETE CASCADE,
+			service_id     BIGINT NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+			variant_id     BIGINT REFERENCES service_variants(id) ON DELETE SET NULL,
+			options        JSONB,
+			duration       BIGINT NOT NULL,
+			start_time     TIME   NOT NULL,
+			end_time       TIME   NOT NULL,
+			position       INT    NOT NULL DEFAULT 0
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_appointment_items_appointment_id
+		ON appointment_items (appointment_id);
+	`
+	_, err = DB.Exec(createAppointmentItemsTable)
+	if err != nil {
+		return fmt.Errorf("could not create appointment_items table: %w", err)
+	}
+
+	// Backfill a single line item for appointments booked before multi-service
+	// support. Databases migrated while the variant and add-ons were stored on
+	// appointments still have those columns: read them through to_jsonb, which
+	// yields NULL where they don't exist, and drop them once copied.
+	_, err = DB.Exec(`
+		INSERT INTO appointment_items (appointment_id, service_id, variant_id, options, duration, start_time, end_time, position)
+		SELECT a.id, a.service_id,
+		       (SELECT v.id FROM service_variants v WHERE v.id = (to_jsonb(a) ->> 'variant_id')::bigint),
+		       NULLIF(to_jsonb(a) -> 'options', 'null'),
+		       COALESCE(a.duration, EXTRACT(EPOCH FROM (a.end_time - a.start_time))::bigint / 60),
+		       a.start_time, a.end_time, 0
+		FROM appointments a
+		WHERE NOT EXISTS (SELECT 1 FROM appointment_items i WHERE i.appointment_id = a.id)
+	`)
+	if err != nil {
+		return fmt.Errorf("could not backfill appointment items: %w", err)
+	}
+	_, err = DB.Exec(`ALTER TABLE appointments DROP COLUMN IF EXISTS variant_id, DROP COLUMN IF EXISTS options`)
+	if err != nil {
+		return fmt.Errorf("could not drop option columns from appointments table: %w", err)
+	}
+
+	// Prices are stored in integer minor units of an ISO 4217 currency.
+	// The legacy price columns held whole major units: services were created
+	// from a form whose price went through strconv.ParseInt, so "12.50" could
+	// never be stored and 12 meant 12 euros, not cents. Scale them by the
+	// currency exponent once (0 for JPY-like, 3 for KWD-like, 2 otherwise).
+	addPriceMinorColumns := `
+		ALTER TABLE services ADD COLUMN IF NOT EXISTS price_minor BIGINT;
+		-- The free-text currency a service had before the migration
+		ALTER TABLE services ADD COLUMN IF NOT EXISTS legacy_currency TEXT;
+		ALTER TABLE service_variants ADD COLUMN IF NOT EXISTS price_minor BIGINT;
+		ALTER TABLE service_addons ADD COLUMN IF NOT EXISTS price_minor BIGINT;
+		ALTER TABLE appointments
+		ADD COLUMN IF NOT EXISTS price_minor BIGINT,
+		ADD COLUMN IF NOT EXISTS currency TEXT;
+		ALTER TABLE appointment_items
+		ADD COLUMN IF NOT EXISTS price_minor BIGINT,
+		ADD COLUMN IF NOT EXISTS currency TEXT;
+	`
+	_, err = DB.Exec(addPriceMinorColumns)
+	if err != nil {
+		return fmt.Errorf("could not add price_minor columns: %w", err)
+	}
+
+	minorUnitScale := `
+		CASE
+			WHEN s.currency IN ('BIF','CLP','DJF','GNF','ISK','JPY','KMF','KRW','PYG','RWF','UGX','VND','VUV','XAF','XOF','XPF') THEN 1
+			WHEN s.currency IN ('BHD','IQD','JOD','KWD','LYD','OMR','TND') THEN 1000
+			WHEN s.currency IN ('CLF','UYW') THEN 10000
+			ELSE 100
+		END`
+	// The legacy currency was free text. Codes in any case and the common
+	// symbols and names are mapped to their ISO code. Anything else, empty
+	// included, can't be priced and becomes EUR; the original is kept in
+	// legacy_currency and the count logged so providers can be asked to fix
+	// theirs.
+	normalizeCurrencies := `
+		UPDATE services SET legacy_currency = currency, currency = CASE
+			WHEN UPPER(TRIM(currency)) = ANY($1) THEN UPPER(TRIM(currency))
+			WHEN UPPER(TRIM(currency)) IN ('€', 'EURO', 'EUROS') THEN 'EUR'
+			WHEN UPPER(TRIM(currency)) IN ('$', 'US$', 'DOLLAR', 'DOLLARS') THEN 'USD'
+			WHEN UPPER(TRIM(currency)) IN ('£', 'POUND', 'POUNDS') THEN 'GBP'
+			ELSE 'EUR'
+		END
+		WHERE price_minor IS NULL AND (currency IS NULL OR NOT (currency = ANY($1)))
+	`
+	result, err := DB.Exec(normalizeCurrencies, pq.Array(CurrencyCodes))
+	if err != nil {
+		return fmt.Errorf("could not normalize service currencies: %w", err)
+	}
+	if migrated, _ := result.RowsAffected(); migrated > 0 {
+		logging.Logger.Warnf("Normalized the free-text currency of %d service(s); the original is kept in services.legacy_currency", migrated)
+	}
+
+	backfillPrices := []string{
+		`UPDATE services s SET price_minor = COALESCE(s.price, 0) * ` + minorUnitScale + ` WHERE s.price_minor IS NULL`,
+		`UPDATE service_variants o SET price_minor = o.price * ` + minorUnitScale + `
+		 FROM services s WHERE s.id = o.service_id AND o.price_minor IS NULL`,
+		`UPDATE service_addons o SET price_minor = o.price * ` + minorUnitScale + `
+		 FROM services s WHERE s.id = o.service_id AND o.price_minor IS NULL`,
+		// Appointments booked before price snapshots get the service's current price
+		`UPDATE appointment_items i SET price_minor = s.price_minor, currency = s.currency
+		 FROM services s WHERE s.id = i.service_id AND i.price_minor IS NULL`,
+		`UPDATE appointments a SET price_minor = t.total, currency = t.currency
+		 FROM (SELECT appointment_id, SUM(price_minor) AS total, MIN(currency) AS currency
+		       FROM appointment_items GROUP BY appointment_id) t
+		 WHERE t.appointment_id = a.id AND a.price_minor IS NULL`,
+	}
+	for _, stmt := range backfillPrices {
+		_, err = DB.Exec(stmt)
+		if err != nil {
+			return fmt.Errorf("could not backfill minor unit prices: %w", err)
+		}
+	}
+
+	// Online deposits: appointments wait in pending_payment with a hold on the slot
+	addAppointmentPaymentColumns := `
+		ALTER TABLE appointments
+		ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'confirmed',
+		ADD COLUMN IF NOT EXISTS hold_expires_at TIMESTAMP,
+		ADD COLUMN IF NOT EXISTS cancel_token TEXT;
+
+		CREATE INDEX IF NOT EXISTS idx_appointments_pending_hold
+		ON appointments (hold_expires_at)
+		WHERE status = 'pending_payment';
+	`
+	_, err = DB.Exec(addAppointmentPaymentColumns)
+	if err != nil {
+		return fmt.Errorf("could not add payment columns to appointments table: %w", err)
+	}
+
+	createPaymentsTables := `
+		CREATE TABLE IF NOT EXISTS payment_settings (
+			user_id             BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			deposit_type        TEXT NOT NULL DEFAULT 'none',
+			deposit_percent     INT  NOT NULL DEFAULT 0,
+			hold_minutes        INT  NOT NULL DEFAULT 30,
+			refund_window_hours INT  NOT NULL DEFAULT 24
+		);
+
+		CREATE TABLE IF NOT EXISTS payments (
+			id             BIGSERIAL PRIMARY KEY,
+			appointment_id UUID REFERENCES appointments(id) ON DELETE SET NULL,
+			user_id        BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			gateway        TEXT   NOT NULL,
+			checkout_id    TEXT   NOT NULL UNIQUE,
+			payment_id     TEXT,
+			refund_id      TEXT,
+			amount_minor   BIGINT NOT NULL,
+			currency       TEXT   NOT NULL,
+			status         TEXT   NOT NULL,
+			created_at     TIMESTAMP DEFAULT NOW(),
+			updated_at     TIMESTAMP DEFAULT NOW()
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_payments_appointment_id
+		ON payments (appointment_id);
+
+		-- Refunds the sweeper still has to retry
+		CREATE INDEX IF NOT EXISTS idx_payments_refund_due
+		ON payments (updated_at) WHERE status = 'refund_due';
+	`
+	_, err = DB.Exec(createPaymentsTables)
+	if err != nil {
+		return fmt.Errorf("could not create payments tables: %w", err)
+	}
+
+	// Short-lived holds reserving a slot while the client fills in the booking form
+	createSlotHoldsTable := `
+		CREATE TABLE IF NOT EXISTS slot_holds (
+			id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id    BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			date       DATE   NOT NULL,
+			start_time TIME   NOT NULL,
+			end_time   TIME   NOT NULL,
+			token      TEXT   NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP DEFAULT NOW()
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_slot_holds_expires_at
+		ON slot_holds (expires_at);
+
+		-- The client address, to cap how many slots one client holds
+		ALTER TABLE slot_holds ADD COLUMN IF NOT EXISTS ip TEXT NOT NULL DEFAULT '';
+
+		CREATE INDEX IF NOT EXISTS idx_slot_holds_ip
+		ON slot_holds (ip);
+	`
+	_, err = DB.Exec(createSlotHoldsTable)
+	if err != nil {
+		return fmt.Errorf("could not create slot_holds table: %w", err)
+	}
+
+	createWaitlistTables := `
+		CREATE TABLE IF NOT EXISTS waitlist_entries (
+			id               UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id          BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			service_id       BIGINT NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+			variant_id       BIGINT,
+			add_on_ids       JSONB NOT NULL DEFAULT '[]',
+			date_from        DATE NOT NULL,
+			date_to          DATE NOT NULL,
+			first_name       TEXT NOT NULL,
+			last_name        TEXT NOT NULL,
+			email            TEXT NOT NULL,
+			phone            TEXT NOT NULL,
+			status           TEXT NOT NULL DEFAULT 'waiting',
+			token            TEXT NOT NULL,
+			offer_date       DATE,
+			offer_start      TIME,
+			offer_end        TIME,
+			offer_token      TEXT,
+			offer_expires_at TIMESTAMP,
+			appointment_id   UUID REFERENCES appointments(id) ON DELETE SET NULL,
+			created_at       TIMESTAMP DEFAULT NOW()
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_waitlist_entries_user_status
+		ON waitlist_entries (user_id, status, date_from, date_to);
+
+		-- Days an offer to the entry lapsed on, which pass to the next in line
+		ALTER TABLE waitlist_entries ADD COLUMN IF NOT EXISTS passed_dates DATE[] NOT NULL DEFAULT '{}';
+
+		CREATE TABLE IF NOT EXISTS freed_slots (
+			id         BIGSERIAL PRIMARY KEY,
+			user_id    BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			date       DATE   NOT NULL,
+			created_at TIMESTAMP DEFAULT NOW()
+		);
+	`
+	_, err = DB.Exec(createWaitlistTables)
+	if err != nil {
+		return fmt.Errorf("could not create waitlist tables: %w", err)
+	}
+
+	createClientsTable := `
+		CREATE TABLE IF NOT EXISTS clients (
+			id               BIGSERIAL PRIMARY KEY,
+			user_id          BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			first_name       TEXT NOT NULL DEFAULT '',
+			last_name        TEXT NOT NULL DEFAULT '',
+			email            TEXT NOT NULL DEFAULT '',
+			phone            TEXT NOT NULL DEFAULT '',
+			instagram        TEXT NOT NULL DEFAULT '',
+			email_normalized TEXT NOT NULL DEFAULT '',
+			phone_normalized TEXT NOT NULL DEFAULT '',
+			notes            TEXT NOT NULL DEFAULT '',
+			tags             JSONB NOT NULL DEFAULT '[]',
+			created_at       TIMESTAMP DEFAULT NOW(),
+			updated_at       TIMESTAMP DEFAULT NOW()
+		);
+
+		ALTER TABLE appointments ADD COLUMN IF NOT EXISTS client_id BIGINT REFERENCES clients(id) ON DELETE SET NULL;
+		ALTER TABLE appointments ADD COLUMN IF NOT EXISTS no_show BOOLEAN NOT NULL DEFAULT FALSE;
+		CREATE INDEX IF NOT EXISTS idx_appointments_client_id ON appointments (client_id);
+
+		-- Backfill: one client per provider and normalized email (or phone when there is no email)
+		INSERT INTO clients (user_id, first_name, last_name, email, phone, instagram, email_normalized, phone_normalized)
+		SELECT DISTINCT ON (a.user_id, k.match_key)
+		       a.user_id, a.first_name, a.last_name, a.email, a.phone, COALESCE(a.instagram, ''), k.email_n, k.phone_n
+		FROM appointments a
+		CROSS JOIN LATERAL (
+			SELECT lower(trim(a.email)) AS email_n,
+			       regexp_replace(a.phone, '[^0-9]', '', 'g') AS phone_n,
+			       COALESCE(NULLIF(lower(trim(a.email)), ''), regexp_replace(a.phone, '[^0-9]', '', 'g')) AS match_key
+		) k
+		WHERE a.client_id IS NULL AND k.match_key <> ''
+		  AND NOT EXISTS (
+			SELECT 1 FROM clients c
+			WHERE c.user_id = a.user_id
+			  AND ((c.email_normalized <> '' AND c.email_normalized = k.email_n)
+			    OR (c.phone_normalized <> '' AND c.phone_normalized = k.phone_n))
+		  )
+		ORDER BY a.user_id, k.match_key, a.created_at DESC
+		ON CONFLICT DO NOTHING;
+
+		UPDATE appointments a
+		SET client_id = (
+			SELECT c.id FROM clients c
+			WHERE c.user_id = a.user_id
+			  AND ((c.email_normalized <> '' AND c.email_normalized = lower(trim(a.email)))
+			    OR (c.phone_normalized <> '' AND c.phone_normalized = regexp_replace(a.phone, '[^0-9]', '', 'g')))
+			ORDER BY (c.email_normalized = lower(trim(a.email))) DESC, c.id
+			LIMIT 1
+		)
+		WHERE a.client_id IS NULL;
+	`
+	_, err = DB.Exec(createClientsTable)
+	if err != nil {
+		return fmt.Errorf("could not create clients table: %w", err)
+	}
+
+	// A normalized email or phone belongs to one client per provider, so
+	// concurrent first bookings can't create the same client twice. Clients
+	// sharing one before this keep their details, but only the oldest is
+	// matched on it; providers can merge the rest.
+	uniqueClientContacts := `
+		UPDATE clients c SET email_normalized = ''
+		WHERE c.email_normalized <> '' AND EXISTS (
+			SELECT 1 FROM clients o
+			WHERE o.user_id = c.user_id AND o.email_normalized = c.email_normalized AND o.id < c.id
+		);
+		UPDATE clients c SET phone_normalized = ''
+		WHERE c.phone_normalized <> '' AND EXISTS (
+			SELECT 1 FROM clients o
+			WHERE o.user_id = c.user_id AND o.phone_normalized = c.phone_normalized AND o.id < c.id
+		);
+
+		DROP INDEX IF EXISTS idx_clients_user_email;
+		DROP INDEX IF EXISTS idx_clients_user_phone;
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_clients_user_email_unique
+		ON clients (user_id, email_normalized) WHERE email_normalized <> '';
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_clients_user_phone_unique
+		ON clients (user_id, phone_normalized) WHERE phone_normalized <> '';
+	`
+	_, err = DB.Exec(uniqueClientContacts)
+	if err != nil {
+		return fmt.Errorf("could not make client contacts unique: %w", err)
+	}
+
+	createRestrictionTables := `
+		CREATE TABLE IF NOT EXISTS blocked_clients (
+			id         BIGSERIAL PRIMARY KEY,
+			user_id    BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			kind       TEXT NOT NULL,
+			value      TEXT NOT NULL,
+			reason     TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT NOW(),
+			UNIQUE (user_id, kind, value)
+		);
+
+		CREATE TABLE IF NOT EXISTS booking_rules (
+			user_id               BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			prepay_after_no_shows INT NOT NULL DEFAULT 0,
+			max_future_bookings   INT NOT NULL DEFAULT 0
+		);
+	`
+	_, err = DB.Exec(createRestrictionTables)
+	if err != nil {
+		return fmt.Errorf("could not create booking restriction tables: %w", err)
+	}
+
+	createPaginationIndexes := `
+		CREATE INDEX IF NOT EXISTS idx_appointments_user_date_id
+			ON appointments (user_id, (date + start_time), id);
+		CREATE INDEX IF NOT EXISTS idx_services_user_created_id
+			ON services (user_id, (COALESCE(timestamp, 'epoch')), id);
+		CREATE INDEX IF NOT EXISTS idx_events_date_time_id
+			ON events (dateTime, id);
+	`
+	_, err = DB.Exec(createPaginationIndexes)
+	if err != nil {
+		return fmt.Errorf("could not create pagination indexes: %w", err)
+	}
+
+	createRateLimitTable := `
+		CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+			key        TEXT PRIMARY KEY,
+			tokens     DOUBLE PRECISION NOT NULL,
+			allowed    BOOLEAN NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+	`
+	_, err = DB.Exec(createRateLimitTable)
+	if err != nil {
+		return fmt.Errorf("could not create rate limit table: %w", err)
+	}
+
+	// Providers may let public bookings through without a CAPTCHA
+	addCaptchaRule := `
+		ALTER TABLE booking_rules
+		ADD COLUMN IF NOT EXISTS disable_captcha BOOLEAN NOT NULL DEFAULT FALSE;
+	`
+	_, err = DB.Exec(addCaptchaRule)
+	if err != nil {
+		return fmt.Errorf("could not add captcha rule to booking_rules table: %w", err)
 	}
 
-	fmt.Println("PostgreSQL tables created successfully!")
+	logging.Logger.Info("PostgreSQL tables created successfully")
+	return nil
 }
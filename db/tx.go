@@ -0,0 +1,38 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// DBTX is the query interface shared by *sql.DB and *sql.Tx, so repositories
+// can run against the pool or inside a caller's transaction
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// WithTx runs fn in a transaction on conn, committing if it returns nil. When
+// conn is already a transaction fn joins it and committing is left to its owner.
+func WithTx(ctx context.Context, conn DBTX, fn func(tx *sql.Tx) error) error {
+	switch c := conn.(type) {
+	case *sql.Tx:
+		return fn(c)
+	case *sql.DB:
+		tx, err := c.BeginTx(ctx, &sql.TxOptions{})
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	default:
+		return fmt.Errorf("db: cannot begin a transaction on %T", conn)
+	}
+}
@@ -0,0 +1,216 @@
+// Package imaging checks uploaded photos and prepares them for the web. Process
+// accepts only formats it recognises by their magic bytes, refuses files and
+// images that are too large, turns photos upright, drops their metadata (EXIF,
+// including GPS position) by re-encoding them and renders the sizes the
+// booking pages show.
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif" // animated GIFs decode to their first frame
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/gen2brain/heic"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Format is an image format uploads may use
+type Format string
+
+const (
+	JPEG Format = "jpeg"
+	PNG  Format = "png"
+	GIF  Format = "gif"
+	WebP Format = "webp"
+	// HEIC is what iPhones take photos in. Browsers can't show it, so like
+	// every upload it is only ever stored re-encoded.
+	HEIC Format = "heic"
+)
+
+// Size is a rendition Process produces. Images are scaled down, never up, so
+// their longest side is at most MaxSide.
+type Size struct {
+	Name    string
+	MaxSide int
+}
+
+// Sizes are the renditions every photo gets, smallest first
+var Sizes = []Size{
+	{Name: "thumbnail", MaxSide: 320},
+	{Name: "medium", MaxSide: 1024},
+	{Name: "full", MaxSide: 2048},
+}
+
+// Limits bound what Process accepts
+type Limits struct {
+	MaxBytes int64
+	// MaxSide is the longest width or height an upload may have, in pixels
+	MaxSide int
+}
+
+// RejectedError explains why an upload was refused, in terms fit for the
+// uploader
+type RejectedError struct {
+	Reason string
+}
+
+func (e *RejectedError) Error() string { return e.Reason }
+
+func rejected(format string, args ...any) error {
+	return &RejectedError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// Variant is an encoded rendition of an upload
+type Variant struct {
+	Name        string
+	Width       int
+	Height      int
+	ContentType string
+	Data        []byte
+}
+
+// jpegQuality balances size and quality for photos
+const jpegQuality = 85
+
+// Process reads an upload and returns its renditions in the order of Sizes.
+// It returns a *RejectedError when the upload isn't an acceptable image.
+func Process(r io.Reader, limits Limits) ([]Variant, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limits.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limits.MaxBytes {
+		return nil, rejected("files must be at most %d MB", limits.MaxBytes>>20)
+	}
+
+	format, err := Detect(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the dimensions before decoding, so a small file can't make the
+	// server allocate a huge image
+	cfg, err := decodeConfig(format, data)
+	if err != nil {
+		return nil, rejected("the image could not be read")
+	}
+	if cfg.Width > limits.MaxSide || cfg.Height > limits.MaxSide {
+		return nil, rejected("images must be at most %d×%d pixels", limits.MaxSide, limits.MaxSide)
+	}
+
+	img, err := decode(format, data)
+	if err != nil {
+		return nil, rejected("the image could not be read")
+	}
+	if format == JPEG {
+		img = orient(img, jpegOrientation(data))
+	}
+
+	variants := make([]Variant, 0, len(Sizes))
+	for _, size := range Sizes {
+		v, err := encode(scale(img, size.MaxSide))
+		if err != nil {
+			return nil, err
+		}
+		v.Name = size.Name
+		variants = append(variants, v)
+	}
+	return variants, nil
+}
+
+// Detect names the format of an image from its first bytes. Formats outside
+// the allow-list are rejected.
+func Detect(data []byte) (Format, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return JPEG, nil
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return PNG, nil
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return GIF, nil
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return WebP, nil
+	case len(data) >= 12 && string(data[4:8]) == "ftyp" && isHEICBrand(string(data[8:12])):
+		return HEIC, nil
+	default:
+		return "", rejected("only JPEG, PNG, GIF, WebP and HEIC images can be uploaded")
+	}
+}
+
+// isHEICBrand reports whether brand is one of the HEIF brands of HEVC coded
+// images. AVIF, also HEIF, has its own brands and isn't accepted.
+func isHEICBrand(brand string) bool {
+	switch brand {
+	case "heic", "heix", "heim", "heis", "hevc", "hevx", "mif1", "msf1":
+		return true
+	}
+	return false
+}
+
+// decodeConfig reads the dimensions of an image. HEIC is decoded by name:
+// its decoder only registers itself for one of the brands.
+func decodeConfig(format Format, data []byte) (image.Config, error) {
+	if format == HEIC {
+		return heic.DecodeConfig(bytes.NewReader(data))
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	return cfg, err
+}
+
+func decode(format Format, data []byte) (image.Image, error) {
+	if format == HEIC {
+		return heic.Decode(bytes.NewReader(data))
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// scale shrinks img so its longest side is at most maxSide
+func scale(img image.Image, maxSide int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSide && h <= maxSide {
+		return img
+	}
+	if w >= h {
+		h = max(1, h*maxSide/w)
+		w = maxSide
+	} else {
+		w = max(1, w*maxSide/h)
+		h = maxSide
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// encode writes opaque images as JPEG and those with transparency as PNG
+func encode(img image.Image) (Variant, error) {
+	var buf bytes.Buffer
+	v := Variant{Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+	if opaque(img) {
+		v.ContentType = "image/jpeg"
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return Variant{}, err
+		}
+	} else {
+		v.ContentType = "image/png"
+		if err := png.Encode(&buf, img); err != nil {
+			return Variant{}, err
+		}
+	}
+	v.Data = buf.Bytes()
+	return v, nil
+}
+
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
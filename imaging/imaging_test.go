@@ -0,0 +1,128 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"testing"
+)
+
+var limits = Limits{MaxBytes: 10 << 20, MaxSide: 8000}
+
+func testJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 0, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withExif inserts an APP1 Exif segment holding orientation and a marker
+// standing in for GPS data after the JPEG's start of image
+func withExif(data []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1) // one IFD entry
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3) // SHORT
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	tiff = append(tiff, "GPS 52.52N 13.40E"...)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, app1...)
+	return append(out, data[2:]...)
+}
+
+func TestProcessRendersSizesUprightWithoutMetadata(t *testing.T) {
+	// A 3000×1000 photo taken with the camera turned, to be shown 1000×3000
+	data := withExif(testJPEG(t, 3000, 1000), 6)
+
+	variants, err := Process(bytes.NewReader(data), limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][2]int{"thumbnail": {106, 320}, "medium": {341, 1024}, "full": {682, 2048}}
+	for _, v := range variants {
+		if size := want[v.Name]; v.Width != size[0] || v.Height != size[1] {
+			t.Errorf("%s = %d×%d, want %d×%d", v.Name, v.Width, v.Height, size[0], size[1])
+		}
+		if v.ContentType != "image/jpeg" {
+			t.Errorf("%s content type = %s", v.Name, v.ContentType)
+		}
+		if bytes.Contains(v.Data, []byte("Exif")) || bytes.Contains(v.Data, []byte("GPS")) {
+			t.Errorf("%s kept the EXIF metadata", v.Name)
+		}
+	}
+	if len(variants) != len(Sizes) {
+		t.Errorf("got %d variants, want %d", len(variants), len(Sizes))
+	}
+}
+
+func TestProcessDoesNotUpscale(t *testing.T) {
+	variants, err := Process(bytes.NewReader(testJPEG(t, 200, 100)), limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range variants {
+		if v.Width != 200 || v.Height != 100 {
+			t.Errorf("%s = %d×%d, want 200×100", v.Name, v.Width, v.Height)
+		}
+	}
+}
+
+func TestProcessConvertsHEIC(t *testing.T) {
+	data, err := os.ReadFile("testdata/photo.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	variants, err := Process(bytes.NewReader(data), limits)
+	if err != nil {
+		t.Fatalf("Process() = %v", err)
+	}
+	for _, v := range variants {
+		if v.ContentType != "image/jpeg" || v.Width == 0 || v.Height == 0 {
+			t.Errorf("%s = %s %d×%d, want a JPEG", v.Name, v.ContentType, v.Width, v.Height)
+		}
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	heic := append([]byte("\x00\x00\x00\x18ftypheic"), make([]byte, 64)...)
+	avif := append([]byte("\x00\x00\x00\x18ftypavif"), make([]byte, 64)...)
+	tests := []struct {
+		name   string
+		data   []byte
+		limits Limits
+	}{
+		{"not an image", []byte("%PDF-1.7 pretending to be a photo"), limits},
+		{"truncated HEIC", heic, limits},
+		{"AVIF", avif, limits},
+		{"truncated", testJPEG(t, 50, 50)[:100], limits},
+		{"too many bytes", testJPEG(t, 50, 50), Limits{MaxBytes: 100, MaxSide: 8000}},
+		{"too many pixels", testJPEG(t, 300, 20), Limits{MaxBytes: 10 << 20, MaxSide: 200}},
+	}
+	for _, tt := range tests {
+		_, err := Process(bytes.NewReader(tt.data), tt.limits)
+		var rejected *RejectedError
+		if !errors.As(err, &rejected) {
+			t.Errorf("%s: Process() = %v, want a RejectedError", tt.name, err)
+		}
+	}
+}
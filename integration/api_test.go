@@ -0,0 +1,195 @@
+package integration
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"example.com/models"
+)
+
+// tomorrow is a bookable date regardless of the time of day the tests run
+func tomorrow() string {
+	return time.Now().UTC().AddDate(0, 0, 1).Format("2006-01-02")
+}
+
+func expectSchedule(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("schedule = %v, want %v", got, want)
+	}
+}
+
+func TestSignupAndLogin(t *testing.T) {
+	h := newHarness(t)
+	p := h.signup("provider@example.com")
+	if p.Token == "" || p.Alias == "" {
+		t.Fatalf("signup returned %+v", p)
+	}
+
+	credentials := map[string]string{"email": "provider@example.com", "password": "correct horse"}
+	if code := h.do(http.MethodPost, "/auth/signup", "", credentials).expect(http.StatusConflict).problem().Code; code != "email_taken" {
+		t.Errorf("duplicate signup code = %q, want email_taken", code)
+	}
+
+	credentials["password"] = "wrong"
+	if code := h.do(http.MethodPost, "/auth/login", "", credentials).expect(http.StatusUnauthorized).problem().Code; code != "invalid_credentials" {
+		t.Errorf("bad login code = %q, want invalid_credentials", code)
+	}
+
+	h.do(http.MethodGet, "/alias", "", nil).expect(http.StatusUnauthorized)
+}
+
+func TestSaveSchedule(t *testing.T) {
+	h := newHarness(t)
+	p := h.signup("provider@example.com")
+	date := tomorrow()
+
+	h.saveSchedule(p, date, "13:00-17:00", "09:00-12:00")
+	expectSchedule(t, h.schedule(p, date), "09:00-12:00", "13:00-17:00")
+
+	// Saving replaces the whole day
+	h.saveSchedule(p, date, "10:00-11:00")
+	expectSchedule(t, h.schedule(p, date), "10:00-11:00")
+
+	overlapping := []models.TimeRangePayload{{Start: "09:00", End: "12:00"}, {Start: "11:00", End: "13:00"}}
+	if code := h.do(http.MethodPost, "/schedule/me/"+date, p.Token, overlapping).expect(http.StatusBadRequest).problem().Code; code != "invalid_schedule" {
+		t.Errorf("overlapping ranges code = %q, want invalid_schedule", code)
+	}
+	expectSchedule(t, h.schedule(p, date), "10:00-11:00")
+}
+
+func TestBookingSplitsTheSchedule(t *testing.T) {
+	tests := []struct {
+		name      string
+		startTime string
+		want      []string
+	}{
+		{"middle", "12:00", []string{"09:00-12:00", "13:00-17:00"}},
+		{"start", "09:00", []string{"10:00-17:00"}},
+		{"end", "16:00", []string{"09:00-16:00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHarness(t)
+			p := h.signup("provider@example.com")
+			service := h.createService(p, "Cut", 60)
+			date := tomorrow()
+			h.saveSchedule(p, date, "09:00-17:00")
+
+			var result struct {
+				Appointment models.Appointment `json:"appointment"`
+			}
+			h.book(p, service, date, tt.startTime).expect(http.StatusCreated).data(&result)
+			if result.Appointment.StartTime != tt.startTime || result.Appointment.CancelToken == "" {
+				t.Errorf("booked %+v", result.Appointment)
+			}
+			expectSchedule(t, h.schedule(p, date), tt.want...)
+		})
+	}
+}
+
+func TestBookingUnavailableSlots(t *testing.T) {
+	h := newHarness(t)
+	p := h.signup("provider@example.com")
+	service := h.createService(p, "Cut", 60)
+	date := tomorrow()
+	h.saveSchedule(p, date, "09:00-12:00", "13:00-15:00")
+
+	h.book(p, service, date, "10:00").expect(http.StatusCreated)
+
+	for _, startTime := range []string{
+		"10:00", // already booked
+		"09:30", // overlaps the booking
+		"11:30", // runs into the lunch break
+		"14:30", // runs past the end of the day
+	} {
+		if code := h.book(p, service, date, startTime).expect(http.StatusConflict).problem().Code; code != "slot_unavailable" {
+			t.Errorf("booking %s code = %q, want slot_unavailable", startTime, code)
+		}
+	}
+	expectSchedule(t, h.schedule(p, date), "09:00-10:00", "11:00-12:00", "13:00-15:00")
+}
+
+func TestCancellationMergesTheSlot(t *testing.T) {
+	h := newHarness(t)
+	p := h.signup("provider@example.com")
+	service := h.createService(p, "Cut", 60)
+	date := tomorrow()
+	h.saveSchedule(p, date, "09:00-17:00")
+
+	var first, second struct {
+		Appointment models.Appointment `json:"appointment"`
+	}
+	h.book(p, service, date, "10:00").expect(http.StatusCreated).data(&first)
+	h.book(p, service, date, "11:00").expect(http.StatusCreated).data(&second)
+	expectSchedule(t, h.schedule(p, date), "09:00-10:00", "12:00-17:00")
+
+	// Freeing the first slot merges it with the free time before it only
+	h.do(http.MethodDelete, "/appointments/"+first.Appointment.ID, p.Token, nil).expect(http.StatusNoContent)
+	expectSchedule(t, h.schedule(p, date), "09:00-11:00", "12:00-17:00")
+
+	// Freeing the second joins both sides back into one range
+	h.do(http.MethodDelete, "/appointments/"+second.Appointment.ID, p.Token, nil).expect(http.StatusNoContent)
+	expectSchedule(t, h.schedule(p, date), "09:00-17:00")
+
+	h.do(http.MethodDelete, "/appointments/"+second.Appointment.ID, p.Token, nil).expect(http.StatusNotFound)
+}
+
+func TestClientCancellation(t *testing.T) {
+	h := newHarness(t)
+	p := h.signup("provider@example.com")
+	service := h.createService(p, "Cut", 60)
+	date := tomorrow()
+	h.saveSchedule(p, date, "09:00-12:00")
+
+	var result struct {
+		Appointment models.Appointment `json:"appointment"`
+	}
+	h.book(p, service, date, "09:00").expect(http.StatusCreated).data(&result)
+	cancel := "/appointments/" + p.Alias + "/" + result.Appointment.ID + "/cancel"
+
+	h.do(http.MethodPost, cancel, "", map[string]string{"token": "not-the-token"}).expect(http.StatusNotFound)
+	expectSchedule(t, h.schedule(p, date), "10:00-12:00")
+
+	var cancelled struct {
+		Refunded bool `json:"refunded"`
+	}
+	h.do(http.MethodPost, cancel, "", map[string]string{"token": result.Appointment.CancelToken}).expect(http.StatusOK).data(&cancelled)
+	if cancelled.Refunded {
+		t.Error("refunded without a deposit")
+	}
+	expectSchedule(t, h.schedule(p, date), "09:00-12:00")
+}
+
+func TestAppointmentsAreScopedToTheProvider(t *testing.T) {
+	h := newHarness(t)
+	owner := h.signup("owner@example.com")
+	other := h.signup("other@example.com")
+	service := h.createService(owner, "Cut", 60)
+	date := tomorrow()
+	h.saveSchedule(owner, date, "09:00-12:00")
+
+	var result struct {
+		Appointment models.Appointment `json:"appointment"`
+	}
+	h.book(owner, service, date, "09:00").expect(http.StatusCreated).data(&result)
+
+	// Another provider's service can't be booked through this alias
+	if code := h.book(other, service, date, "09:00").expect(http.StatusBadRequest).problem().Code; code != "invalid_selection" {
+		t.Errorf("foreign service code = %q, want invalid_selection", code)
+	}
+
+	var appointments []models.Appointment
+	h.do(http.MethodGet, "/appointments", other.Token, nil).expect(http.StatusOK).data(&appointments)
+	if len(appointments) != 0 {
+		t.Errorf("other provider sees %d appointments", len(appointments))
+	}
+	h.do(http.MethodDelete, "/appointments/"+result.Appointment.ID, other.Token, nil).expect(http.StatusNotFound)
+
+	h.do(http.MethodGet, "/appointments", owner.Token, nil).expect(http.StatusOK).data(&appointments)
+	if len(appointments) != 1 || appointments[0].ID != result.Appointment.ID {
+		t.Errorf("owner sees %+v", appointments)
+	}
+}
@@ -0,0 +1,40 @@
+package integration
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"example.com/models"
+)
+
+func TestConcurrentBookingsShareOneClient(t *testing.T) {
+	h := newHarness(t)
+	p := h.signup("provider@example.com")
+	service := h.createService(p, "Cut", 60)
+	date := tomorrow()
+	h.saveSchedule(p, date, "09:00-17:00")
+
+	starts := []string{"09:00", "10:00", "11:00", "12:00", "13:00", "14:00", "15:00", "16:00"}
+	codes := make([]int, len(starts))
+	var wg sync.WaitGroup
+	for i, start := range starts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = h.book(p, service, date, start).Code
+		}()
+	}
+	wg.Wait()
+	for i, code := range codes {
+		if code != http.StatusCreated {
+			t.Errorf("booking at %s = %d, want 201", starts[i], code)
+		}
+	}
+
+	var clients []models.ClientSummary
+	h.do(http.MethodGet, "/clients", p.Token, nil).expect(http.StatusOK).data(&clients)
+	if len(clients) != 1 {
+		t.Errorf("%d clients for one person's bookings, want 1", len(clients))
+	}
+}
@@ -0,0 +1,323 @@
+// Package integration runs HTTP-level tests against the real routes and a
+// throwaway Postgres. The server binaries (initdb, pg_ctl) must be on PATH or
+// under /usr/lib/postgresql; without them, or when running as root, the tests
+// are skipped.
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"example.com/db"
+	"example.com/middlewares"
+	"example.com/models"
+	"example.com/routes"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	postgresOnce sync.Once
+	postgresErr  error
+	postgresDir  string
+	pgCtl        string
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	stopPostgres()
+	os.Exit(code)
+}
+
+// findPostgresBinary looks for a Postgres server binary on PATH, then in the
+// versioned directories Debian and Ubuntu install to
+func findPostgresBinary(name string) (string, error) {
+	if path, err := exec.LookPath(name); err == nil {
+		return path, nil
+	}
+	matches, _ := filepath.Glob(filepath.Join("/usr/lib/postgresql", "*", "bin", name))
+	if len(matches) == 0 {
+		return "", fmt.Errorf("%s not found on PATH or under /usr/lib/postgresql", name)
+	}
+	sort.Strings(matches)
+	return matches[len(matches)-1], nil
+}
+
+// startPostgres initialises a cluster in a temporary directory, starts it on
+// a free port and creates the schema through db.InitDB
+func startPostgres() error {
+	if os.Geteuid() == 0 {
+		return errors.New("postgres refuses to run as root")
+	}
+	initdb, err := findPostgresBinary("initdb")
+	if err != nil {
+		return err
+	}
+	if pgCtl, err = findPostgresBinary("pg_ctl"); err != nil {
+		return err
+	}
+
+	postgresDir, err = os.MkdirTemp("", "booking-postgres-")
+	if err != nil {
+		return err
+	}
+	data := filepath.Join(postgresDir, "data")
+	out, err := exec.Command(initdb, "-D", data, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-sync").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("initdb: %v: %s", err, out)
+	}
+
+	port, err := freePort()
+	if err != nil {
+		return err
+	}
+	options := fmt.Sprintf("-p %d -k %s -c listen_addresses=127.0.0.1 -c fsync=off", port, postgresDir)
+	out, err = exec.Command(pgCtl, "-D", data, "-o", options, "-l", filepath.Join(postgresDir, "postgres.log"), "-w", "start").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("pg_ctl start: %v: %s", err, out)
+	}
+
+	db.Open(fmt.Sprintf("postgres://postgres@127.0.0.1:%d/postgres?sslmode=disable", port))
+	return initSchema()
+}
+
+func initSchema() error {
+	if err := db.InitDB(context.Background()); err != nil {
+		return fmt.Errorf("init database: %w", err)
+	}
+	return nil
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func stopPostgres() {
+	if postgresDir == "" {
+		return
+	}
+	if db.DB != nil {
+		db.DB.Close()
+	}
+	exec.Command(pgCtl, "-D", filepath.Join(postgresDir, "data"), "-m", "immediate", "stop").Run()
+	os.RemoveAll(postgresDir)
+}
+
+// harness serves the API from the test database, emptied for each test
+type harness struct {
+	t      *testing.T
+	server *gin.Engine
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	postgresOnce.Do(func() { postgresErr = startPostgres() })
+	if postgresErr != nil {
+		t.Skipf("integration tests need a local Postgres: %v", postgresErr)
+	}
+	truncateTables(t)
+
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	server.Use(middlewares.ErrorHandler())
+	routes.RegisterRoutes(server, routes.NewHandlers(models.NewPostgresRepositories(db.DB), nil))
+	return &harness{t: t, server: server}
+}
+
+func truncateTables(t *testing.T) {
+	t.Helper()
+	rows, err := db.DB.Query(`SELECT tablename FROM pg_tables WHERE schemaname = 'public'`)
+	if err != nil {
+		t.Fatalf("list tables: %v", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatalf("list tables: %v", err)
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+
+	if _, err := db.DB.Exec(`TRUNCATE ` + strings.Join(tables, ", ") + ` RESTART IDENTITY CASCADE`); err != nil {
+		t.Fatalf("truncate tables: %v", err)
+	}
+}
+
+// response is a recorded API response
+type response struct {
+	t    *testing.T
+	Code int
+	Body []byte
+}
+
+// data decodes the data of a v1 envelope into out
+func (r *response) data(out any) {
+	r.t.Helper()
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(r.Body, &envelope); err != nil {
+		r.t.Fatalf("decode %s: %v", r.Body, err)
+	}
+	if err := json.Unmarshal(envelope.Data, out); err != nil {
+		r.t.Fatalf("decode data %s: %v", envelope.Data, err)
+	}
+}
+
+// problem decodes a problem+json error body
+func (r *response) problem() middlewares.Problem {
+	r.t.Helper()
+	var p middlewares.Problem
+	if err := json.Unmarshal(r.Body, &p); err != nil {
+		r.t.Fatalf("decode problem %s: %v", r.Body, err)
+	}
+	return p
+}
+
+// expect fails the test unless the response has the given status
+func (r *response) expect(status int) *response {
+	r.t.Helper()
+	if r.Code != status {
+		r.t.Fatalf("status = %d, want %d: %s", r.Code, status, r.Body)
+	}
+	return r
+}
+
+// do sends a request to /api/v1+path. A non-empty token is sent as the
+// Authorization header; body is encoded as JSON unless it is an io.Reader.
+func (h *harness) do(method, path, token string, body any) *response {
+	h.t.Helper()
+	var reader io.Reader
+	contentType := "application/json"
+	switch b := body.(type) {
+	case nil:
+	case multipartBody:
+		reader, contentType = b.reader, b.contentType
+	default:
+		raw, err := json.Marshal(b)
+		if err != nil {
+			h.t.Fatalf("encode body: %v", err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+
+	req := httptest.NewRequest(method, "/api/v1"+path, reader)
+	if reader != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	w := httptest.NewRecorder()
+	h.server.ServeHTTP(w, req)
+	return &response{t: h.t, Code: w.Code, Body: w.Body.Bytes()}
+}
+
+type multipartBody struct {
+	reader      io.Reader
+	contentType string
+}
+
+// form encodes fields as a multipart form, as the service endpoints expect
+func form(fields map[string]string) multipartBody {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for name, value := range fields {
+		w.WriteField(name, value)
+	}
+	w.Close()
+	return multipartBody{reader: &buf, contentType: w.FormDataContentType()}
+}
+
+// provider is a signed-up user with their access token and booking alias
+type provider struct {
+	Token string
+	Alias string
+}
+
+// signup creates a provider and logs them in
+func (h *harness) signup(email string) provider {
+	h.t.Helper()
+	credentials := map[string]string{"email": email, "password": "correct horse"}
+	h.do(http.MethodPost, "/auth/signup", "", credentials).expect(http.StatusNoContent)
+
+	var tokens struct {
+		AccessToken string `json:"accessToken"`
+	}
+	h.do(http.MethodPost, "/auth/login", "", credentials).expect(http.StatusOK).data(&tokens)
+
+	var alias struct {
+		Alias string `json:"alias"`
+	}
+	h.do(http.MethodGet, "/alias", tokens.AccessToken, nil).expect(http.StatusOK).data(&alias)
+	return provider{Token: tokens.AccessToken, Alias: alias.Alias}
+}
+
+// createService adds a service with the given duration in minutes
+func (h *harness) createService(p provider, name string, duration int) int64 {
+	h.t.Helper()
+	var service models.Service
+	h.do(http.MethodPost, "/services", p.Token, form(map[string]string{
+		"name": name, "price": "40.00", "currency": "EUR", "duration": fmt.Sprint(duration),
+	})).expect(http.StatusCreated).data(&service)
+	return service.ID
+}
+
+// saveSchedule replaces a day of the provider's schedule with ranges given
+// as "HH:MM-HH:MM"
+func (h *harness) saveSchedule(p provider, date string, ranges ...string) {
+	h.t.Helper()
+	payload := []models.TimeRangePayload{}
+	for _, r := range ranges {
+		start, end, _ := strings.Cut(r, "-")
+		payload = append(payload, models.TimeRangePayload{Start: start, End: end})
+	}
+	h.do(http.MethodPost, "/schedule/me/"+date, p.Token, payload).expect(http.StatusOK)
+}
+
+// schedule returns a day of the provider's schedule as "HH:MM-HH:MM" ranges
+func (h *harness) schedule(p provider, date string) []string {
+	h.t.Helper()
+	var ranges []models.TimeRange
+	h.do(http.MethodGet, "/schedule/me/"+date, p.Token, nil).expect(http.StatusOK).data(&ranges)
+	out := []string{}
+	for _, r := range ranges {
+		out = append(out, r.StartTime+"-"+r.EndTime)
+	}
+	return out
+}
+
+// book sends a client booking for the service at date and startTime
+func (h *harness) book(p provider, serviceID int64, date, startTime string) *response {
+	h.t.Helper()
+	return h.do(http.MethodPost, "/appointments/"+p.Alias, "", map[string]any{
+		"serviceId": serviceID,
+		"date":      date,
+		"startTime": startTime,
+		"firstName": "Ada",
+		"lastName":  "Lovelace",
+		"email":     "ada@example.com",
+		"phone":     "+14155550123",
+	})
+}
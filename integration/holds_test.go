@@ -0,0 +1,44 @@
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"example.com/models"
+)
+
+func TestConcurrentHoldsStayUnderTheCap(t *testing.T) {
+	h := newHarness(t)
+	p := h.signup("provider@example.com")
+	service := h.createService(p, "Cut", 30)
+	date := tomorrow()
+	h.saveSchedule(p, date, "09:00-17:00")
+
+	// Every request comes from the same test address
+	codes := make([]int, 10)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = h.do(http.MethodPost, "/holds/"+p.Alias, "", map[string]any{
+				"serviceId": service,
+				"date":      date,
+				"startTime": fmt.Sprintf("%02d:%02d", 9+i/2, i%2*30),
+			}).Code
+		}()
+	}
+	wg.Wait()
+
+	held := 0
+	for _, code := range codes {
+		if code == http.StatusCreated {
+			held++
+		}
+	}
+	if held != models.MaxHoldsPerIP {
+		t.Errorf("%d concurrent holds succeeded, want the cap of %d (codes %v)", held, models.MaxHoldsPerIP, codes)
+	}
+}
@@ -0,0 +1,97 @@
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"example.com/db"
+)
+
+func TestLegacyPricesAreMigrated(t *testing.T) {
+	h := newHarness(t)
+	h.signup("legacy@example.com")
+
+	// Services saved before prices had minor units and ISO currencies
+	_, err := db.DB.Exec(`
+		INSERT INTO services (name, price, currency, duration, user_id)
+		SELECT v.name, v.price, v.currency, 30, u.id
+		FROM users u, (VALUES ('Cut', 25, 'eur'), ('Massage', 3000, 'JPY'), ('Nails', 12, '€'),
+		                      ('Colour', 60, 'dinars'), ('Brows', 8, NULL)) AS v(name, price, currency)
+	`)
+	if err != nil {
+		t.Fatalf("insert legacy services: %v", err)
+	}
+	if err := db.InitDB(context.Background()); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+
+	want := map[string]struct {
+		minor    int64
+		currency string
+	}{
+		"Cut":     {2500, "EUR"},
+		"Massage": {3000, "JPY"},
+		"Nails":   {1200, "EUR"},
+		"Colour":  {6000, "EUR"},
+		"Brows":   {800, "EUR"},
+	}
+	rows, err := db.DB.Query(`SELECT name, price_minor, currency FROM services`)
+	if err != nil {
+		t.Fatalf("list services: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, currency string
+		var minor int64
+		if err := rows.Scan(&name, &minor, &currency); err != nil {
+			t.Fatalf("scan service: %v", err)
+		}
+		if w := want[name]; minor != w.minor || currency != w.currency {
+			t.Errorf("%s = %d %s, want %d %s", name, minor, currency, w.minor, w.currency)
+		}
+	}
+}
+
+func TestAppointmentOptionsMoveToItems(t *testing.T) {
+	h := newHarness(t)
+	h.signup("options@example.com")
+
+	// An appointment booked while the chosen options were stored on appointments
+	_, err := db.DB.Exec(`
+		ALTER TABLE appointments ADD COLUMN variant_id BIGINT, ADD COLUMN options JSONB;
+		INSERT INTO services (name, price_minor, currency, duration, user_id) SELECT 'Nails', 2000, 'EUR', 30, id FROM users;
+		INSERT INTO service_variants (service_id, name, price_minor, duration) SELECT id, 'Gel', 2500, 45 FROM services;
+		INSERT INTO appointments (user_id, service_id, date, start_time, end_time, first_name, last_name, email, phone, variant_id, options)
+		SELECT s.user_id, s.id, '2030-01-02', '10:00', '10:45', 'Ann', 'Lee', 'ann@example.com', '+14155550100', v.id,
+		       jsonb_build_array(jsonb_build_object('kind', 'variant', 'id', v.id, 'name', 'Gel'))
+		FROM services s JOIN service_variants v ON v.service_id = s.id;
+	`)
+	if err != nil {
+		t.Fatalf("insert legacy appointment: %v", err)
+	}
+	if err := db.InitDB(context.Background()); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+
+	var variantID *int64
+	var options *string
+	err = db.DB.QueryRow(`SELECT variant_id, options::text FROM appointment_items`).Scan(&variantID, &options)
+	if err != nil {
+		t.Fatalf("read appointment item: %v", err)
+	}
+	if variantID == nil || options == nil {
+		t.Errorf("item variant = %v, options = %v, want the appointment's", variantID, options)
+	}
+
+	var columns int
+	err = db.DB.QueryRow(`
+		SELECT COUNT(*) FROM information_schema.columns
+		WHERE table_name = 'appointments' AND column_name IN ('variant_id', 'options')
+	`).Scan(&columns)
+	if err != nil {
+		t.Fatalf("list columns: %v", err)
+	}
+	if columns != 0 {
+		t.Errorf("appointments still has %d option columns", columns)
+	}
+}
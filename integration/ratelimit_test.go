@@ -0,0 +1,56 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/db"
+	"example.com/ratelimit"
+)
+
+func TestPostgresRateLimit(t *testing.T) {
+	newHarness(t)
+	store := ratelimit.NewPostgresStore(db.DB)
+	ctx := context.Background()
+	policy := ratelimit.Policy{Limit: 3, Period: time.Hour}
+
+	for i := 0; i < 3; i++ {
+		r, err := store.Take(ctx, "ip:203.0.113.7", policy)
+		if err != nil {
+			t.Fatalf("Take %d: %v", i+1, err)
+		}
+		if !r.Allowed || r.Remaining != 2-i {
+			t.Fatalf("Take %d = %+v, want allowed with %d remaining", i+1, r, 2-i)
+		}
+	}
+	r, err := store.Take(ctx, "ip:203.0.113.7", policy)
+	if err != nil {
+		t.Fatalf("Take 4: %v", err)
+	}
+	if r.Allowed || r.RetryAfter <= 0 {
+		t.Errorf("Take 4 = %+v, want denied with a Retry-After", r)
+	}
+
+	// Other keys have their own bucket
+	if r, err := store.Take(ctx, "ip:203.0.113.8", policy); err != nil || !r.Allowed {
+		t.Errorf("Take on another key = %+v, %v, want allowed", r, err)
+	}
+
+	// A bucket left alone refills
+	if _, err := db.DB.Exec(`UPDATE rate_limit_buckets SET updated_at = now() - interval '1 hour' WHERE key = $1`, "ip:203.0.113.7"); err != nil {
+		t.Fatalf("age bucket: %v", err)
+	}
+	r, err = store.Take(ctx, "ip:203.0.113.7", policy)
+	if err != nil {
+		t.Fatalf("Take after refill: %v", err)
+	}
+	if !r.Allowed || r.Remaining != 2 {
+		t.Errorf("Take after refill = %+v, want allowed with 2 remaining", r)
+	}
+
+	deleted, err := store.DeleteIdle(ctx)
+	if err != nil || deleted != 0 {
+		t.Errorf("DeleteIdle = %d, %v, want 0 recently used buckets deleted", deleted, err)
+	}
+}
@@ -0,0 +1,77 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"example.com/db"
+	"example.com/models"
+	"example.com/routes"
+)
+
+func TestWaitlistOffersPassDownTheLine(t *testing.T) {
+	h := newHarness(t)
+	p := h.signup("provider@example.com")
+	service := h.createService(p, "Cut", 60)
+	date := tomorrow()
+	h.saveSchedule(p, date, "09:00-10:00")
+
+	var booked struct {
+		Appointment models.Appointment `json:"appointment"`
+	}
+	h.book(p, service, date, "09:00").expect(http.StatusCreated).data(&booked)
+
+	var entries []models.WaitlistEntry
+	for _, email := range []string{"first@example.com", "second@example.com"} {
+		var entry models.WaitlistEntry
+		h.do(http.MethodPost, "/waitlist/"+p.Alias, "", map[string]any{
+			"serviceId": service, "dateFrom": date, "dateTo": date,
+			"firstName": "Wait", "lastName": "Listed", "email": email, "phone": "+14155550123",
+		}).expect(http.StatusCreated).data(&entry)
+		entries = append(entries, entry)
+	}
+
+	// The freed slot goes to the first in line only
+	h.do(http.MethodDelete, "/appointments/"+booked.Appointment.ID, p.Token, nil).expect(http.StatusNoContent)
+	routes.WaitForOffers()
+	offered := offeredEntries(t)
+	if len(offered) != 1 || offered[0] != entries[0].ID {
+		t.Fatalf("offered to %v, want only %s", offered, entries[0].ID)
+	}
+
+	// Once it lapses, it passes to the next
+	if _, err := db.DB.Exec(`UPDATE waitlist_entries SET offer_expires_at = NOW() AT TIME ZONE 'UTC' - interval '1 minute'`); err != nil {
+		t.Fatalf("expire offer: %v", err)
+	}
+	offers, err := models.NewPostgresRepositories(db.DB).Waitlist.OfferFreedSlots(context.Background())
+	if err != nil {
+		t.Fatalf("OfferFreedSlots: %v", err)
+	}
+	if len(offers) != 1 || offers[0].EntryID != entries[1].ID {
+		t.Fatalf("offers = %+v, want one to %s", offers, entries[1].ID)
+	}
+
+	h.do(http.MethodPost, "/waitlist/"+p.Alias+"/"+entries[1].ID+"/claim", "", map[string]string{
+		"token": offers[0].Token,
+	}).expect(http.StatusCreated)
+}
+
+// offeredEntries lists the entries holding an offer
+func offeredEntries(t *testing.T) []string {
+	t.Helper()
+	rows, err := db.DB.Query(`SELECT id FROM waitlist_entries WHERE offer_token IS NOT NULL`)
+	if err != nil {
+		t.Fatalf("list offers: %v", err)
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			t.Fatalf("list offers: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
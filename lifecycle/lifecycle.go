@@ -0,0 +1,136 @@
+// Package lifecycle runs the HTTP server and its background workers, tracks
+// whether the server is ready for traffic and shuts everything down in order
+// on SIGINT or SIGTERM.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"example.com/logging"
+)
+
+// Manager owns the server's lifecycle. Workers started with Go receive a
+// context that is cancelled once the HTTP server has drained.
+type Manager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	ready   atomic.Bool
+	workers sync.WaitGroup
+
+	mu      sync.Mutex
+	failed  chan struct{}
+	err     error
+	closers []func() error
+}
+
+func New() *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{ctx: ctx, cancel: cancel, failed: make(chan struct{})}
+}
+
+// Ready reports whether the server should receive traffic: startup finished
+// and shutdown hasn't begun
+func (m *Manager) Ready() bool {
+	return m.ready.Load()
+}
+
+// SetReady marks startup as finished
+func (m *Manager) SetReady() {
+	m.ready.Store(true)
+}
+
+// Go runs fn in the background. fn must return soon after ctx is cancelled;
+// shutdown waits for it.
+func (m *Manager) Go(fn func(ctx context.Context)) {
+	m.workers.Add(1)
+	go func() {
+		defer m.workers.Done()
+		fn(m.ctx)
+	}()
+}
+
+// OnShutdown registers fn to run after the server and workers have stopped,
+// in reverse order of registration
+func (m *Manager) OnShutdown(fn func() error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closers = append(m.closers, fn)
+}
+
+// Fail shuts the server down because something it can't run without failed.
+// Serve returns err.
+func (m *Manager) Fail(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err == nil {
+		m.err = err
+		close(m.failed)
+	}
+}
+
+// Serve runs srv until a shutdown signal arrives or Fail is called, then
+// stops taking traffic, waits up to timeout for requests in flight and
+// workers to finish and runs the OnShutdown functions
+func (m *Manager) Serve(srv *http.Server, timeout time.Duration) error {
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+	logging.Logger.Infof("Listening on %s", srv.Addr)
+
+	select {
+	case <-signals.Done():
+		logging.Logger.Info("Shutting down")
+	case <-m.failed:
+		logging.Logger.WithError(m.err).Error("Shutting down")
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			m.Fail(err)
+		}
+	}
+	m.ready.Store(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		logging.Logger.WithError(err).Warn("HTTP server didn't drain")
+	}
+
+	m.cancel()
+	done := make(chan struct{})
+	go func() {
+		m.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		logging.Logger.Warn("Background workers didn't stop in time")
+	}
+
+	m.mu.Lock()
+	closers := m.closers
+	m.mu.Unlock()
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i](); err != nil {
+			logging.Logger.WithError(err).Error("Shutdown step failed")
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
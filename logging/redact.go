@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const redacted = "[redacted]"
+
+// sensitiveKeys are fields whose whole value is withheld. Keys are compared
+// lower-cased.
+var sensitiveKeys = map[string]bool{
+	"email":         true,
+	"phone":         true,
+	"password":      true,
+	"token":         true,
+	"accesstoken":   true,
+	"refreshtoken":  true,
+	"canceltoken":   true,
+	"authorization": true,
+	"secret":        true,
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	// Phones are stored in E.164, but clients may type them with separators
+	phonePattern = regexp.MustCompile(`\+\d[\d\s().-]{5,18}\d`)
+	jwtPattern   = regexp.MustCompile(`eyJ[\w-]+\.[\w-]+\.[\w-]+`)
+	// Secrets passed in query strings or bodies, such as ?token= or code=
+	paramPattern  = regexp.MustCompile(`(?i)\b(token|access_token|refresh_token|id_token|code|password|secret)=[^&\s"]+`)
+	bearerPattern = regexp.MustCompile(`(?i)\bbearer\s+\S+`)
+)
+
+// Redact masks emails, phone numbers and tokens in s
+func Redact(s string) string {
+	s = jwtPattern.ReplaceAllString(s, redacted)
+	s = paramPattern.ReplaceAllString(s, "$1="+redacted)
+	s = bearerPattern.ReplaceAllString(s, "Bearer "+redacted)
+	s = emailPattern.ReplaceAllString(s, redacted)
+	return phonePattern.ReplaceAllString(s, redacted)
+}
+
+// redactHook scrubs the message and fields of every entry before it's
+// written. Hooks run on a copy of the entry, so callers' fields are untouched.
+type redactHook struct{}
+
+func (redactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (redactHook) Fire(entry *logrus.Entry) error {
+	entry.Message = Redact(entry.Message)
+	for key, value := range entry.Data {
+		if sensitiveKeys[strings.ToLower(key)] {
+			entry.Data[key] = redacted
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = Redact(v)
+		case error:
+			entry.Data[key] = Redact(v.Error())
+		}
+	}
+	return nil
+}
@@ -1,47 +1,271 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"log"
+	"net/http"
 	"time"
 
+	"example.com/captcha"
+	"example.com/cloud"
 	"example.com/config"
 	"example.com/db"
+	"example.com/lifecycle"
+	"example.com/logging"
+	"example.com/metrics"
 	"example.com/middlewares"
+	"example.com/models"
+	"example.com/notify"
+	"example.com/payments"
+	"example.com/ratelimit"
 	"example.com/routes"
+	"example.com/storage"
+	"example.com/tracing"
+	"example.com/utils"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
+	_ "time/tzdata" // TIME_ZONE must load in images without zoneinfo
 )
 
 func main() {
-	err := godotenv.Load()
+	cfg, err := config.Load()
 	if err != nil {
-		log.Println("No .env file found or error loading .env file")
+		log.Fatal(err)
 	}
+	if cfg.Production() {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	// Initialize OAuth configuration and token signing
+	config.InitOAuth(cfg)
+	utils.SetSecretKey(cfg.JWTSecret)
+
+	// Initialize logging and tracing
+	if err := logging.Init(cfg.Log.Level, cfg.Log.Format); err != nil {
+		log.Fatal(err)
+	}
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		logging.Logger.WithError(err).Fatal("Could not start tracing")
+	}
+
+	// Read client dates, times and phone numbers where the business is
+	models.Init(cfg.Locale)
+
+	// Initialize media storage
+	if err := storage.Init(cfg.Storage); err != nil {
+		logging.Logger.WithError(err).Fatal("Could not initialize media storage")
+	}
+	cloud.Init(cfg.Media)
+
+	// Initialize payment gateway (disabled unless PAYMENT_GATEWAY is set)
+	payments.Init(cfg.Payments)
+
+	// Initialize client notifications (logged unless NOTIFIER is set)
+	notify.Init(cfg.Notifier)
 
-	// Initialize OAuth configuration
-	config.InitOAuth()
+	// Initialize bot protection for public bookings (heuristics only unless
+	// CAPTCHA_PROVIDER is set)
+	captcha.Init(cfg.Captcha)
 
-	// Initialize logging
-	middlewares.Init()
+	manager := lifecycle.New()
+	manager.OnShutdown(func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return shutdownTracing(ctx)
+	})
 
-	// Initialize database in background
-	go db.InitDB()
+	// Connect to the database and create tables in background. Requests get
+	// 503 until this finishes; the server shuts down if it can't.
+	database := db.Open(cfg.Database.URL)
+	repos := models.NewPostgresRepositories(database)
+	metrics.RegisterDB(database)
+	manager.OnShutdown(db.Close)
+	manager.Go(func(ctx context.Context) {
+		if err := db.InitDB(ctx); err != nil {
+			if ctx.Err() == nil {
+				manager.Fail(err)
+			}
+			return
+		}
+		manager.SetReady()
+	})
 
-	server := gin.Default()
+	// Release expired checkout holds and unpaid deposit holds
+	manager.Go(func(ctx context.Context) {
+		runSweepers(ctx, repos, 30*time.Second)
+	})
+	manager.OnShutdown(func() error {
+		routes.WaitForOffers()
+		return nil
+	})
+
+	// Throttle public and auth endpoints
+	limiter, buckets := newRateLimiter(cfg.RateLimit, database)
+	if buckets != nil {
+		manager.Go(func(ctx context.Context) {
+			runRateLimitCleanup(ctx, buckets, time.Hour)
+		})
+	}
+
+	server := gin.New()
+	// Only believe the client address headers of the platform or proxies
+	// in front of us, so rate limits and blocklists can't be dodged
+	server.TrustedPlatform = cfg.Proxy.TrustedPlatform
+	if err := server.SetTrustedProxies(cfg.Proxy.TrustedProxies); err != nil {
+		logging.Logger.WithError(err).Fatal("Invalid trusted proxies")
+	}
+	server.Use(middlewares.RequestID())
 
 	server.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:5173", "http://localhost:8081", "http://localhost:8082", "https://glowbook-booking.vercel.app"},
+		AllowOrigins:     cfg.CORSOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", middlewares.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", middlewares.RequestIDHeader, "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
+	server.Use(tracing.Middleware(cfg.Tracing.ServiceName))
+	server.Use(metrics.Middleware())
 	server.Use(middlewares.RequestLogger())
 	server.Use(middlewares.RecoveryLogger())
+	server.Use(middlewares.ErrorHandler())
+	server.Use(middlewares.RequireReady(manager.Ready, "/health", "/metrics", "/api/openapi.json", "/api/docs"))
+
+	// Media kept on local disk is served from here
+	if local, ok := storage.Default.(*storage.Local); ok {
+		server.StaticFS("/media", gin.Dir(local.Dir(), false))
+	}
+
+	routes.RegisterRoutes(server, routes.NewHandlers(repos, limiter))
 
-	routes.RegisterRoutes(server)
+	// Metrics are kept off the public port when METRICS_ADDR is set
+	metricsHandler := metrics.Handler(cfg.Metrics.Token)
+	if cfg.Metrics.Addr == "" {
+		server.GET("/metrics", gin.WrapH(metricsHandler))
+	} else {
+		manager.Go(func(ctx context.Context) {
+			serveMetrics(ctx, manager, cfg.Metrics.Addr, metricsHandler)
+		})
+	}
 
-	server.Run(":8080")
+	srv := &http.Server{Addr: cfg.Addr(), Handler: server}
+	if err := manager.Serve(srv, cfg.ShutdownTimeout); err != nil {
+		logging.Logger.WithError(err).Fatal("Server stopped")
+	}
+}
+
+// serveMetrics serves /metrics on its own listener at addr until ctx is
+// cancelled. The server can't run unobserved, so failing to listen stops it.
+func serveMetrics(ctx context.Context, manager *lifecycle.Manager, addr string, handler http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", handler)
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+	logging.Logger.Infof("Serving metrics on %s", addr)
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logging.Logger.WithError(err).Warn("Metrics server didn't drain")
+		}
+	case err := <-serveErr:
+		manager.Fail(fmt.Errorf("metrics server: %w", err))
+	}
+}
+
+// newRateLimiter builds the limiter RATE_LIMIT_BACKEND asks for. The
+// Postgres store is returned too so its idle buckets can be cleaned up.
+func newRateLimiter(cfg config.RateLimitConfig, database *sql.DB) (*ratelimit.Limiter, *ratelimit.PostgresStore) {
+	policies := map[string]ratelimit.Policy{}
+	for name, policy := range cfg.Policies {
+		policies[name] = ratelimit.Policy{Limit: policy.Limit, Period: policy.Period}
+	}
+	switch cfg.Backend {
+	case "postgres":
+		store := ratelimit.NewPostgresStore(database)
+		return ratelimit.New(store, policies), store
+	case "memory":
+		return ratelimit.New(ratelimit.NewMemoryStore(), policies), nil
+	default:
+		return nil, nil
+	}
+}
+
+// runRateLimitCleanup periodically deletes rate limit buckets nobody has
+// used for a while, until ctx is cancelled
+func runRateLimitCleanup(ctx context.Context, store *ratelimit.PostgresStore, interval time.Duration) {
+	ctx = logging.With(ctx, "worker", "ratelimit-cleanup")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !db.Ready() {
+			continue
+		}
+		if _, err := store.DeleteIdle(ctx); err != nil {
+			logging.FromContext(ctx).WithError(err).Error("Failed to delete idle rate limit buckets")
+		}
+	}
+}
+
+// runSweepers periodically releases slots held by expired checkout holds and
+// by deposits that were never paid, then offers freed slots to the waitlist
+// and retries failed refunds, until ctx is cancelled
+func runSweepers(ctx context.Context, repos models.Repositories, interval time.Duration) {
+	ctx = logging.With(ctx, "worker", "sweeper")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !db.Ready() {
+			continue
+		}
+
+		released, err := repos.Holds.Expire(ctx)
+		if err != nil {
+			logging.FromContext(ctx).WithError(err).Error("Failed to expire slot holds")
+		} else if released > 0 {
+			logging.FromContext(ctx).Infof("Released %d expired slot hold(s)", released)
+		}
+
+		expired, err := repos.Payments.ExpireUnpaid(ctx)
+		if err != nil {
+			logging.FromContext(ctx).WithError(err).Error("Failed to expire unpaid appointments")
+		} else if expired > 0 {
+			logging.FromContext(ctx).Infof("Expired %d unpaid appointment(s)", expired)
+		}
+
+		offered, err := notify.ProcessWaitlist(ctx, repos.Waitlist)
+		if err != nil {
+			logging.FromContext(ctx).WithError(err).Error("Failed to process waitlist")
+		} else if offered > 0 {
+			logging.FromContext(ctx).Infof("Sent %d waitlist offer(s)", offered)
+		}
+
+		refunded, err := payments.RetryRefunds(ctx, repos.Payments)
+		if err != nil {
+			logging.FromContext(ctx).WithError(err).Error("Failed to retry refunds")
+		} else if refunded > 0 {
+			logging.FromContext(ctx).Infof("Refunded %d deposit(s)", refunded)
+		}
+	}
 }
@@ -0,0 +1,119 @@
+// Package metrics defines the Prometheus metrics the server exposes on
+// /metrics: HTTP traffic, database pool usage and booking activity.
+package metrics
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric below, plus the Go runtime and process metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method, route template and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// AppointmentsCreated counts bookings saved, whatever their payment status
+	AppointmentsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "booking_appointments_created_total",
+		Help: "Appointments booked.",
+	})
+
+	// AppointmentsCancelled counts cancellations by who cancelled: "provider"
+	// or "client"
+	AppointmentsCancelled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "booking_appointments_cancelled_total",
+		Help: "Appointments cancelled, by who cancelled them.",
+	}, []string{"by"})
+
+	// BookingConflicts counts bookings refused because the slot was taken
+	BookingConflicts = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "booking_conflicts_total",
+		Help: "Bookings refused with 409 because the slot was no longer free.",
+	})
+
+	// OAuthLogins counts successful social logins by provider
+	OAuthLogins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "booking_oauth_logins_total",
+		Help: "Successful OAuth logins by provider.",
+	}, []string{"provider"})
+
+	// MediaUploadFailures counts service media that couldn't be uploaded
+	MediaUploadFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "booking_media_upload_failures_total",
+		Help: "Media uploads that failed.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		AppointmentsCreated,
+		AppointmentsCancelled,
+		BookingConflicts,
+		OAuthLogins,
+		MediaUploadFailures,
+	)
+}
+
+// RegisterDB exposes the connection pool statistics of db
+func RegisterDB(db *sql.DB) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, "main"))
+}
+
+// Handler serves the metrics in the Prometheus text format. A non-empty
+// token must be sent as "Authorization: Bearer <token>".
+func Handler(token string) http.Handler {
+	handler := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return handler
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Middleware records the count and latency of every request. Requests are
+// labelled with the route template, such as /api/v1/events/:id, so IDs don't
+// create a series each; requests matching no route share "unmatched".
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		httpRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
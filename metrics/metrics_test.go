@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddlewareLabelsByRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	server.Use(Middleware())
+	server.GET("/api/v1/events/:id", func(c *gin.Context) { c.Status(http.StatusNotFound) })
+
+	for _, path := range []string{"/api/v1/events/1", "/api/v1/events/2", "/nowhere"} {
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/api/v1/events/:id", "404")); got != 2 {
+		t.Errorf("requests to /api/v1/events/:id = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("GET", "unmatched", "404")); got != 1 {
+		t.Errorf("unmatched requests = %v, want 1", got)
+	}
+
+	w := httptest.NewRecorder()
+	Handler("").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, name := range []string{"http_request_duration_seconds_bucket", "booking_appointments_created_total", "go_goroutines"} {
+		if !strings.Contains(w.Body.String(), name) {
+			t.Errorf("/metrics is missing %s", name)
+		}
+	}
+}
+
+func TestHandlerRequiresToken(t *testing.T) {
+	handler := Handler("scrape-token-0123")
+	for auth, want := range map[string]int{
+		"":                         http.StatusUnauthorized,
+		"Bearer wrong":             http.StatusUnauthorized,
+		"Bearer scrape-token-0123": http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("Authorization %q: status = %d, want %d", auth, w.Code, want)
+		}
+	}
+}
@@ -1,26 +1,30 @@
 package middlewares
 
 import (
-	"net/http"
-
+	"example.com/logging"
+	"example.com/models"
 	"example.com/utils"
 	"github.com/gin-gonic/gin"
 )
 
+var errNotAuthorized = models.Unauthorized("not_authorized", "a valid access token is required")
+
 func Authenticate(context *gin.Context) {
 	token := context.Request.Header.Get("Authorization")
 	if token == "" {
-		context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Not authorized: no token"})
+		WriteProblem(context, errNotAuthorized)
 		return
 	}
 
 	userId, _, err := utils.VerifyToken(token)
 
 	if err != nil {
-		context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Not authorized: " + err.Error()})
+		context.Error(err)
+		WriteProblem(context, errNotAuthorized)
 		return
 	}
 
 	context.Set("userId", userId)
+	context.Request = context.Request.WithContext(logging.With(context.Request.Context(), "userId", userId))
 	context.Next()
 }
@@ -0,0 +1,82 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+
+	"example.com/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Problem is an RFC 7807 problem details body. Code is a stable identifier
+// clients can switch on; Errors lists invalid fields for validation problems.
+type Problem struct {
+	Type     string                    `json:"type"`
+	Title    string                    `json:"title"`
+	Status   int                       `json:"status"`
+	Detail   string                    `json:"detail,omitempty"`
+	Instance string                    `json:"instance,omitempty"`
+	Code     string                    `json:"code"`
+	Errors   []*models.ValidationError `json:"errors,omitempty"`
+}
+
+var kindStatus = map[models.ErrorKind]int{
+	models.KindNotFound:        http.StatusNotFound,
+	models.KindConflict:        http.StatusConflict,
+	models.KindValidation:      http.StatusBadRequest,
+	models.KindForbidden:       http.StatusForbidden,
+	models.KindUnauthorized:    http.StatusUnauthorized,
+	models.KindUnavailable:     http.StatusBadGateway,
+	models.KindTooManyRequests: http.StatusTooManyRequests,
+}
+
+// ErrorHandler renders the last error a handler attached with c.Error as a
+// problem+json response. Errors that are not domain errors become a generic
+// 500; their details only reach the request log.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		WriteProblem(c, c.Errors.Last().Err)
+	}
+}
+
+// WriteProblem aborts the request with the problem details for err
+func WriteProblem(c *gin.Context, err error) {
+	problem := NewProblem(err)
+	problem.Instance = c.Request.URL.Path
+	c.Header("Content-Type", "application/problem+json")
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
+
+// NewProblem maps an error to its problem details without exposing internals
+func NewProblem(err error) Problem {
+	var fieldErrs models.ValidationErrors
+	var fieldErr *models.ValidationError
+	var domainErr *models.Error
+	switch {
+	case errors.As(err, &fieldErrs):
+		return newProblem(http.StatusBadRequest, "validation_failed", "one or more fields are invalid", fieldErrs)
+	case errors.As(err, &fieldErr):
+		return newProblem(http.StatusBadRequest, "validation_failed", "one or more fields are invalid", []*models.ValidationError{fieldErr})
+	case errors.As(err, &domainErr):
+		if status, ok := kindStatus[domainErr.Kind]; ok {
+			return newProblem(status, domainErr.Code, domainErr.Message, nil)
+		}
+	}
+	return newProblem(http.StatusInternalServerError, "internal_error", "an unexpected error occurred", nil)
+}
+
+func newProblem(status int, code, detail string, fields []*models.ValidationError) Problem {
+	return Problem{
+		Type:   "/problems/" + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+		Errors: fields,
+	}
+}
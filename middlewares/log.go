@@ -1,22 +1,36 @@
 package middlewares
 
 import (
-	"net/http"
-	"os"
+	"fmt"
+	"regexp"
 	"runtime/debug"
 	"time"
 
+	"example.com/logging"
 	"github.com/gin-gonic/gin"
-	"github.com/sirupsen/logrus"
+	"github.com/google/uuid"
 )
 
-var Log *logrus.Logger
+// RequestIDHeader carries the request ID in both directions
+const RequestIDHeader = "X-Request-ID"
 
-func Init() {
-	Log = logrus.New()
-	Log.SetFormatter(&logrus.JSONFormatter{})
-	Log.SetOutput(os.Stdout)
-	Log.SetLevel(logrus.DebugLevel)
+// validRequestID limits incoming IDs to what is safe to log and echo back
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID gives every request an ID, keeping the caller's X-Request-ID
+// when it is well formed, echoes it in the response and adds it to the
+// request's logger
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+		c.Set("requestId", id)
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logging.With(c.Request.Context(), "requestId", id))
+		c.Next()
+	}
 }
 
 func RequestLogger() gin.HandlerFunc {
@@ -28,7 +42,7 @@ func RequestLogger() gin.HandlerFunc {
 		latency := time.Since(start)
 
 		status := c.Writer.Status()
-		Log.WithFields(map[string]interface{}{
+		logging.FromContext(c.Request.Context()).WithFields(map[string]interface{}{
 			"status":    status,
 			"method":    c.Request.Method,
 			"path":      c.Request.URL.Path,
@@ -44,14 +58,14 @@ func RecoveryLogger() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		defer func() {
 			if err := recover(); err != nil {
-				Log.WithFields(map[string]interface{}{
+				logging.FromContext(c.Request.Context()).WithFields(map[string]interface{}{
 					"error": err,
 					"stack": string(debug.Stack()),
 				}).Error("panic recovered")
 
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-					"error": "Internal Server Error",
-				})
+				if !c.Writer.Written() {
+					WriteProblem(c, fmt.Errorf("panic: %v", err))
+				}
 			}
 		}()
 		c.Next()
@@ -0,0 +1,29 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireReady answers 503 with a Retry-After header while ready reports
+// false, so requests arriving during startup or shutdown fail cleanly instead
+// of reaching an unusable database. Requests for the paths in always, such
+// as the liveness check, are let through.
+func RequireReady(ready func() bool, always ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(always))
+	for _, path := range always {
+		skip[path] = true
+	}
+	return func(c *gin.Context) {
+		if ready() || skip[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+		problem := newProblem(http.StatusServiceUnavailable, "not_ready", "the server is starting up or shutting down", nil)
+		problem.Instance = c.Request.URL.Path
+		c.Header("Retry-After", "5")
+		c.Header("Content-Type", "application/problem+json")
+		c.AbortWithStatusJSON(problem.Status, problem)
+	}
+}
@@ -2,49 +2,273 @@ package models
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
 
 	"example.com/db"
+	"example.com/pagination"
+	"github.com/lib/pq"
+)
+
+// MaxAppointmentItems caps how many services can be booked in one appointment
+const MaxAppointmentItems = 10
+
+const (
+	StatusConfirmed = "confirmed"
+	// StatusPendingPayment holds the slot until the deposit is paid or the hold expires
+	StatusPendingPayment = "pending_payment"
+	StatusExpired        = "expired"
 )
 
 type Appointment struct {
-	ID        string    `json:"id"`
-	UserID    int64     `json:"userId"`
-	ServiceID int64     `json:"serviceId" binding:"required"`
-	Date      string    `json:"date" binding:"required"`
-	StartTime string    `json:"startTime" binding:"required"`
-	EndTime   string    `json:"endTime" binding:"required"`
-	FirstName string    `json:"firstName" binding:"required"`
-	LastName  string    `json:"lastName" binding:"required"`
-	Email     string    `json:"email" binding:"required"`
-	Phone     string    `json:"phone" binding:"required"`
-	Instagram string    `json:"instagram,omitempty"`
-	CreatedAt time.Time `json:"createdAt"`
-}
-
-func CreateAppointment(ctx context.Context, appt *Appointment) error {
-	tx, err := db.DB.BeginTx(ctx, &sql.TxOptions{})
+	ID        string            `json:"id"`
+	UserID    int64             `json:"userId"`
+	ServiceID int64             `json:"serviceId"`
+	VariantID *int64            `json:"variantId,omitempty"`
+	AddOnIDs  []int64           `json:"addOnIds,omitempty"`
+	Items     []AppointmentItem `json:"items"`
+	Duration  int64             `json:"duration"`
+	Price     Money             `json:"price"`
+	Date      string            `json:"date" binding:"required"`
+	StartTime string            `json:"startTime" binding:"required"`
+	EndTime   string            `json:"endTime"`
+	FirstName string            `json:"firstName" binding:"required"`
+	LastName  string            `json:"lastName" binding:"required"`
+	Email     string            `json:"email" binding:"required"`
+	Phone     string            `json:"phone" binding:"required"`
+	Instagram string            `json:"instagram,omitempty"`
+	Status    string            `json:"status"`
+	// ClientID is the provider's client record the booking was matched to
+	ClientID *int64 `json:"clientId,omitempty"`
+	// NoShow is set by the provider when the client did not turn up
+	NoShow bool `json:"noShow"`
+	// HoldExpiresAt is set while the appointment awaits payment
+	HoldExpiresAt *time.Time `json:"holdExpiresAt,omitempty"`
+	// HoldID/HoldToken convert a slot hold taken during checkout into this appointment
+	HoldID    string `json:"holdId,omitempty"`
+	HoldToken string `json:"holdToken,omitempty"`
+	// CancelToken lets the client cancel the booking; only returned on creation
+	CancelToken string    `json:"cancelToken,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// AppointmentItem is one booked service within an appointment. Items are
+// performed back to back in the order they were requested.
+type AppointmentItem struct {
+	ID        int64               `json:"id"`
+	ServiceID int64               `json:"serviceId"`
+	VariantID *int64              `json:"variantId,omitempty"`
+	AddOnIDs  []int64             `json:"addOnIds,omitempty"`
+	Options   []AppointmentOption `json:"options"`
+	Duration  int64               `json:"duration"`
+	Price     Money               `json:"price"`
+	StartTime string              `json:"startTime"`
+	EndTime   string              `json:"endTime"`
+}
+
+// ServiceIDs returns the distinct services requested, accepting either the
+// items list or the single serviceId/variantId/addOnIds shorthand.
+func (a *Appointment) ServiceIDs() []int64 {
+	if len(a.Items) == 0 && a.ServiceID != 0 {
+		return []int64{a.ServiceID}
+	}
+	seen := make(map[int64]bool, len(a.Items))
+	ids := make([]int64, 0, len(a.Items))
+	for _, item := range a.Items {
+		if !seen[item.ServiceID] {
+			seen[item.ServiceID] = true
+			ids = append(ids, item.ServiceID)
+		}
+	}
+	return ids
+}
+
+// ApplyServices resolves every item against its service and lays the items
+// out contiguously from StartTime, setting the combined EndTime and Duration
+// and snapshotting the price so later service edits don't change old bookings.
+// A single service without a duration falls back to the endTime sent by the client.
+func (a *Appointment) ApplyServices(services map[int64]*Service) error {
+	if len(a.Items) == 0 {
+		if a.ServiceID == 0 {
+			return Invalid("invalid_selection", "serviceId or items is required")
+		}
+		a.Items = []AppointmentItem{{ServiceID: a.ServiceID, VariantID: a.VariantID, AddOnIDs: a.AddOnIDs}}
+	}
+	if len(a.Items) > MaxAppointmentItems {
+		return Invalid("invalid_selection", fmt.Sprintf("at most %d services can be booked at once", MaxAppointmentItems))
+	}
+	a.ServiceID = a.Items[0].ServiceID
+	a.VariantID = nil
+	a.AddOnIDs = nil
+
+	cursor := a.StartTime
+	a.Duration = 0
+	a.Price = Money{}
+	for i := range a.Items {
+		item := &a.Items[i]
+		service, ok := services[item.ServiceID]
+		if !ok {
+			return Invalid("invalid_selection", fmt.Sprintf("service %d not found for this user", item.ServiceID))
+		}
+
+		price, duration, options, err := service.ResolveSelection(item.VariantID, item.AddOnIDs)
+		if err != nil {
+			return err
+		}
+		item.Options = options
+		item.Price = price
+
+		if i == 0 {
+			a.Price = Money{Currency: price.Currency}
+		}
+		a.Price, err = a.Price.Add(price)
+		if err != nil {
+			return Invalid("invalid_selection", "services booked together must use the same currency")
+		}
+
+		if duration <= 0 {
+			if len(a.Items) > 1 {
+				return Invalid("invalid_selection", fmt.Sprintf("service %q has no duration and cannot be combined with other services", service.Name))
+			}
+			if a.EndTime == "" {
+				return &ValidationError{Field: "endTime", Message: "is required for services without a duration"}
+			}
+			start, err1 := time.Parse(timeLayout, a.StartTime)
+			end, err2 := time.Parse(timeLayout, a.EndTime)
+			if err1 != nil || err2 != nil {
+				return Invalid("invalid_time", "invalid time format (expected HH:MM)")
+			}
+			if !start.Before(end) {
+				return &ValidationError{Field: "endTime", Message: "must be after startTime"}
+			}
+			duration = int64(end.Sub(start).Minutes())
+		}
+
+		end, err := addMinutes(cursor, duration)
+		if err != nil {
+			return err
+		}
+		item.Duration = duration
+		item.StartTime = cursor
+		item.EndTime = end
+		cursor = end
+		a.Duration += duration
+	}
+
+	a.EndTime = cursor
+	return nil
+}
+
+// addMinutes returns start ("HH:MM") shifted by the given minutes, rejecting results past midnight
+func addMinutes(start string, minutes int64) (string, error) {
+	t, err := time.Parse(timeLayout, start)
+	if err != nil {
+		return "", Invalid("invalid_time", "invalid time format (expected HH:MM)")
+	}
+	total := int64(t.Hour()*60+t.Minute()) + minutes
+	if total > 24*60-1 {
+		return "", Invalid("invalid_time", "appointment must end on the same day")
+	}
+	return fmt.Sprintf("%02d:%02d", total/60, total%60), nil
+}
+
+// postgresAppointments is the AppointmentRepository backed by the
+// appointments and appointment_items tables
+type postgresAppointments struct {
+	conn db.DBTX
+}
+
+func (r postgresAppointments) Create(ctx context.Context, appt *Appointment) error {
+	if appt.Status == "" {
+		appt.Status = StatusConfirmed
+	}
+	token, err := newToken()
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
+	appt.CancelToken = token
 
+	return db.WithTx(ctx, r.conn, func(tx *sql.Tx) error {
+		return insertAppointment(ctx, tx, appt)
+	})
+}
+
+// insertAppointment takes the appointment's slot and inserts it with its items
+func insertAppointment(ctx context.Context, tx *sql.Tx, appt *Appointment) error {
+	var err error
+
+	// Take the slot from the schedule, or from the client's hold if they reserved it first
+	if appt.HoldID != "" {
+		err = consumeSlotHold(ctx, tx, appt)
+	} else {
+		err = carveSlot(ctx, tx, appt.UserID, appt.Date, appt.StartTime, appt.EndTime)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Link the booking to the provider's client record
+	if err := matchClient(ctx, tx, appt); err != nil {
+		return err
+	}
+
+	// Insert the appointment
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO appointments (user_id, service_id, client_id, duration, price_minor, currency, date, start_time, end_time,
+		                          first_name, last_name, email, phone, instagram, status, hold_expires_at, cancel_token)
+		VALUES ($1, $2, $3, $4, $5, $6, $7::date, $8::time, $9::time, $10, $11, $12, $13, $14, $15, $16, $17)
+		RETURNING id, created_at
+	`, appt.UserID, appt.ServiceID, appt.ClientID, appt.Duration, appt.Price.Amount, appt.Price.Currency, appt.Date, appt.StartTime, appt.EndTime,
+		appt.FirstName, appt.LastName, appt.Email, appt.Phone, appt.Instagram, appt.Status, appt.HoldExpiresAt, appt.CancelToken,
+	).Scan(&appt.ID, &appt.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	// Insert one line item per booked service
+	for i := range appt.Items {
+		item := &appt.Items[i]
+		optionsJSON, err := json.Marshal(item.Options)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO appointment_items (appointment_id, service_id, variant_id, options, duration, price_minor, currency, start_time, end_time, position)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8::time, $9::time, $10)
+			RETURNING id
+		`, appt.ID, item.ServiceID, item.VariantID, string(optionsJSON), item.Duration, item.Price.Amount, item.Price.Currency,
+			item.StartTime, item.EndTime, i,
+		).Scan(&item.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// carveSlot removes [startTime, endTime) from the schedule row containing it,
+// keeping whatever is left on either side as separate rows
+func carveSlot(ctx context.Context, tx *sql.Tx, userID int64, date, startTime, endTime string) error {
 	// Find the schedule row that fully contains the requested time range
 	var schedID int64
 	var schedStart, schedEnd string
-	err = tx.QueryRowContext(ctx, `
+	err := tx.QueryRowContext(ctx, `
 		SELECT id, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')
 		FROM schedules
 		WHERE user_id = $1 AND date = $2::date
 		  AND start_time <= $3::time AND end_time >= $4::time
 		LIMIT 1
-	`, appt.UserID, appt.Date, appt.StartTime, appt.EndTime).Scan(&schedID, &schedStart, &schedEnd)
+		FOR UPDATE
+	`, userID, date, startTime, endTime).Scan(&schedID, &schedStart, &schedEnd)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return fmt.Errorf("no available timeslot for the requested time")
+			return ErrSlotUnavailable
 		}
 		return err
 	}
@@ -56,111 +280,364 @@ func CreateAppointment(ctx context.Context, appt *Appointment) error {
 	}
 
 	// Insert remaining intervals
-	if schedStart != appt.StartTime {
+	if schedStart != startTime {
 		_, err = tx.ExecContext(ctx, `
 			INSERT INTO schedules (user_id, date, start_time, end_time)
 			VALUES ($1, $2::date, $3::time, $4::time)
-		`, appt.UserID, appt.Date, schedStart, appt.StartTime)
+		`, userID, date, schedStart, startTime)
 		if err != nil {
 			return err
 		}
 	}
-	if appt.EndTime != schedEnd {
+	if endTime != schedEnd {
 		_, err = tx.ExecContext(ctx, `
 			INSERT INTO schedules (user_id, date, start_time, end_time)
 			VALUES ($1, $2::date, $3::time, $4::time)
-		`, appt.UserID, appt.Date, appt.EndTime, schedEnd)
+		`, userID, date, endTime, schedEnd)
 		if err != nil {
 			return err
 		}
 	}
 
-	// Insert the appointment
-	err = tx.QueryRowContext(ctx, `
-		INSERT INTO appointments (user_id, service_id, date, start_time, end_time, first_name, last_name, email, phone, instagram)
-		VALUES ($1, $2, $3::date, $4::time, $5::time, $6, $7, $8, $9, $10)
-		RETURNING id, created_at
-	`, appt.UserID, appt.ServiceID, appt.Date, appt.StartTime, appt.EndTime,
-		appt.FirstName, appt.LastName, appt.Email, appt.Phone, appt.Instagram,
-	).Scan(&appt.ID, &appt.CreatedAt)
+	return nil
+}
+
+// newToken returns a random hex token for client-held capabilities (cancel links, holds)
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// AppointmentKeyset lists the orders appointments can be listed in
+var AppointmentKeyset = pagination.Keyset{
+	Sorts: map[string]pagination.Column{
+		"date":      {Expr: "date + start_time", Type: "timestamp"},
+		"createdAt": {Expr: "COALESCE(created_at, 'epoch')", Type: "timestamp"},
+	},
+	Default: "date",
+	ID:      pagination.Column{Expr: "id", Type: "uuid"},
+}
+
+// AppointmentFilter narrows a provider's appointment list. Empty fields
+// match everything.
+type AppointmentFilter struct {
+	// From and To are inclusive dates (YYYY-MM-DD)
+	From     string
+	To       string
+	Status   string
+	ClientID *int64
+}
+
+func (f *AppointmentFilter) Validate() error {
+	var errs ValidationErrors
+	var from, to time.Time
+	var err error
+	if f.From != "" {
+		if from, err = ParseDate(f.From); err != nil {
+			errs.Add("from", err.Error())
+		}
+	}
+	if f.To != "" {
+		if to, err = ParseDate(f.To); err != nil {
+			errs.Add("to", err.Error())
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		errs.Add("to", "must not be before from")
+	}
+	switch f.Status {
+	case "", StatusConfirmed, StatusPendingPayment, StatusExpired:
+	default:
+		errs.Add("status", fmt.Sprintf("must be one of %s, %s, %s", StatusConfirmed, StatusPendingPayment, StatusExpired))
+	}
+	return errs.Err()
+}
+
+// where returns the filter condition for a user's appointments with its
+// arguments as $1..$5
+func (f AppointmentFilter) where(userID int64) (string, []any) {
+	return `user_id = $1 AND ($2::bigint IS NULL OR client_id = $2)
+		AND ($3::date IS NULL OR date >= $3) AND ($4::date IS NULL OR date <= $4)
+		AND ($5 = '' OR status = $5)`,
+		[]any{userID, f.ClientID, nullIfEmpty(f.From), nullIfEmpty(f.To), f.Status}
+}
+
+// List returns one page of a provider's appointments
+func (r postgresAppointments) List(ctx context.Context, userID int64, filter AppointmentFilter, page pagination.Request) ([]Appointment, pagination.Meta, error) {
+	where, args := filter.where(userID)
+
+	var total int64
+	err := r.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM appointments WHERE `+where, args...).Scan(&total)
 	if err != nil {
-		return err
+		return nil, pagination.Meta{}, err
+	}
+
+	after, afterArgs := page.After(len(args) + 1)
+	appointments, values, err := queryAppointments(ctx, r.conn, userID, page.SortValue(),
+		where+" AND "+after+" ORDER BY "+page.OrderBy()+page.LimitClause(),
+		append(args, afterArgs...))
+	if err != nil {
+		return nil, pagination.Meta{}, err
 	}
 
-	return tx.Commit()
+	appointments, meta := pagination.Finish(page, appointments, values, func(a Appointment) string { return a.ID }, total)
+	return appointments, meta, nil
 }
 
-func GetAppointments(ctx context.Context, userID int64) ([]Appointment, error) {
-	rows, err := db.DB.QueryContext(ctx, `
-		SELECT id, user_id, service_id, date, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI'),
-		       first_name, last_name, email, phone, instagram, created_at
+// listAppointments returns all of a user's appointments matching the filter
+// in date order
+func listAppointments(ctx context.Context, conn db.DBTX, userID int64, filter AppointmentFilter) ([]Appointment, error) {
+	where, args := filter.where(userID)
+	appointments, _, err := queryAppointments(ctx, conn, userID, "''", where+" ORDER BY date, start_time", args)
+	return appointments, err
+}
+
+// nullIfEmpty passes an optional string parameter as SQL NULL when unset
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// queryAppointments loads appointments with their items. sortValue is
+// selected alongside each row and returned in the same order.
+func queryAppointments(ctx context.Context, conn db.DBTX, userID int64, sortValue, clause string, args []any) ([]Appointment, []string, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT id, user_id, service_id, client_id, COALESCE(duration, 0), COALESCE(price_minor, 0), COALESCE(currency, ''), date,
+		       to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI'),
+		       first_name, last_name, email, phone, instagram, status, no_show, hold_expires_at, created_at, `+sortValue+`
 		FROM appointments
-		WHERE user_id = $1
-		ORDER BY date, start_time
-	`, userID)
+		WHERE `+clause, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	var appointments []Appointment
+	var values, ids []string
 	for rows.Next() {
 		var a Appointment
 		var date time.Time
 		var instagram sql.NullString
-		err := rows.Scan(&a.ID, &a.UserID, &a.ServiceID, &date, &a.StartTime, &a.EndTime,
-			&a.FirstName, &a.LastName, &a.Email, &a.Phone, &instagram, &a.CreatedAt)
+		var clientID sql.NullInt64
+		var value string
+		err := rows.Scan(&a.ID, &a.UserID, &a.ServiceID, &clientID, &a.Duration, &a.Price.Amount, &a.Price.Currency, &date, &a.StartTime, &a.EndTime,
+			&a.FirstName, &a.LastName, &a.Email, &a.Phone, &instagram, &a.Status, &a.NoShow, &a.HoldExpiresAt, &a.CreatedAt, &value)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		if clientID.Valid {
+			a.ClientID = &clientID.Int64
 		}
 		a.Date = date.Format("2006-01-02")
 		if instagram.Valid {
 			a.Instagram = instagram.String
 		}
 		appointments = append(appointments, a)
+		values = append(values, value)
+		ids = append(ids, a.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
 	}
-	return appointments, rows.Err()
+
+	items, err := getAppointmentItems(ctx, conn, userID, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range appointments {
+		appointments[i].Items = items[appointments[i].ID]
+		if appointments[i].Items == nil {
+			appointments[i].Items = []AppointmentItem{}
+		}
+	}
+	return appointments, values, nil
 }
 
-func DeleteAppointment(ctx context.Context, appointmentID string, userID int64) error {
-	tx, err := db.DB.BeginTx(ctx, &sql.TxOptions{})
+// getAppointmentItems loads the line items of a user's appointments, grouped by appointment id
+func getAppointmentItems(ctx context.Context, conn db.DBTX, userID int64, appointmentIDs []string) (map[string][]AppointmentItem, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT i.appointment_id, i.id, i.service_id, i.variant_id, i.options, i.duration,
+		       COALESCE(i.price_minor, 0), COALESCE(i.currency, ''),
+		       to_char(i.start_time, 'HH24:MI'), to_char(i.end_time, 'HH24:MI')
+		FROM appointment_items i
+		JOIN appointments a ON a.id = i.appointment_id
+		WHERE a.user_id = $1 AND i.appointment_id = ANY($2::uuid[])
+		ORDER BY i.appointment_id, i.position
+	`, userID, pq.Array(appointmentIDs))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer tx.Rollback()
+	defer rows.Close()
+
+	out := make(map[string][]AppointmentItem)
+	for rows.Next() {
+		var appointmentID string
+		var item AppointmentItem
+		var variantID sql.NullInt64
+		var optionsJSON *string
+		err := rows.Scan(&appointmentID, &item.ID, &item.ServiceID, &variantID, &optionsJSON, &item.Duration,
+			&item.Price.Amount, &item.Price.Currency, &item.StartTime, &item.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		if variantID.Valid {
+			item.VariantID = &variantID.Int64
+		}
+		item.Options = []AppointmentOption{}
+		if optionsJSON != nil && *optionsJSON != "" {
+			if err := json.Unmarshal([]byte(*optionsJSON), &item.Options); err != nil {
+				return nil, fmt.Errorf("failed to decode options JSON: %w", err)
+			}
+		}
+		out[appointmentID] = append(out[appointmentID], item)
+	}
+	return out, rows.Err()
+}
 
-	// Fetch the appointment details
+func (r postgresAppointments) Delete(ctx context.Context, appointmentID string, userID int64) error {
+	return r.delete(ctx, appointmentID, userID, true)
+}
+
+func (r postgresAppointments) Release(ctx context.Context, appointmentID string, userID int64) error {
+	return r.delete(ctx, appointmentID, userID, false)
+}
+
+// delete removes the appointment and gives its slot back, offering it to the
+// waitlist when freed is set
+func (r postgresAppointments) delete(ctx context.Context, appointmentID string, userID int64, freed bool) error {
+	return db.WithTx(ctx, r.conn, func(tx *sql.Tx) error {
+		// Fetch the appointment details
+		var date time.Time
+		var startTime, endTime, status string
+		err := tx.QueryRowContext(ctx, `
+			SELECT date, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI'), status
+			FROM appointments
+			WHERE id = $1 AND user_id = $2
+			FOR UPDATE
+		`, appointmentID, userID).Scan(&date, &startTime, &endTime, &status)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrAppointmentNotFound
+			}
+			return err
+		}
+
+		// Delete the appointment
+		_, err = tx.ExecContext(ctx, `DELETE FROM appointments WHERE id = $1`, appointmentID)
+		if err != nil {
+			return err
+		}
+
+		// Restore the timeslot and merge adjacent intervals (expired holds already gave it back)
+		if status == StatusExpired {
+			return nil
+		}
+		dateStr := date.Format("2006-01-02")
+		if !freed {
+			return mergeSlot(ctx, tx, userID, dateStr, startTime, endTime)
+		}
+		return restoreAndMergeSlot(ctx, tx, userID, dateStr, startTime, endTime)
+	})
+}
+
+// SetNoShow records whether the client turned up. Only confirmed appointments
+// that have already started can be marked.
+func (r postgresAppointments) SetNoShow(ctx context.Context, appointmentID string, userID int64, noShow bool) error {
+	var a Appointment
 	var date time.Time
-	var startTime, endTime string
-	err = tx.QueryRowContext(ctx, `
-		SELECT date, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')
+	err := r.conn.QueryRowContext(ctx, `
+		SELECT date, to_char(start_time, 'HH24:MI'), status
 		FROM appointments
 		WHERE id = $1 AND user_id = $2
-	`, appointmentID, userID).Scan(&date, &startTime, &endTime)
+	`, appointmentID, userID).Scan(&date, &a.StartTime, &a.Status)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return fmt.Errorf("appointment not found")
+			return ErrAppointmentNotFound
 		}
 		return err
 	}
+	a.Date = date.Format("2006-01-02")
+	if err := a.checkNoShow(noShow); err != nil {
+		return err
+	}
+
+	_, err = r.conn.ExecContext(ctx, `UPDATE appointments SET no_show = $1 WHERE id = $2`, noShow, appointmentID)
+	return err
+}
+
+// GetForClient returns an appointment the client holds a valid cancel token for
+func (r postgresAppointments) GetForClient(ctx context.Context, appointmentID string, userID int64, cancelToken string) (*Appointment, error) {
+	var a Appointment
+	var date time.Time
+	err := r.conn.QueryRowContext(ctx, `
+		SELECT id, user_id, date, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI'), status, no_show
+		FROM appointments
+		WHERE id = $1 AND user_id = $2 AND cancel_token = $3
+	`, appointmentID, userID, cancelToken).Scan(&a.ID, &a.UserID, &date, &a.StartTime, &a.EndTime, &a.Status, &a.NoShow)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAppointmentNotFound
+		}
+		return nil, err
+	}
+	a.Date = date.Format("2006-01-02")
+	return &a, nil
+}
 
-	// Delete the appointment
-	_, err = tx.ExecContext(ctx, `DELETE FROM appointments WHERE id = $1`, appointmentID)
+// CheckClientCancel rejects client cancellation of appointments that are no
+// longer booked or have already started, so their history is kept
+func (a *Appointment) CheckClientCancel() error {
+	if a.NoShow || (a.Status != StatusConfirmed && a.Status != StatusPendingPayment) {
+		return ErrNotCancellable
+	}
+	startsAt, err := a.StartsAt()
 	if err != nil {
 		return err
 	}
+	if !time.Now().Before(startsAt) {
+		return ErrNotCancellable
+	}
+	return nil
+}
 
-	// Restore the timeslot and merge adjacent intervals
-	dateStr := date.Format("2006-01-02")
-	err = restoreAndMergeSlot(ctx, tx, userID, dateStr, startTime, endTime)
+// checkNoShow rejects marking appointments that are not confirmed or have not
+// started yet
+func (a *Appointment) checkNoShow(noShow bool) error {
+	if a.Status != StatusConfirmed {
+		return &ValidationError{Field: "noShow", Message: "only confirmed appointments can be marked"}
+	}
+	startsAt, err := a.StartsAt()
 	if err != nil {
 		return err
 	}
+	if noShow && time.Now().Before(startsAt) {
+		return &ValidationError{Field: "noShow", Message: "appointment has not started yet"}
+	}
+	return nil
+}
 
-	return tx.Commit()
+// StartsAt returns the moment the appointment starts, reading its date and
+// time where bookings are
+func (a *Appointment) StartsAt() (time.Time, error) {
+	return time.ParseInLocation("2006-01-02 15:04", a.Date+" "+a.StartTime, timeZone)
 }
 
 func restoreAndMergeSlot(ctx context.Context, tx *sql.Tx, userID int64, date, startTime, endTime string) error {
+	if err := mergeSlot(ctx, tx, userID, date, startTime, endTime); err != nil {
+		return err
+	}
+	// Let waitlisted clients know the slot is available again
+	return markSlotFreed(ctx, tx, userID, date)
+}
+
+// mergeSlot gives a slot back to the schedule, merging it with the ranges it
+// touches
+func mergeSlot(ctx context.Context, tx *sql.Tx, userID int64, date, startTime, endTime string) error {
 	// Find adjacent schedule rows that touch the restored slot
 	// A row is adjacent if its end_time == startTime or its start_time == endTime
 	rows, err := tx.QueryContext(ctx, `
@@ -0,0 +1,519 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/db"
+	"example.com/pagination"
+	"github.com/lib/pq"
+)
+
+const (
+	maxClientTags   = 20
+	maxClientTagLen = 32
+	maxClientNotes  = 5000
+)
+
+var (
+	ErrClientNotFound = NotFound("client_not_found", "client not found")
+	ErrClientExists   = Conflict("client_exists", "another client has this email or phone, merge them instead")
+)
+
+// Client is a provider's record of a person who books with them. Bookings
+// are matched to clients by normalized email, then phone.
+type Client struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"-"`
+	FirstName string    `json:"firstName"`
+	LastName  string    `json:"lastName"`
+	Email     string    `json:"email"`
+	Phone     string    `json:"phone"`
+	Instagram string    `json:"instagram"`
+	Notes     string    `json:"notes"`
+	Tags      []string  `json:"tags"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ClientSummary is a client with booking stats
+type ClientSummary struct {
+	Client
+	Visits    int     `json:"visits"`
+	NoShows   int     `json:"noShows"`
+	LastVisit *string `json:"lastVisit"`
+	// TotalSpent has one entry per currency the client paid in
+	TotalSpent []Money `json:"totalSpent"`
+}
+
+// ClientDetail is a client with stats and full booking history, newest first
+type ClientDetail struct {
+	ClientSummary
+	Appointments []Appointment `json:"appointments"`
+}
+
+// NormalizeEmail is the key emails are matched on. Addresses are stored as
+// NormalizeEmailAddress returns them, which is the same.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizePhone is the key phone numbers are matched on: the digits of the
+// number's E.164 form, so "+44 20 7946 0958" and a local "020 7946 0958"
+// match. Numbers that don't parse, such as those saved before validation,
+// keep only their digits.
+func NormalizePhone(phone string) string {
+	if e164, err := NormalizeE164(phone); err == nil {
+		return strings.TrimPrefix(e164, "+")
+	}
+	var b strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func (cl *Client) Validate() error {
+	var errs ValidationErrors
+	validateName(&errs, "firstName", &cl.FirstName)
+	validateName(&errs, "lastName", &cl.LastName)
+	// Contact details are optional on the record, but must be valid when given
+	if cl.Email = strings.TrimSpace(cl.Email); cl.Email != "" {
+		if email, err := NormalizeEmailAddress(cl.Email); err != nil {
+			errs.Add("email", err.Error())
+		} else {
+			cl.Email = email
+		}
+	}
+	if cl.Phone = strings.TrimSpace(cl.Phone); cl.Phone != "" {
+		if phone, err := NormalizeE164(cl.Phone); err != nil {
+			errs.Add("phone", err.Error())
+		} else {
+			cl.Phone = phone
+		}
+	}
+	validateInstagram(&errs, &cl.Instagram)
+	if len(cl.Notes) > maxClientNotes {
+		errs.Add("notes", fmt.Sprintf("must be at most %d characters", maxClientNotes))
+	}
+	cl.Tags = normalizeTags(&errs, cl.Tags)
+	return errs.Err()
+}
+
+// normalizeTags trims, lowercases and de-duplicates tags, keeping them sorted
+func normalizeTags(errs *ValidationErrors, in []string) []string {
+	seen := make(map[string]bool)
+	out := []string{}
+	for _, tag := range in {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxClientTagLen {
+			errs.Add("tags", fmt.Sprintf("each tag must be at most %d characters", maxClientTagLen))
+			return in
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	if len(out) > maxClientTags {
+		errs.Add("tags", fmt.Sprintf("at most %d tags allowed", maxClientTags))
+		return in
+	}
+	sort.Strings(out)
+	return out
+}
+
+// matchClient links a booking to the provider's existing client with the same
+// email or phone, creating the client on their first booking. Details missing
+// on the record are filled in from the booking. Normalized emails and phones
+// are unique per provider, so concurrent first bookings share one client.
+func matchClient(ctx context.Context, tx *sql.Tx, appt *Appointment) error {
+	email := NormalizeEmail(appt.Email)
+	phone := NormalizePhone(appt.Phone)
+	if email == "" && phone == "" {
+		return nil
+	}
+
+	clientID, err := findClient(ctx, tx, appt.UserID, email, phone)
+	if errors.Is(err, sql.ErrNoRows) {
+		var id int64
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO clients (user_id, first_name, last_name, email, phone, instagram, email_normalized, phone_normalized)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT DO NOTHING
+			RETURNING id
+		`, appt.UserID, appt.FirstName, appt.LastName, appt.Email, appt.Phone, appt.Instagram, email, phone,
+		).Scan(&id)
+		if err == nil {
+			appt.ClientID = &id
+			return nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		// A concurrent booking created the client first
+		clientID, err = findClient(ctx, tx, appt.UserID, email, phone)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Details another client already has are left for the provider to merge
+	_, err = tx.ExecContext(ctx, `
+		UPDATE clients c
+		SET email = CASE WHEN c.email = '' THEN $2 ELSE c.email END,
+		    email_normalized = CASE WHEN c.email_normalized = '' AND NOT EXISTS (
+		        SELECT 1 FROM clients o WHERE o.user_id = c.user_id AND o.email_normalized = $3
+		    ) THEN $3 ELSE c.email_normalized END,
+		    phone = CASE WHEN c.phone = '' THEN $4 ELSE c.phone END,
+		    phone_normalized = CASE WHEN c.phone_normalized = '' AND NOT EXISTS (
+		        SELECT 1 FROM clients o WHERE o.user_id = c.user_id AND o.phone_normalized = $5
+		    ) THEN $5 ELSE c.phone_normalized END,
+		    instagram = CASE WHEN c.instagram = '' THEN $6 ELSE c.instagram END,
+		    updated_at = NOW()
+		WHERE c.id = $1
+	`, clientID, appt.Email, email, appt.Phone, phone, appt.Instagram)
+	if err != nil {
+		return err
+	}
+	appt.ClientID = &clientID
+	return nil
+}
+
+// findClient locks the provider's client with the normalized email or, failing
+// that, phone
+func findClient(ctx context.Context, tx *sql.Tx, userID int64, email, phone string) (int64, error) {
+	var clientID int64
+	err := tx.QueryRowContext(ctx, `
+		SELECT id FROM clients
+		WHERE user_id = $1
+		  AND ((email_normalized <> '' AND email_normalized = $2)
+		    OR (phone_normalized <> '' AND phone_normalized = $3))
+		ORDER BY (email_normalized = $2) DESC, id
+		LIMIT 1
+		FOR UPDATE
+	`, userID, email, phone).Scan(&clientID)
+	return clientID, err
+}
+
+const clientColumns = `c.id, c.user_id, c.first_name, c.last_name, c.email, c.phone, c.instagram, c.notes, c.tags, c.created_at`
+
+// clientStatsSelect aggregates visits, no-shows and last visit for each client.
+// Only confirmed appointments up to today, passed as $2, count; no-shows are
+// not visits.
+const clientStatsSelect = `
+	SELECT ` + clientStatsColumns + clientStatsFrom
+
+const clientStatsColumns = clientColumns + `,
+	       COUNT(a.id) FILTER (WHERE NOT a.no_show),
+	       COUNT(a.id) FILTER (WHERE a.no_show),
+	       MAX(a.date) FILTER (WHERE NOT a.no_show)`
+
+const clientStatsFrom = `
+	FROM clients c
+	LEFT JOIN appointments a ON a.client_id = c.id
+	     AND a.status = 'confirmed' AND a.date <= $2::date
+`
+
+// ClientKeyset lists the orders clients can be listed in
+var ClientKeyset = pagination.Keyset{
+	Sorts: map[string]pagination.Column{
+		"name":      {Expr: "lower(c.last_name || ' ' || c.first_name)", Type: "text"},
+		"createdAt": {Expr: "COALESCE(c.created_at, 'epoch')", Type: "timestamp"},
+	},
+	Default: "name",
+	ID:      pagination.Column{Expr: "c.id", Type: "bigint"},
+}
+
+// postgresClients is the ClientRepository backed by the clients table
+type postgresClients struct {
+	conn db.DBTX
+}
+
+func (r postgresClients) List(ctx context.Context, userID int64, page pagination.Request) ([]ClientSummary, pagination.Meta, error) {
+	var total int64
+	err := r.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM clients WHERE user_id = $1`, userID).Scan(&total)
+	if err != nil {
+		return nil, pagination.Meta{}, err
+	}
+
+	after, args := page.After(3)
+	rows, err := r.conn.QueryContext(ctx, `
+		SELECT `+clientStatsColumns+`, `+page.SortValue()+clientStatsFrom+`
+		WHERE c.user_id = $1 AND `+after+`
+		GROUP BY c.id
+		ORDER BY `+page.OrderBy()+page.LimitClause(),
+		append([]any{userID, Today().Format("2006-01-02")}, args...)...)
+	if err != nil {
+		return nil, pagination.Meta{}, err
+	}
+	defer rows.Close()
+
+	var out []ClientSummary
+	var values []string
+	for rows.Next() {
+		var value string
+		s, err := scanClientSummary(rows, &value)
+		if err != nil {
+			return nil, pagination.Meta{}, err
+		}
+		out = append(out, *s)
+		values = append(values, value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, pagination.Meta{}, err
+	}
+	out, meta := pagination.Finish(page, out, values, func(s ClientSummary) string { return strconv.FormatInt(s.ID, 10) }, total)
+
+	ids := make([]int64, len(out))
+	for i := range out {
+		ids[i] = out[i].ID
+	}
+	spent, err := getClientSpending(ctx, r.conn, userID, ids)
+	if err != nil {
+		return nil, pagination.Meta{}, err
+	}
+	for i := range out {
+		out[i].TotalSpent = spent[out[i].ID]
+		if out[i].TotalSpent == nil {
+			out[i].TotalSpent = []Money{}
+		}
+	}
+	return out, meta, nil
+}
+
+func (r postgresClients) Get(ctx context.Context, clientID, userID int64) (*ClientDetail, error) {
+	row := r.conn.QueryRowContext(ctx, clientStatsSelect+`
+		WHERE c.user_id = $1 AND c.id = $3
+		GROUP BY c.id
+	`, userID, Today().Format("2006-01-02"), clientID)
+	s, err := scanClientSummary(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	spent, err := getClientSpending(ctx, r.conn, userID, []int64{clientID})
+	if err != nil {
+		return nil, err
+	}
+	s.TotalSpent = spent[clientID]
+	if s.TotalSpent == nil {
+		s.TotalSpent = []Money{}
+	}
+
+	appointments, err := listAppointments(ctx, r.conn, userID, AppointmentFilter{ClientID: &clientID})
+	if err != nil {
+		return nil, err
+	}
+	// Newest first for the history view
+	for i, j := 0, len(appointments)-1; i < j; i, j = i+1, j-1 {
+		appointments[i], appointments[j] = appointments[j], appointments[i]
+	}
+	if appointments == nil {
+		appointments = []Appointment{}
+	}
+	return &ClientDetail{ClientSummary: *s, Appointments: appointments}, nil
+}
+
+// getClientSpending sums the price of attended, confirmed appointments up to
+// today per currency for each of the clients
+func getClientSpending(ctx context.Context, conn db.DBTX, userID int64, clientIDs []int64) (map[int64][]Money, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT client_id, currency, SUM(price_minor)
+		FROM appointments
+		WHERE user_id = $1 AND client_id = ANY($2)
+		  AND status = 'confirmed' AND NOT no_show
+		  AND date <= $3::date
+		  AND currency IS NOT NULL AND currency <> ''
+		GROUP BY client_id, currency
+		ORDER BY client_id, currency
+	`, userID, pq.Array(clientIDs), Today().Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[int64][]Money)
+	for rows.Next() {
+		var id int64
+		var m Money
+		if err := rows.Scan(&id, &m.Currency, &m.Amount); err != nil {
+			return nil, err
+		}
+		out[id] = append(out[id], m)
+	}
+	return out, rows.Err()
+}
+
+// Update saves the provider's edits to a client's details, notes and tags
+func (r postgresClients) Update(ctx context.Context, cl *Client) error {
+	if err := cl.Validate(); err != nil {
+		return err
+	}
+	tagsJSON, err := json.Marshal(cl.Tags)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.conn.ExecContext(ctx, `
+		UPDATE clients
+		SET first_name = $1, last_name = $2, email = $3, phone = $4, instagram = $5,
+		    email_normalized = $6, phone_normalized = $7, notes = $8, tags = $9, updated_at = NOW()
+		WHERE id = $10 AND user_id = $11
+	`, cl.FirstName, cl.LastName, cl.Email, cl.Phone, cl.Instagram,
+		NormalizeEmail(cl.Email), NormalizePhone(cl.Phone), cl.Notes, string(tagsJSON), cl.ID, cl.UserID)
+	if isUniqueViolation(err) {
+		return ErrClientExists
+	}
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrClientNotFound
+	}
+	return nil
+}
+
+// MergeClients folds a duplicate client into the target: appointments move
+// over, notes are appended, tags combined and missing details filled in.
+// The duplicate is deleted.
+func (r postgresClients) Merge(ctx context.Context, userID, targetID, sourceID int64) error {
+	if targetID == sourceID {
+		return &ValidationError{Field: "sourceId", Message: "cannot merge a client into itself"}
+	}
+
+	return db.WithTx(ctx, r.conn, func(tx *sql.Tx) error {
+		// Lock both in id order so concurrent merges cannot deadlock
+		clients := make(map[int64]*Client)
+		rows, err := tx.QueryContext(ctx, `
+			SELECT `+clientColumns+`
+			FROM clients c
+			WHERE c.user_id = $1 AND c.id IN ($2, $3)
+			ORDER BY c.id
+			FOR UPDATE
+		`, userID, targetID, sourceID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			cl, err := scanClient(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			clients[cl.ID] = cl
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		target, source := clients[targetID], clients[sourceID]
+		if target == nil || source == nil {
+			return ErrClientNotFound
+		}
+
+		if target.Email == "" {
+			target.Email = source.Email
+		}
+		if target.Phone == "" {
+			target.Phone = source.Phone
+		}
+		if target.Instagram == "" {
+			target.Instagram = source.Instagram
+		}
+		if target.FirstName == "" && target.LastName == "" {
+			target.FirstName, target.LastName = source.FirstName, source.LastName
+		}
+		if source.Notes != "" {
+			if target.Notes != "" {
+				target.Notes += "\n\n"
+			}
+			target.Notes += source.Notes
+		}
+		// Only the combined fields are checked: older records may predate contact validation
+		var errs ValidationErrors
+		target.Tags = normalizeTags(&errs, append(target.Tags, source.Tags...))
+		if len(target.Notes) > maxClientNotes {
+			errs.Add("notes", fmt.Sprintf("combined notes must be at most %d characters", maxClientNotes))
+		}
+		if err := errs.Err(); err != nil {
+			return err
+		}
+		tagsJSON, err := json.Marshal(target.Tags)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE appointments SET client_id = $1 WHERE client_id = $2`, targetID, sourceID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM clients WHERE id = $1`, sourceID); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE clients
+			SET first_name = $1, last_name = $2, email = $3, phone = $4, instagram = $5,
+			    email_normalized = $6, phone_normalized = $7, notes = $8, tags = $9, updated_at = NOW()
+			WHERE id = $10
+		`, target.FirstName, target.LastName, target.Email, target.Phone, target.Instagram,
+			NormalizeEmail(target.Email), NormalizePhone(target.Phone), target.Notes, string(tagsJSON), targetID)
+		return err
+	})
+}
+
+func scanClient(row rowScanner) (*Client, error) {
+	var cl Client
+	var tagsJSON []byte
+	err := row.Scan(&cl.ID, &cl.UserID, &cl.FirstName, &cl.LastName, &cl.Email, &cl.Phone, &cl.Instagram,
+		&cl.Notes, &tagsJSON, &cl.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(tagsJSON, &cl.Tags); err != nil {
+		return nil, fmt.Errorf("failed to decode tags JSON: %w", err)
+	}
+	if cl.Tags == nil {
+		cl.Tags = []string{}
+	}
+	return &cl, nil
+}
+
+// scanClientSummary scans a clientStatsSelect row followed by any extra columns
+func scanClientSummary(row rowScanner, extra ...any) (*ClientSummary, error) {
+	var s ClientSummary
+	var tagsJSON []byte
+	var lastVisit sql.NullTime
+	dest := []any{&s.ID, &s.UserID, &s.FirstName, &s.LastName, &s.Email, &s.Phone, &s.Instagram,
+		&s.Notes, &tagsJSON, &s.CreatedAt, &s.Visits, &s.NoShows, &lastVisit}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(tagsJSON, &s.Tags); err != nil {
+		return nil, fmt.Errorf("failed to decode tags JSON: %w", err)
+	}
+	if s.Tags == nil {
+		s.Tags = []string{}
+	}
+	if lastVisit.Valid {
+		day := lastVisit.Time.Format("2006-01-02")
+		s.LastVisit = &day
+	}
+	return &s, nil
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// ErrorKind classifies domain errors so the API layer can choose a status code
+type ErrorKind int
+
+const (
+	KindInternal ErrorKind = iota
+	KindNotFound
+	KindConflict
+	KindValidation
+	KindForbidden
+	KindUnauthorized
+	// KindUnavailable means a dependency such as the payment gateway failed
+	KindUnavailable
+	// KindTooManyRequests means the caller exceeded a rate limit
+	KindTooManyRequests
+)
+
+// Error is a domain error that is safe to show to clients. Code is a stable
+// machine-readable identifier; Message is for humans. The wrapped cause is
+// only ever logged.
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches any error with the same code, so sentinels still compare equal
+// after Wrap or when built with a more specific message
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Wrap returns a copy of the error carrying the underlying cause
+func (e *Error) Wrap(err error) *Error {
+	wrapped := *e
+	wrapped.Err = err
+	return &wrapped
+}
+
+func NotFound(code, message string) *Error {
+	return &Error{Kind: KindNotFound, Code: code, Message: message}
+}
+
+func Conflict(code, message string) *Error {
+	return &Error{Kind: KindConflict, Code: code, Message: message}
+}
+
+func Invalid(code, message string) *Error {
+	return &Error{Kind: KindValidation, Code: code, Message: message}
+}
+
+func Forbidden(code, message string) *Error {
+	return &Error{Kind: KindForbidden, Code: code, Message: message}
+}
+
+func Unauthorized(code, message string) *Error {
+	return &Error{Kind: KindUnauthorized, Code: code, Message: message}
+}
+
+func Unavailable(code, message string) *Error {
+	return &Error{Kind: KindUnavailable, Code: code, Message: message}
+}
+
+func TooManyRequests(code, message string) *Error {
+	return &Error{Kind: KindTooManyRequests, Code: code, Message: message}
+}
+
+var (
+	ErrUserNotFound        = NotFound("user_not_found", "user not found")
+	ErrEventNotFound       = NotFound("event_not_found", "event not found")
+	ErrAppointmentNotFound = NotFound("appointment_not_found", "appointment not found")
+	ErrPaymentNotFound     = NotFound("payment_not_found", "payment not found")
+	ErrSlotUnavailable     = Conflict("slot_unavailable", "no available timeslot for the requested time")
+	ErrNotCancellable      = Conflict("not_cancellable", "appointment can no longer be cancelled")
+	ErrEmailTaken          = Conflict("email_taken", "email already exists")
+	ErrAliasTaken          = Conflict("alias_taken", "alias already taken")
+	ErrInvalidCredentials  = Unauthorized("invalid_credentials", "invalid login and/or password")
+)
+
+// isUniqueViolation reports whether err is a Postgres unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
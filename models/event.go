@@ -1,9 +1,14 @@
 package models
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
 	"time"
 
 	"example.com/db"
+	"example.com/pagination"
 )
 
 type Event struct {
@@ -15,47 +20,78 @@ type Event struct {
 	UserID      int64
 }
 
-var events = []Event{}
+// postgresEvents is the EventRepository backed by the events table
+type postgresEvents struct {
+	conn db.DBTX
+}
 
-func (e *Event) Save() error {
+func (r postgresEvents) Create(ctx context.Context, e *Event) error {
 	query := `
 		INSERT INTO events(name, description, location, dateTime, user_id)
 		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id
 	`
 
-	err := db.DB.QueryRow(query, e.Name, e.Description, e.Location, e.DateTime, e.UserID).Scan(&e.ID)
+	err := r.conn.QueryRowContext(ctx, query, e.Name, e.Description, e.Location, e.DateTime, e.UserID).Scan(&e.ID)
 	return err
 }
 
-func GetAllEvents() ([]Event, error) {
-	query := "SELECT * FROM events"
-	rows, err := db.DB.Query(query)
+// EventKeyset lists the orders events can be listed in
+var EventKeyset = pagination.Keyset{
+	Sorts: map[string]pagination.Column{
+		"dateTime": {Expr: "dateTime", Type: "timestamp"},
+		"name":     {Expr: "name", Type: "text"},
+	},
+	Default: "dateTime",
+	ID:      pagination.Column{Expr: "id", Type: "bigint"},
+}
+
+func (r postgresEvents) List(ctx context.Context, page pagination.Request) ([]Event, pagination.Meta, error) {
+	var total int64
+	err := r.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM events").Scan(&total)
 	if err != nil {
-		return nil, err
+		return nil, pagination.Meta{}, err
+	}
+
+	after, args := page.After(1)
+	query := "SELECT id, name, description, location, dateTime, user_id, " + page.SortValue() +
+		" FROM events WHERE " + after + " ORDER BY " + page.OrderBy() + page.LimitClause()
+	rows, err := r.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, pagination.Meta{}, err
 	}
 	defer rows.Close()
 
 	var events []Event
+	var values []string
 	for rows.Next() {
 		var event Event
-		err := rows.Scan(&event.ID, &event.Name, &event.Description, &event.Location, &event.DateTime, &event.UserID)
+		var value string
+		err := rows.Scan(&event.ID, &event.Name, &event.Description, &event.Location, &event.DateTime, &event.UserID, &value)
 		if err != nil {
-			return nil, err
+			return nil, pagination.Meta{}, err
 		}
 
 		events = append(events, event)
+		values = append(values, value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, pagination.Meta{}, err
 	}
 
-	return events, nil
+	events, meta := pagination.Finish(page, events, values, func(e Event) string { return strconv.FormatInt(e.ID, 10) }, total)
+	return events, meta, nil
 }
 
-func GetEventById(id int64) (*Event, error) {
-	query := "SELECT * FROM events WHERE id = $1"
-	row := db.DB.QueryRow(query, id)
+func (r postgresEvents) GetByID(ctx context.Context, id int64) (*Event, error) {
+	query := "SELECT id, name, description, location, dateTime, user_id FROM events WHERE id = $1"
+	row := r.conn.QueryRowContext(ctx, query, id)
 
 	var event Event
 	err := row.Scan(&event.ID, &event.Name, &event.Description, &event.Location, &event.DateTime, &event.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrEventNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -63,64 +99,30 @@ func GetEventById(id int64) (*Event, error) {
 	return &event, nil
 }
 
-func (event Event) Update() error {
+func (r postgresEvents) Update(ctx context.Context, event *Event) error {
 	query := `
 		UPDATE events
 		SET name = $1, description = $2, location = $3, dateTime = $4
 		WHERE id = $5
 	`
-
-	stmt, err := db.DB.Prepare(query)
-
-	if err != nil {
-		return err
-	}
-
-	defer stmt.Close()
-
-	_, err = stmt.Exec(event.Name, event.Description, event.Location, event.DateTime, event.UserID)
+	_, err := r.conn.ExecContext(ctx, query, event.Name, event.Description, event.Location, event.DateTime, event.ID)
 	return err
 }
 
-func (event Event) Delete() error {
+func (r postgresEvents) Delete(ctx context.Context, id int64) error {
 	query := "DELETE FROM events WHERE id = $1"
-
-	stmt, err := db.DB.Prepare(query)
-
-	if err != nil {
-		return err
-	}
-
-	defer stmt.Close()
-
-	_, err = stmt.Exec(event.ID)
+	_, err := r.conn.ExecContext(ctx, query, id)
 	return err
 }
 
-func (e Event) Register(userId int64) error {
+func (r postgresEvents) Register(ctx context.Context, eventID, userID int64) error {
 	query := "INSERT INTO registrations(event_id, user_id) VALUES ($1, $2)"
-	stmt, err := db.DB.Prepare(query)
-
-	if err != nil {
-		return err
-	}
-
-	defer stmt.Close()
-
-	_, err = stmt.Exec(e.ID, e.UserID)
+	_, err := r.conn.ExecContext(ctx, query, eventID, userID)
 	return err
 }
 
-func (e Event) Unregister(userId int64) error {
+func (r postgresEvents) Unregister(ctx context.Context, eventID, userID int64) error {
 	query := "DELETE FROM registrations WHERE event_id = $1 AND user_id = $2"
-	stmt, err := db.DB.Prepare(query)
-
-	if err != nil {
-		return err
-	}
-
-	defer stmt.Close()
-
-	_, err = stmt.Exec(e.ID, e.UserID)
+	_, err := r.conn.ExecContext(ctx, query, eventID, userID)
 	return err
 }
@@ -0,0 +1,1148 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"example.com/pagination"
+	"example.com/utils"
+)
+
+// NewMemoryRepositories returns repositories keeping everything in memory,
+// for tests that exercise handlers without Postgres. Client records and
+// waitlist offers are not modelled: bookings are never matched to a client
+// and freed slots are never offered.
+func NewMemoryRepositories() Repositories {
+	s := &memoryStore{
+		users:           map[int64]User{},
+		services:        map[int64]Service{},
+		schedules:       map[int64]map[string][]TimeRange{},
+		appointments:    map[string]Appointment{},
+		events:          map[int64]Event{},
+		registrations:   map[[2]int64]bool{},
+		paymentSettings: map[int64]PaymentSettings{},
+		payments:        map[int64]Payment{},
+		holds:           map[string]SlotHold{},
+		waitlist:        map[string]WaitlistEntry{},
+		blocks:          map[int64]BlockEntry{},
+		rules:           map[int64]BookingRules{},
+	}
+	return s.repositories()
+}
+
+type memoryStore struct {
+	mu              sync.Mutex
+	nextID          int64
+	users           map[int64]User
+	services        map[int64]Service
+	schedules       map[int64]map[string][]TimeRange // user id -> YYYY-MM-DD -> ranges
+	appointments    map[string]Appointment
+	events          map[int64]Event
+	registrations   map[[2]int64]bool // event id, user id
+	paymentSettings map[int64]PaymentSettings
+	payments        map[int64]Payment
+	holds           map[string]SlotHold
+	waitlist        map[string]WaitlistEntry
+	blocks          map[int64]BlockEntry
+	rules           map[int64]BookingRules
+}
+
+func (s *memoryStore) repositories() Repositories {
+	return Repositories{
+		Users:        memoryUsers{s},
+		Services:     memoryServices{s},
+		Schedules:    memorySchedules{s},
+		Appointments: memoryAppointments{s},
+		Events:       memoryEvents{s},
+		Payments:     memoryPayments{s},
+		Clients:      memoryClients{},
+		Holds:        memorySlotHolds{s},
+		Waitlist:     memoryWaitlist{s},
+		Restrictions: memoryRestrictions{s},
+		inTx:         s.inTx,
+	}
+}
+
+func (s *memoryStore) id() int64 {
+	s.nextID++
+	return s.nextID
+}
+
+// inTx runs fn against the store and restores its previous contents if fn
+// fails. Unlike a database transaction it does not isolate concurrent callers.
+func (s *memoryStore) inTx(ctx context.Context, fn func(Repositories) error) error {
+	s.mu.Lock()
+	users, services, appointments := maps.Clone(s.users), maps.Clone(s.services), maps.Clone(s.appointments)
+	events, registrations := maps.Clone(s.events), maps.Clone(s.registrations)
+	paymentSettings, payments := maps.Clone(s.paymentSettings), maps.Clone(s.payments)
+	holds, waitlist := maps.Clone(s.holds), maps.Clone(s.waitlist)
+	blocks, rules := maps.Clone(s.blocks), maps.Clone(s.rules)
+	schedules := make(map[int64]map[string][]TimeRange, len(s.schedules))
+	for userID, days := range s.schedules {
+		schedules[userID] = maps.Clone(days)
+	}
+	s.mu.Unlock()
+
+	err := fn(s.repositories())
+	if err != nil {
+		s.mu.Lock()
+		s.users, s.services, s.appointments = users, services, appointments
+		s.events, s.registrations, s.schedules = events, registrations, schedules
+		s.paymentSettings, s.payments = paymentSettings, payments
+		s.holds, s.waitlist = holds, waitlist
+		s.blocks, s.rules = blocks, rules
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// memoryTime formats t so timestamps order correctly as strings
+func memoryTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000000")
+}
+
+// memoryInt formats n so non-negative numbers order correctly as strings
+func memoryInt(n int64) string {
+	return fmt.Sprintf("%020d", n)
+}
+
+type memoryUsers struct{ s *memoryStore }
+
+func (r memoryUsers) Create(ctx context.Context, u *User) error {
+	hashedPassword, err := utils.Hash(u.Password)
+	if err != nil {
+		return err
+	}
+	alias, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, existing := range r.s.users {
+		if existing.Email == u.Email {
+			return ErrEmailTaken
+		}
+	}
+	u.ID = r.s.id()
+	stored := *u
+	stored.Password = hashedPassword
+	stored.Alias = alias
+	r.s.users[u.ID] = stored
+	return nil
+}
+
+func (r memoryUsers) ValidateCredentials(ctx context.Context, u *User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, existing := range r.s.users {
+		if existing.Email == u.Email && existing.OAuthProvider == nil {
+			if !utils.CheckPasswordHash(u.Password, existing.Password) {
+				return ErrInvalidCredentials
+			}
+			u.ID = existing.ID
+			return nil
+		}
+	}
+	return ErrInvalidCredentials
+}
+
+func (r memoryUsers) GetByAlias(ctx context.Context, alias string) (*User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, existing := range r.s.users {
+		if existing.Alias == alias {
+			return &User{ID: existing.ID, Email: existing.Email, Alias: existing.Alias}, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (r memoryUsers) GetAlias(ctx context.Context, userID int64) (string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	u, ok := r.s.users[userID]
+	if !ok {
+		return "", ErrUserNotFound
+	}
+	return u.Alias, nil
+}
+
+func (r memoryUsers) UpdateAlias(ctx context.Context, userID int64, alias string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	u, ok := r.s.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	for _, existing := range r.s.users {
+		if existing.ID != userID && existing.Alias == alias {
+			return ErrAliasTaken
+		}
+	}
+	u.Alias = alias
+	r.s.users[userID] = u
+	return nil
+}
+
+func (r memoryUsers) FindOrCreateOAuth(ctx context.Context, oauthUser *OAuthUser) (*User, error) {
+	alias, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, existing := range r.s.users {
+		if existing.OAuthProvider != nil && *existing.OAuthProvider == oauthUser.OAuthProvider &&
+			existing.OAuthProviderID != nil && *existing.OAuthProviderID == oauthUser.OAuthProviderID {
+			return &User{ID: existing.ID, Email: existing.Email, Alias: existing.Alias, Name: existing.Name}, nil
+		}
+	}
+
+	provider, providerID := oauthUser.OAuthProvider, oauthUser.OAuthProviderID
+	for _, existing := range r.s.users {
+		if existing.Email == oauthUser.Email {
+			existing.OAuthProvider, existing.OAuthProviderID = &provider, &providerID
+			if existing.Name == nil {
+				existing.Name = &oauthUser.Name
+			}
+			r.s.users[existing.ID] = existing
+			return &User{ID: existing.ID, Email: existing.Email, Alias: existing.Alias, Name: existing.Name}, nil
+		}
+	}
+
+	u := User{
+		ID:              r.s.id(),
+		Email:           oauthUser.Email,
+		Alias:           alias,
+		Name:            &oauthUser.Name,
+		OAuthProvider:   &provider,
+		OAuthProviderID: &providerID,
+	}
+	r.s.users[u.ID] = u
+	return &User{ID: u.ID, Email: u.Email, Alias: u.Alias, Name: u.Name}, nil
+}
+
+type memoryServices struct{ s *memoryStore }
+
+func (r memoryServices) List(ctx context.Context, userID int64, page pagination.Request) ([]Service, pagination.Meta, error) {
+	r.s.mu.Lock()
+	var services []Service
+	for _, service := range r.s.services {
+		if service.UserID == userID {
+			services = append(services, withOptions(service))
+		}
+	}
+	r.s.mu.Unlock()
+
+	services, meta := pagination.Slice(page, services, func(s Service, key string) string {
+		switch key {
+		case "name":
+			return s.Name
+		case "price":
+			return memoryInt(s.priceMinor)
+		case "duration":
+			return memoryInt(s.Duration)
+		}
+		if s.Timestamp == nil {
+			return memoryTime(time.Unix(0, 0))
+		}
+		return memoryTime(*s.Timestamp)
+	}, func(s Service) string { return memoryInt(s.ID) })
+	return services, meta, nil
+}
+
+// withOptions returns the service with empty rather than nil option lists,
+// as the Postgres repository does
+func withOptions(s Service) Service {
+	if s.Media == nil {
+		s.Media = []MediaItem{}
+	}
+	if s.Variants == nil {
+		s.Variants = []ServiceOption{}
+	}
+	if s.AddOns == nil {
+		s.AddOns = []ServiceOption{}
+	}
+	return s
+}
+
+func (r memoryServices) GetByID(ctx context.Context, id, userID int64) (*Service, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	service, ok := r.s.services[id]
+	if !ok || service.UserID != userID {
+		return nil, ErrServiceNotFound
+	}
+	service = withOptions(service)
+	return &service, nil
+}
+
+func (r memoryServices) Create(ctx context.Context, s *Service) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	s.ID = r.s.id()
+	r.s.services[s.ID] = *s
+	return nil
+}
+
+func (r memoryServices) Update(ctx context.Context, s *Service) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	existing, ok := r.s.services[s.ID]
+	if !ok || existing.UserID != s.UserID {
+		return nil
+	}
+	now := time.Now().UTC()
+	updated := *s
+	updated.Media = existing.Media
+	updated.Timestamp = &now
+	r.s.services[s.ID] = updated
+	return nil
+}
+
+func (r memoryServices) SaveMedia(ctx context.Context, s *Service) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	now := time.Now().UTC()
+	s.Timestamp = &now
+	existing, ok := r.s.services[s.ID]
+	if !ok || existing.UserID != s.UserID {
+		return nil
+	}
+	existing.Media = s.Media
+	existing.Timestamp = s.Timestamp
+	r.s.services[s.ID] = existing
+	return nil
+}
+
+func (r memoryServices) Delete(ctx context.Context, id, userID int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	service, ok := r.s.services[id]
+	if !ok || service.UserID != userID {
+		return ErrServiceNotFound
+	}
+	delete(r.s.services, id)
+	return nil
+}
+
+// optionList returns the service's list of options of the kind
+func optionList(s *Service, kind OptionKind) *[]ServiceOption {
+	if kind == OptionVariant {
+		return &s.Variants
+	}
+	return &s.AddOns
+}
+
+func (r memoryServices) CreateOption(ctx context.Context, kind OptionKind, opt *ServiceOption, userID int64) error {
+	if _, err := kind.table(); err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	service, ok := r.s.services[opt.ServiceID]
+	if !ok || service.UserID != userID {
+		return ErrServiceNotFound
+	}
+	if err := opt.Validate(kind, service.Currency); err != nil {
+		return err
+	}
+	opt.ID = r.s.id()
+	options := optionList(&service, kind)
+	*options = sortOptions(append(slices.Clone(*options), *opt))
+	r.s.services[service.ID] = service
+	return nil
+}
+
+func (r memoryServices) UpdateOption(ctx context.Context, kind OptionKind, opt *ServiceOption, userID int64) error {
+	if _, err := kind.table(); err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	service, ok := r.s.services[opt.ServiceID]
+	if !ok || service.UserID != userID {
+		return ErrOptionNotFound
+	}
+	if err := opt.Validate(kind, service.Currency); err != nil {
+		return err
+	}
+	options := optionList(&service, kind)
+	i := slices.IndexFunc(*options, func(o ServiceOption) bool { return o.ID == opt.ID })
+	if i < 0 {
+		return ErrOptionNotFound
+	}
+	updated := slices.Clone(*options)
+	updated[i] = *opt
+	*options = sortOptions(updated)
+	r.s.services[service.ID] = service
+	return nil
+}
+
+func (r memoryServices) DeleteOption(ctx context.Context, kind OptionKind, serviceID, optionID, userID int64) error {
+	if _, err := kind.table(); err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	service, ok := r.s.services[serviceID]
+	if !ok || service.UserID != userID {
+		return ErrOptionNotFound
+	}
+	options := optionList(&service, kind)
+	i := slices.IndexFunc(*options, func(o ServiceOption) bool { return o.ID == optionID })
+	if i < 0 {
+		return ErrOptionNotFound
+	}
+	*options = slices.Delete(slices.Clone(*options), i, i+1)
+	r.s.services[service.ID] = service
+	return nil
+}
+
+// sortOptions orders options as the Postgres repository lists them
+func sortOptions(options []ServiceOption) []ServiceOption {
+	sort.SliceStable(options, func(i, j int) bool {
+		if options[i].Position != options[j].Position {
+			return options[i].Position < options[j].Position
+		}
+		return options[i].ID < options[j].ID
+	})
+	return options
+}
+
+type memorySchedules struct{ s *memoryStore }
+
+func (r memorySchedules) Get(ctx context.Context, userID int64, date time.Time) ([]TimeRange, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	ranges := r.s.schedules[userID][date.UTC().Format("2006-01-02")]
+	if len(ranges) == 0 {
+		return nil, nil
+	}
+	return append([]TimeRange(nil), ranges...), nil
+}
+
+func (r memorySchedules) GetRange(ctx context.Context, userID int64, start time.Time, days int) (ScheduleByDate, error) {
+	if days <= 0 {
+		days = 1
+	}
+	startDay := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	out := make(ScheduleByDate)
+	for i := 0; i < days; i++ {
+		key := startDay.AddDate(0, 0, i).Format("2006-01-02")
+		if ranges := r.s.schedules[userID][key]; len(ranges) > 0 {
+			out[key] = append([]TimeRange(nil), ranges...)
+		}
+	}
+	return out, nil
+}
+
+func (r memorySchedules) Save(ctx context.Context, userID int64, date time.Time, ranges []TimeRangePayload) ([]TimeRange, error) {
+	norm, err := normalizeAndValidate(ranges)
+	if err != nil {
+		return nil, err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	inserted := make([]TimeRange, 0, len(norm))
+	for _, n := range norm {
+		inserted = append(inserted, TimeRange{ID: r.s.id(), StartTime: n.Start, EndTime: n.End})
+	}
+	r.s.setDay(userID, date.UTC().Format("2006-01-02"), inserted)
+	return append([]TimeRange(nil), inserted...), nil
+}
+
+// setDay replaces a day of the user's schedule, keeping it in start order.
+// The caller holds s.mu.
+func (s *memoryStore) setDay(userID int64, day string, ranges []TimeRange) {
+	if s.schedules[userID] == nil {
+		s.schedules[userID] = map[string][]TimeRange{}
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].StartTime < ranges[j].StartTime })
+	s.schedules[userID][day] = ranges
+}
+
+// carve removes [start, end) from the range containing it, like carveSlot.
+// The caller holds s.mu.
+func (s *memoryStore) carve(userID int64, day, start, end string) error {
+	ranges := s.schedules[userID][day]
+	for i, tr := range ranges {
+		if tr.StartTime > start || tr.EndTime < end {
+			continue
+		}
+		remaining := append(append([]TimeRange(nil), ranges[:i]...), ranges[i+1:]...)
+		if tr.StartTime != start {
+			remaining = append(remaining, TimeRange{ID: s.id(), StartTime: tr.StartTime, EndTime: start})
+		}
+		if end != tr.EndTime {
+			remaining = append(remaining, TimeRange{ID: s.id(), StartTime: end, EndTime: tr.EndTime})
+		}
+		s.setDay(userID, day, remaining)
+		return nil
+	}
+	return ErrSlotUnavailable
+}
+
+// restore gives [start, end) back to the schedule, merging it with the ranges
+// it touches, like restoreAndMergeSlot. The caller holds s.mu.
+func (s *memoryStore) restore(userID int64, day, start, end string) {
+	merged := TimeRange{ID: s.id(), StartTime: start, EndTime: end}
+	var remaining []TimeRange
+	for _, tr := range s.schedules[userID][day] {
+		if tr.EndTime == start || tr.StartTime == end {
+			merged.StartTime = min(merged.StartTime, tr.StartTime)
+			merged.EndTime = max(merged.EndTime, tr.EndTime)
+			continue
+		}
+		remaining = append(remaining, tr)
+	}
+	s.setDay(userID, day, append(remaining, merged))
+}
+
+type memoryAppointments struct{ s *memoryStore }
+
+func (r memoryAppointments) Create(ctx context.Context, appt *Appointment) error {
+	if appt.Status == "" {
+		appt.Status = StatusConfirmed
+	}
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+	id, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if appt.HoldID != "" {
+		err = r.s.consumeHold(appt)
+	} else {
+		err = r.s.carve(appt.UserID, appt.Date, appt.StartTime, appt.EndTime)
+	}
+	if err != nil {
+		return err
+	}
+	appt.ID = id
+	appt.CancelToken = token
+	appt.CreatedAt = time.Now().UTC()
+	items := make([]AppointmentItem, len(appt.Items))
+	for i, item := range appt.Items {
+		item.ID = r.s.id()
+		items[i] = item
+	}
+	appt.Items = items
+
+	r.s.appointments[appt.ID] = *appt
+	return nil
+}
+
+func (r memoryAppointments) List(ctx context.Context, userID int64, filter AppointmentFilter, page pagination.Request) ([]Appointment, pagination.Meta, error) {
+	r.s.mu.Lock()
+	var appointments []Appointment
+	for _, a := range r.s.appointments {
+		switch {
+		case a.UserID != userID,
+			filter.ClientID != nil && (a.ClientID == nil || *a.ClientID != *filter.ClientID),
+			filter.From != "" && a.Date < filter.From,
+			filter.To != "" && a.Date > filter.To,
+			filter.Status != "" && a.Status != filter.Status:
+			continue
+		}
+		a.CancelToken = ""
+		appointments = append(appointments, a)
+	}
+	r.s.mu.Unlock()
+
+	appointments, meta := pagination.Slice(page, appointments, func(a Appointment, key string) string {
+		if key == "createdAt" {
+			return memoryTime(a.CreatedAt)
+		}
+		return a.Date + " " + a.StartTime
+	}, func(a Appointment) string { return a.ID })
+	return appointments, meta, nil
+}
+
+func (r memoryAppointments) Delete(ctx context.Context, appointmentID string, userID int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	a, ok := r.s.appointments[appointmentID]
+	if !ok || a.UserID != userID {
+		return ErrAppointmentNotFound
+	}
+	delete(r.s.appointments, appointmentID)
+	if a.Status != StatusExpired {
+		r.s.restore(userID, a.Date, a.StartTime, a.EndTime)
+	}
+	return nil
+}
+
+// Release is Delete: freed slots are never offered here
+func (r memoryAppointments) Release(ctx context.Context, appointmentID string, userID int64) error {
+	return r.Delete(ctx, appointmentID, userID)
+}
+
+func (r memoryAppointments) SetNoShow(ctx context.Context, appointmentID string, userID int64, noShow bool) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	a, ok := r.s.appointments[appointmentID]
+	if !ok || a.UserID != userID {
+		return ErrAppointmentNotFound
+	}
+	if err := a.checkNoShow(noShow); err != nil {
+		return err
+	}
+	a.NoShow = noShow
+	r.s.appointments[appointmentID] = a
+	return nil
+}
+
+func (r memoryAppointments) GetForClient(ctx context.Context, appointmentID string, userID int64, cancelToken string) (*Appointment, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	a, ok := r.s.appointments[appointmentID]
+	if !ok || a.UserID != userID || a.CancelToken != cancelToken {
+		return nil, ErrAppointmentNotFound
+	}
+	return &Appointment{ID: a.ID, UserID: a.UserID, Date: a.Date, StartTime: a.StartTime, EndTime: a.EndTime, Status: a.Status, NoShow: a.NoShow}, nil
+}
+
+type memoryEvents struct{ s *memoryStore }
+
+func (r memoryEvents) List(ctx context.Context, page pagination.Request) ([]Event, pagination.Meta, error) {
+	r.s.mu.Lock()
+	events := make([]Event, 0, len(r.s.events))
+	for _, e := range r.s.events {
+		events = append(events, e)
+	}
+	r.s.mu.Unlock()
+
+	events, meta := pagination.Slice(page, events, func(e Event, key string) string {
+		if key == "name" {
+			return e.Name
+		}
+		return memoryTime(e.DateTime)
+	}, func(e Event) string { return memoryInt(e.ID) })
+	return events, meta, nil
+}
+
+func (r memoryEvents) GetByID(ctx context.Context, id int64) (*Event, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	e, ok := r.s.events[id]
+	if !ok {
+		return nil, ErrEventNotFound
+	}
+	return &e, nil
+}
+
+func (r memoryEvents) Create(ctx context.Context, e *Event) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	e.ID = r.s.id()
+	r.s.events[e.ID] = *e
+	return nil
+}
+
+func (r memoryEvents) Update(ctx context.Context, e *Event) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	existing, ok := r.s.events[e.ID]
+	if !ok {
+		return nil
+	}
+	existing.Name, existing.Description, existing.Location, existing.DateTime = e.Name, e.Description, e.Location, e.DateTime
+	r.s.events[e.ID] = existing
+	return nil
+}
+
+func (r memoryEvents) Delete(ctx context.Context, id int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	delete(r.s.events, id)
+	for key := range r.s.registrations {
+		if key[0] == id {
+			delete(r.s.registrations, key)
+		}
+	}
+	return nil
+}
+
+func (r memoryEvents) Register(ctx context.Context, eventID, userID int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if _, ok := r.s.events[eventID]; !ok {
+		return ErrEventNotFound
+	}
+	r.s.registrations[[2]int64{eventID, userID}] = true
+	return nil
+}
+
+func (r memoryEvents) Unregister(ctx context.Context, eventID, userID int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	delete(r.s.registrations, [2]int64{eventID, userID})
+	return nil
+}
+
+type memoryPayments struct{ s *memoryStore }
+
+func (r memoryPayments) GetSettings(ctx context.Context, userID int64) (PaymentSettings, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if settings, ok := r.s.paymentSettings[userID]; ok {
+		return settings, nil
+	}
+	return DefaultPaymentSettings(), nil
+}
+
+func (r memoryPayments) SaveSettings(ctx context.Context, userID int64, settings PaymentSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.s.paymentSettings[userID] = settings
+	return nil
+}
+
+func (r memoryPayments) Create(ctx context.Context, p *Payment) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	p.ID = r.s.id()
+	p.Status = PaymentPending
+	p.CreatedAt = time.Now().UTC()
+	r.s.payments[p.ID] = *p
+	return nil
+}
+
+// byCheckout returns the payment for a checkout. The caller holds s.mu.
+func (s *memoryStore) byCheckout(checkoutID string) (Payment, error) {
+	for _, p := range s.payments {
+		if p.CheckoutID == checkoutID {
+			return p, nil
+		}
+	}
+	return Payment{}, ErrPaymentNotFound
+}
+
+func (r memoryPayments) Confirm(ctx context.Context, checkoutID, paymentID string) (*Payment, PaymentOutcome, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	p, err := r.s.byCheckout(checkoutID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if p.Status != PaymentPending && p.Status != PaymentExpired {
+		return &p, PaymentDuplicate, nil
+	}
+	p.PaymentID = paymentID
+	a, ok := r.s.appointments[p.AppointmentID]
+	if !ok || a.Status != StatusPendingPayment {
+		p.Status = PaymentRefundDue
+		r.s.payments[p.ID] = p
+		return &p, PaymentLate, nil
+	}
+	p.Status = PaymentPaid
+	r.s.payments[p.ID] = p
+
+	a.Status = StatusConfirmed
+	a.HoldExpiresAt = nil
+	r.s.appointments[a.ID] = a
+	return &p, PaymentConfirmed, nil
+}
+
+func (r memoryPayments) Fail(ctx context.Context, checkoutID, status string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	p, err := r.s.byCheckout(checkoutID)
+	if err != nil {
+		return err
+	}
+	if p.Status != PaymentPending {
+		return nil
+	}
+	p.Status = status
+	r.s.payments[p.ID] = p
+	r.s.releasePending(p.AppointmentID)
+	return nil
+}
+
+// releasePending expires an unpaid appointment and gives its slot back, like
+// releasePendingAppointment. The caller holds s.mu.
+func (s *memoryStore) releasePending(appointmentID string) {
+	a, ok := s.appointments[appointmentID]
+	if !ok || a.Status != StatusPendingPayment {
+		return
+	}
+	a.Status = StatusExpired
+	a.HoldExpiresAt = nil
+	s.appointments[a.ID] = a
+	s.restore(a.UserID, a.Date, a.StartTime, a.EndTime)
+}
+
+func (r memoryPayments) MarkRefundDue(ctx context.Context, appointmentID string, userID int64) (*Payment, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for id, p := range r.s.payments {
+		if p.AppointmentID == appointmentID && p.UserID == userID && p.Status == PaymentPaid {
+			p.Status = PaymentRefundDue
+			r.s.payments[id] = p
+			return &p, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r memoryPayments) ListRefundDue(ctx context.Context) ([]Payment, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	var due []Payment
+	for _, p := range r.s.payments {
+		if p.Status == PaymentRefundDue {
+			due = append(due, p)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+	return due, nil
+}
+
+func (r memoryPayments) MarkRefunded(ctx context.Context, id int64, refundID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if p, ok := r.s.payments[id]; ok && p.Status == PaymentRefundDue {
+		p.Status = PaymentRefunded
+		r.s.payments[id] = p
+	}
+	return nil
+}
+
+func (r memoryPayments) ExpireUnpaid(ctx context.Context) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	now := time.Now().UTC()
+	expired := 0
+	for _, a := range r.s.appointments {
+		if a.Status != StatusPendingPayment || a.HoldExpiresAt == nil || !a.HoldExpiresAt.Before(now) {
+			continue
+		}
+		for id, p := range r.s.payments {
+			if p.AppointmentID == a.ID && p.Status == PaymentPending {
+				p.Status = PaymentExpired
+				r.s.payments[id] = p
+			}
+		}
+		r.s.releasePending(a.ID)
+		expired++
+	}
+	return expired, nil
+}
+
+// memoryClients stands in for client records, which the in-memory
+// repositories don't keep
+type memoryClients struct{}
+
+func (memoryClients) List(ctx context.Context, userID int64, page pagination.Request) ([]ClientSummary, pagination.Meta, error) {
+	clients, meta := pagination.Slice(page, []ClientSummary(nil), func(ClientSummary, string) string { return "" },
+		func(s ClientSummary) string { return memoryInt(s.ID) })
+	return clients, meta, nil
+}
+
+func (memoryClients) Get(ctx context.Context, clientID, userID int64) (*ClientDetail, error) {
+	return nil, ErrClientNotFound
+}
+
+func (memoryClients) Update(ctx context.Context, cl *Client) error {
+	if err := cl.Validate(); err != nil {
+		return err
+	}
+	return ErrClientNotFound
+}
+
+func (memoryClients) Merge(ctx context.Context, userID, targetID, sourceID int64) error {
+	return ErrClientNotFound
+}
+
+type memorySlotHolds struct{ s *memoryStore }
+
+func (r memorySlotHolds) Create(ctx context.Context, hold *SlotHold) error {
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+	id, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	now := time.Now().UTC()
+	var byIP, byProvider int
+	for _, h := range r.s.holds {
+		if h.ExpiresAt.After(now) && h.IP == hold.IP {
+			byIP++
+		}
+		if h.ExpiresAt.After(now) && h.UserID == hold.UserID {
+			byProvider++
+		}
+	}
+	if byIP >= MaxHoldsPerIP || byProvider >= MaxHoldsPerProvider {
+		return ErrTooManyHolds
+	}
+	if err := r.s.carve(hold.UserID, hold.Date, hold.StartTime, hold.EndTime); err != nil {
+		return err
+	}
+	hold.ID = id
+	hold.Token = token
+	hold.ExpiresAt = time.Now().UTC().Add(SlotHoldDuration)
+	r.s.holds[hold.ID] = *hold
+	return nil
+}
+
+func (r memorySlotHolds) Release(ctx context.Context, holdID string, userID int64, token string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	hold, ok := r.s.holds[holdID]
+	if !ok || hold.UserID != userID || hold.Token != token {
+		return ErrHoldNotFound
+	}
+	delete(r.s.holds, holdID)
+	r.s.restore(hold.UserID, hold.Date, hold.StartTime, hold.EndTime)
+	return nil
+}
+
+func (r memorySlotHolds) Expire(ctx context.Context) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	now := time.Now().UTC()
+	released := 0
+	for id, hold := range r.s.holds {
+		if hold.ExpiresAt.Before(now) {
+			delete(r.s.holds, id)
+			r.s.restore(hold.UserID, hold.Date, hold.StartTime, hold.EndTime)
+			released++
+		}
+	}
+	return released, nil
+}
+
+// consumeHold turns the client's hold into the appointment's slot, like
+// consumeSlotHold. The caller holds s.mu.
+func (s *memoryStore) consumeHold(appt *Appointment) error {
+	hold, ok := s.holds[appt.HoldID]
+	if !ok || hold.UserID != appt.UserID || hold.Token != appt.HoldToken || time.Now().UTC().After(hold.ExpiresAt) {
+		return ErrHoldExpired
+	}
+	if hold.Date != appt.Date || hold.StartTime != appt.StartTime || hold.EndTime != appt.EndTime {
+		return Invalid("hold_mismatch", fmt.Sprintf("booking does not match the held slot (%s %s-%s)", hold.Date, hold.StartTime, hold.EndTime))
+	}
+	delete(s.holds, hold.ID)
+	return nil
+}
+
+type memoryWaitlist struct{ s *memoryStore }
+
+func (r memoryWaitlist) Create(ctx context.Context, e *WaitlistEntry) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+	id, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	service, ok := r.s.services[e.ServiceID]
+	if !ok || service.UserID != e.UserID {
+		return ErrServiceNotFound
+	}
+	if _, _, _, err := service.ResolveSelection(e.VariantID, e.AddOnIDs); err != nil {
+		return err
+	}
+	e.ID = id
+	e.Token = token
+	e.Status = WaitlistWaiting
+	e.CreatedAt = time.Now().UTC()
+	r.s.waitlist[e.ID] = *e
+	return nil
+}
+
+func (r memoryWaitlist) List(ctx context.Context, userID int64) ([]WaitlistEntry, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	today := Today().Format("2006-01-02")
+	var out []WaitlistEntry
+	for _, e := range r.s.waitlist {
+		if e.UserID == userID && e.Status == WaitlistWaiting && e.DateTo >= today {
+			e.Token = ""
+			out = append(out, e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (r memoryWaitlist) Leave(ctx context.Context, entryID string, userID int64, token string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	e, ok := r.s.waitlist[entryID]
+	if !ok || e.UserID != userID || e.Token != token || e.Status != WaitlistWaiting {
+		return ErrWaitlistEntryNotFound
+	}
+	e.Status = WaitlistCancelled
+	r.s.waitlist[entryID] = e
+	return nil
+}
+
+func (r memoryWaitlist) GetOffer(ctx context.Context, entryID string, userID int64, offerToken string) (*WaitlistEntry, error) {
+	return nil, ErrWaitlistOfferNotFound
+}
+
+func (r memoryWaitlist) MarkBooked(ctx context.Context, entryID, offerToken, appointmentID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	e, ok := r.s.waitlist[entryID]
+	if !ok || e.Status != WaitlistWaiting || e.Offer == nil || e.Offer.Token != offerToken || !e.Offer.ExpiresAt.After(time.Now()) {
+		return ErrWaitlistOfferNotFound
+	}
+	e.Status = WaitlistBooked
+	e.Offer = nil
+	r.s.waitlist[entryID] = e
+	return nil
+}
+
+func (r memoryWaitlist) OfferFreedSlots(ctx context.Context) ([]WaitlistOffer, error) {
+	return nil, nil
+}
+
+type memoryRestrictions struct{ s *memoryStore }
+
+func (r memoryRestrictions) ListBlocks(ctx context.Context, userID int64) ([]BlockEntry, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	var out []BlockEntry
+	for _, b := range r.s.blocks {
+		if b.UserID == userID {
+			out = append(out, b)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (r memoryRestrictions) CreateBlock(ctx context.Context, b *BlockEntry) error {
+	if err := b.Validate(); err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for id, existing := range r.s.blocks {
+		if existing.UserID == b.UserID && existing.Kind == b.Kind && existing.Value == b.Value {
+			existing.Reason = b.Reason
+			r.s.blocks[id] = existing
+			*b = existing
+			return nil
+		}
+	}
+	b.ID = r.s.id()
+	b.CreatedAt = time.Now().UTC()
+	r.s.blocks[b.ID] = *b
+	return nil
+}
+
+func (r memoryRestrictions) DeleteBlock(ctx context.Context, id, userID int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	b, ok := r.s.blocks[id]
+	if !ok || b.UserID != userID {
+		return ErrBlockNotFound
+	}
+	delete(r.s.blocks, id)
+	return nil
+}
+
+func (r memoryRestrictions) GetRules(ctx context.Context, userID int64) (BookingRules, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return r.s.rules[userID], nil
+}
+
+func (r memoryRestrictions) SaveRules(ctx context.Context, userID int64, rules BookingRules) error {
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.s.rules[userID] = rules
+	return nil
+}
+
+// Check applies the blocklist and rules like the Postgres repository, with
+// the client's history matched on the appointments' own contact details
+func (r memoryRestrictions) Check(ctx context.Context, userID int64, email, phone, ip string) (BookingCheck, error) {
+	var check BookingCheck
+	email, phone = NormalizeEmail(email), NormalizePhone(phone)
+	if parsed := net.ParseIP(ip); parsed != nil {
+		ip = parsed.String()
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, b := range r.s.blocks {
+		if b.UserID != userID {
+			continue
+		}
+		if b.Kind == BlockEmail && b.Value == email || b.Kind == BlockPhone && b.Value == phone || b.Kind == BlockIP && b.Value == ip {
+			return check, ErrBookingRestricted
+		}
+	}
+
+	rules := r.s.rules[userID]
+	today := Today().Format("2006-01-02")
+	var noShows, futureBookings int
+	for _, a := range r.s.appointments {
+		sameClient := email != "" && NormalizeEmail(a.Email) == email || phone != "" && NormalizePhone(a.Phone) == phone
+		if a.UserID != userID || !sameClient {
+			continue
+		}
+		if a.NoShow {
+			noShows++
+		}
+		if (a.Status == StatusConfirmed || a.Status == StatusPendingPayment) && a.Date >= today {
+			futureBookings++
+		}
+	}
+	if rules.MaxFutureBookings > 0 && futureBookings >= rules.MaxFutureBookings {
+		return check, ErrBookingRestricted
+	}
+	if rules.PrepayAfterNoShows > 0 && noShows >= rules.PrepayAfterNoShows {
+		check.RequirePrepayment = true
+	}
+	return check, nil
+}
@@ -0,0 +1,206 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"example.com/db"
+)
+
+// currencyExponents maps active ISO 4217 codes to their number of minor unit digits
+var currencyExponents = map[string]int{
+	"AED": 2, "AFN": 2, "ALL": 2, "AMD": 2, "ANG": 2, "AOA": 2, "ARS": 2, "AUD": 2, "AWG": 2, "AZN": 2,
+	"BAM": 2, "BBD": 2, "BDT": 2, "BGN": 2, "BHD": 3, "BIF": 0, "BMD": 2, "BND": 2, "BOB": 2, "BRL": 2,
+	"BSD": 2, "BTN": 2, "BWP": 2, "BYN": 2, "BZD": 2, "CAD": 2, "CDF": 2, "CHF": 2, "CLF": 4, "CLP": 0,
+	"CNY": 2, "COP": 2, "CRC": 2, "CUP": 2, "CVE": 2, "CZK": 2, "DJF": 0, "DKK": 2, "DOP": 2, "DZD": 2,
+	"EGP": 2, "ERN": 2, "ETB": 2, "EUR": 2, "FJD": 2, "FKP": 2, "GBP": 2, "GEL": 2, "GHS": 2, "GIP": 2,
+	"GMD": 2, "GNF": 0, "GTQ": 2, "GYD": 2, "HKD": 2, "HNL": 2, "HTG": 2, "HUF": 2, "IDR": 2, "ILS": 2,
+	"INR": 2, "IQD": 3, "IRR": 2, "ISK": 0, "JMD": 2, "JOD": 3, "JPY": 0, "KES": 2, "KGS": 2, "KHR": 2,
+	"KMF": 0, "KPW": 2, "KRW": 0, "KWD": 3, "KYD": 2, "KZT": 2, "LAK": 2, "LBP": 2, "LKR": 2, "LRD": 2,
+	"LSL": 2, "LYD": 3, "MAD": 2, "MDL": 2, "MGA": 2, "MKD": 2, "MMK": 2, "MNT": 2, "MOP": 2, "MRU": 2,
+	"MUR": 2, "MVR": 2, "MWK": 2, "MXN": 2, "MYR": 2, "MZN": 2, "NAD": 2, "NGN": 2, "NIO": 2, "NOK": 2,
+	"NPR": 2, "NZD": 2, "OMR": 3, "PAB": 2, "PEN": 2, "PGK": 2, "PHP": 2, "PKR": 2, "PLN": 2, "PYG": 0,
+	"QAR": 2, "RON": 2, "RSD": 2, "RUB": 2, "RWF": 0, "SAR": 2, "SBD": 2, "SCR": 2, "SDG": 2, "SEK": 2,
+	"SGD": 2, "SHP": 2, "SLE": 2, "SOS": 2, "SRD": 2, "SSP": 2, "STN": 2, "SVC": 2, "SYP": 2, "SZL": 2,
+	"THB": 2, "TJS": 2, "TMT": 2, "TND": 3, "TOP": 2, "TRY": 2, "TTD": 2, "TWD": 2, "TZS": 2, "UAH": 2,
+	"UGX": 0, "USD": 2, "UYU": 2, "UYW": 4, "UZS": 2, "VES": 2, "VND": 0, "VUV": 0, "WST": 2, "XAF": 0,
+	"XCD": 2, "XOF": 0, "XPF": 0, "YER": 2, "ZAR": 2, "ZMW": 2, "ZWL": 2,
+}
+
+// Legacy service currencies are migrated to the codes listed here
+func init() {
+	for code := range currencyExponents {
+		db.CurrencyCodes = append(db.CurrencyCodes, code)
+	}
+}
+
+// NormalizeCurrency upper-cases the code and checks it is a known ISO 4217 currency
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if _, ok := currencyExponents[code]; !ok {
+		return "", &ValidationError{Field: "currency", Message: fmt.Sprintf("unknown ISO 4217 currency %q", code)}
+	}
+	return code, nil
+}
+
+// Decimal is an amount in major currency units ("12.50") as sent and returned by
+// the API. It accepts a JSON number or string and is always written as a number.
+type Decimal string
+
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	s := strings.TrimSpace(string(b))
+	if s == "null" {
+		*d = ""
+		return nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+	}
+	*d = Decimal(strings.TrimSpace(s))
+	return nil
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	if d == "" {
+		return []byte("0"), nil
+	}
+	// Unvalidated input is echoed back as a string rather than producing invalid JSON
+	if !isDecimal(string(d)) {
+		return json.Marshal(string(d))
+	}
+	return []byte(d), nil
+}
+
+// Money is an amount in integer minor units (e.g. cents) of an ISO 4217 currency
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// ParseMoney converts a decimal major-unit amount into Money, rejecting negative
+// amounts, malformed numbers and more fractional digits than the currency allows
+// (e.g. "10.5" JPY or "1.234" EUR).
+func ParseMoney(amount Decimal, currency string) (Money, error) {
+	currency, err := NormalizeCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	exp := currencyExponents[currency]
+
+	s := string(amount)
+	if s == "" {
+		return Money{}, &ValidationError{Field: "price", Message: "price is required"}
+	}
+	if !isDecimal(s) {
+		return Money{}, &ValidationError{Field: "price", Message: fmt.Sprintf("invalid price %q (expected a non-negative decimal like 12.50)", s)}
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+
+	// Trailing zeros beyond the currency precision are harmless ("12.500" EUR)
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > exp {
+		return Money{}, &ValidationError{Field: "price", Message: fmt.Sprintf("%s allows at most %d decimal places", currency, exp)}
+	}
+	frac += strings.Repeat("0", exp-len(frac))
+
+	var minor int64
+	for _, r := range whole + frac {
+		digit := int64(r - '0')
+		if minor > (math.MaxInt64-digit)/10 {
+			return Money{}, &ValidationError{Field: "price", Message: "price is too large"}
+		}
+		minor = minor*10 + digit
+	}
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+// NewMoney wraps an amount already expressed in minor units
+func NewMoney(minor int64, currency string) (Money, error) {
+	currency, err := NormalizeCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	if minor < 0 {
+		return Money{}, &ValidationError{Field: "price", Message: "price must not be negative"}
+	}
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+// Decimal formats the amount in major units with the currency's precision.
+// Unknown (legacy free-text) currencies are assumed to have two decimals.
+func (m Money) Decimal() Decimal {
+	exp, ok := currencyExponents[m.Currency]
+	if !ok {
+		exp = 2
+	}
+	if exp == 0 {
+		return Decimal(fmt.Sprintf("%d", m.Amount))
+	}
+	pow := int64(math.Pow10(exp))
+	return Decimal(fmt.Sprintf("%d.%0*d", m.Amount/pow, exp, m.Amount%pow))
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("cannot add %s to %s", o.Currency, m.Currency)
+	}
+	if m.Amount > math.MaxInt64-o.Amount {
+		return Money{}, errors.New("amount overflow")
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) String() string {
+	return string(m.Decimal()) + " " + m.Currency
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   Decimal `json:"amount"`
+		Currency string  `json:"currency"`
+	}{m.Decimal(), m.Currency})
+}
+
+// ValidateDuration checks a duration in minutes fits within a single day
+func ValidateDuration(field string, minutes int64) error {
+	if minutes <= 0 {
+		return &ValidationError{Field: field, Message: "duration must be a positive number of minutes"}
+	}
+	if minutes > 24*60 {
+		return &ValidationError{Field: field, Message: "duration must not exceed 24 hours"}
+	}
+	return nil
+}
+
+// isDecimal reports whether s is a plain non-negative decimal such as "12" or "12.50"
+func isDecimal(s string) bool {
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	return isDigits(whole) && (!hasFrac || isDigits(frac))
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidationError reports an invalid input field
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return e.Field + ": " + e.Message
+}
@@ -0,0 +1,349 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"example.com/db"
+)
+
+const (
+	DepositNone    = "none"
+	DepositPercent = "percent"
+	DepositFull    = "full"
+)
+
+const (
+	PaymentPending  = "pending"
+	PaymentPaid     = "paid"
+	PaymentFailed   = "failed"
+	PaymentExpired  = "expired"
+	PaymentRefunded = "refunded"
+	// PaymentRefundDue is a captured deposit that must be returned. It is
+	// recorded with whatever made the refund due, and the refund is retried
+	// until the gateway accepts it.
+	PaymentRefundDue = "refund_due"
+)
+
+// PaymentSettings controls whether a provider requires a deposit to confirm bookings
+type PaymentSettings struct {
+	DepositType       string `json:"depositType"`
+	DepositPercent    int    `json:"depositPercent"`
+	HoldMinutes       int    `json:"holdMinutes"`
+	RefundWindowHours int    `json:"refundWindowHours"`
+}
+
+func DefaultPaymentSettings() PaymentSettings {
+	return PaymentSettings{DepositType: DepositNone, HoldMinutes: 30, RefundWindowHours: 24}
+}
+
+func (s *PaymentSettings) Validate() error {
+	switch s.DepositType {
+	case DepositNone, DepositFull:
+	case DepositPercent:
+		if s.DepositPercent < 1 || s.DepositPercent > 100 {
+			return &ValidationError{Field: "depositPercent", Message: "must be between 1 and 100"}
+		}
+	default:
+		return &ValidationError{Field: "depositType", Message: "must be one of none, percent, full"}
+	}
+	if s.HoldMinutes < 5 || s.HoldMinutes > 24*60 {
+		return &ValidationError{Field: "holdMinutes", Message: "must be between 5 and 1440"}
+	}
+	if s.RefundWindowHours < 0 {
+		return &ValidationError{Field: "refundWindowHours", Message: "must not be negative"}
+	}
+	return nil
+}
+
+// DepositFor returns the amount due online for a booking of the given total.
+// Percentages are rounded up to the next minor unit.
+func (s PaymentSettings) DepositFor(total Money) Money {
+	switch s.DepositType {
+	case DepositFull:
+		return total
+	case DepositPercent:
+		return Money{Amount: (total.Amount*int64(s.DepositPercent) + 99) / 100, Currency: total.Currency}
+	}
+	return Money{Currency: total.Currency}
+}
+
+// postgresPayments is the PaymentRepository backed by the payment_settings
+// and payments tables
+type postgresPayments struct {
+	conn db.DBTX
+}
+
+func (r postgresPayments) GetSettings(ctx context.Context, userID int64) (PaymentSettings, error) {
+	settings := DefaultPaymentSettings()
+	err := r.conn.QueryRowContext(ctx, `
+		SELECT deposit_type, deposit_percent, hold_minutes, refund_window_hours
+		FROM payment_settings
+		WHERE user_id = $1
+	`, userID).Scan(&settings.DepositType, &settings.DepositPercent, &settings.HoldMinutes, &settings.RefundWindowHours)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DefaultPaymentSettings(), nil
+	}
+	return settings, err
+}
+
+func (r postgresPayments) SaveSettings(ctx context.Context, userID int64, settings PaymentSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	_, err := r.conn.ExecContext(ctx, `
+		INSERT INTO payment_settings (user_id, deposit_type, deposit_percent, hold_minutes, refund_window_hours)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE
+		SET deposit_type = EXCLUDED.deposit_type,
+		    deposit_percent = EXCLUDED.deposit_percent,
+		    hold_minutes = EXCLUDED.hold_minutes,
+		    refund_window_hours = EXCLUDED.refund_window_hours
+	`, userID, settings.DepositType, settings.DepositPercent, settings.HoldMinutes, settings.RefundWindowHours)
+	return err
+}
+
+// Payment is a deposit taken through a payment gateway for an appointment
+type Payment struct {
+	ID            int64     `json:"id"`
+	AppointmentID string    `json:"appointmentId"`
+	UserID        int64     `json:"-"`
+	Gateway       string    `json:"gateway"`
+	CheckoutID    string    `json:"-"`
+	CheckoutURL   string    `json:"checkoutUrl,omitempty"`
+	PaymentID     string    `json:"-"`
+	Amount        Money     `json:"amount"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+func (r postgresPayments) Create(ctx context.Context, p *Payment) error {
+	p.Status = PaymentPending
+	return r.conn.QueryRowContext(ctx, `
+		INSERT INTO payments (appointment_id, user_id, gateway, checkout_id, amount_minor, currency, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`, p.AppointmentID, p.UserID, p.Gateway, p.CheckoutID, p.Amount.Amount, p.Amount.Currency, p.Status,
+	).Scan(&p.ID, &p.CreatedAt)
+}
+
+type PaymentOutcome int
+
+const (
+	// PaymentConfirmed means the appointment moved from pending_payment to confirmed
+	PaymentConfirmed PaymentOutcome = iota
+	// PaymentDuplicate means the webhook was already processed
+	PaymentDuplicate
+	// PaymentLate means the money arrived after the hold expired; the
+	// payment is left refund_due
+	PaymentLate
+)
+
+// Confirm records a successful payment and confirms its appointment. A
+// payment for an appointment no longer held is recorded as refund_due.
+func (r postgresPayments) Confirm(ctx context.Context, checkoutID, paymentID string) (*Payment, PaymentOutcome, error) {
+	var p *Payment
+	var outcome PaymentOutcome
+	err := db.WithTx(ctx, r.conn, func(tx *sql.Tx) error {
+		var err error
+		p, err = getPaymentForUpdate(ctx, tx, checkoutID)
+		if err != nil {
+			return err
+		}
+		if p.Status != PaymentPending && p.Status != PaymentExpired {
+			outcome = PaymentDuplicate
+			return nil
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			UPDATE appointments SET status = $1, hold_expires_at = NULL
+			WHERE id = $2 AND status = $3
+		`, StatusConfirmed, p.AppointmentID, StatusPendingPayment)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		outcome, p.Status = PaymentConfirmed, PaymentPaid
+		if rowsAffected == 0 {
+			outcome, p.Status = PaymentLate, PaymentRefundDue
+		}
+		p.PaymentID = paymentID
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE payments SET status = $1, payment_id = $2, updated_at = NOW() WHERE id = $3
+		`, p.Status, p.PaymentID, p.ID)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return p, outcome, nil
+}
+
+// Fail marks a pending payment as failed/expired and releases the held slot
+func (r postgresPayments) Fail(ctx context.Context, checkoutID, status string) error {
+	return db.WithTx(ctx, r.conn, func(tx *sql.Tx) error {
+		p, err := getPaymentForUpdate(ctx, tx, checkoutID)
+		if err != nil {
+			return err
+		}
+		if p.Status != PaymentPending {
+			return nil
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE payments SET status = $1, updated_at = NOW() WHERE id = $2`, status, p.ID)
+		if err != nil {
+			return err
+		}
+		return releasePendingAppointment(ctx, tx, p.AppointmentID)
+	})
+}
+
+const paymentColumns = `id, appointment_id, user_id, gateway, checkout_id, payment_id, amount_minor, currency, status, created_at`
+
+func scanPayment(row rowScanner) (*Payment, error) {
+	var p Payment
+	var appointmentID, paymentID sql.NullString
+	err := row.Scan(&p.ID, &appointmentID, &p.UserID, &p.Gateway, &p.CheckoutID, &paymentID,
+		&p.Amount.Amount, &p.Amount.Currency, &p.Status, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	p.AppointmentID = appointmentID.String
+	p.PaymentID = paymentID.String
+	return &p, nil
+}
+
+func getPaymentForUpdate(ctx context.Context, tx *sql.Tx, checkoutID string) (*Payment, error) {
+	p, err := scanPayment(tx.QueryRowContext(ctx, `
+		SELECT `+paymentColumns+`
+		FROM payments
+		WHERE checkout_id = $1
+		FOR UPDATE
+	`, checkoutID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPaymentNotFound
+	}
+	return p, err
+}
+
+// MarkRefundDue moves the captured payment of an appointment to
+// refund_due and returns it, or nil if there is none. Run it in the
+// transaction cancelling the appointment.
+func (r postgresPayments) MarkRefundDue(ctx context.Context, appointmentID string, userID int64) (*Payment, error) {
+	p, err := scanPayment(r.conn.QueryRowContext(ctx, `
+		UPDATE payments SET status = $1, updated_at = NOW()
+		WHERE appointment_id = $2 AND user_id = $3 AND status = $4
+		RETURNING `+paymentColumns,
+		PaymentRefundDue, appointmentID, userID, PaymentPaid))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return p, err
+}
+
+// ListRefundDue returns the payments still waiting for their refund
+func (r postgresPayments) ListRefundDue(ctx context.Context) ([]Payment, error) {
+	rows, err := r.conn.QueryContext(ctx, `
+		SELECT `+paymentColumns+`
+		FROM payments
+		WHERE status = $1
+		ORDER BY updated_at
+	`, PaymentRefundDue)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []Payment
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		due = append(due, *p)
+	}
+	return due, rows.Err()
+}
+
+func (r postgresPayments) MarkRefunded(ctx context.Context, id int64, refundID string) error {
+	_, err := r.conn.ExecContext(ctx, `
+		UPDATE payments SET status = $1, refund_id = $2, updated_at = NOW() WHERE id = $3 AND status = $4
+	`, PaymentRefunded, refundID, id, PaymentRefundDue)
+	return err
+}
+
+// ExpireUnpaid releases the slots of pending_payment appointments whose
+// hold has run out. It returns the number of appointments expired.
+func (r postgresPayments) ExpireUnpaid(ctx context.Context) (int, error) {
+	rows, err := r.conn.QueryContext(ctx, `
+		SELECT id FROM appointments
+		WHERE status = $1 AND hold_expires_at < NOW() AT TIME ZONE 'UTC'
+	`, StatusPendingPayment)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, id := range ids {
+		err := db.WithTx(ctx, r.conn, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				UPDATE payments SET status = $1, updated_at = NOW() WHERE appointment_id = $2 AND status = $3
+			`, PaymentExpired, id, PaymentPending)
+			if err != nil {
+				return err
+			}
+			return releasePendingAppointment(ctx, tx, id)
+		})
+		if err != nil {
+			return expired, err
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// releasePendingAppointment expires an unpaid appointment and gives its slot back to the schedule
+func releasePendingAppointment(ctx context.Context, tx *sql.Tx, appointmentID string) error {
+	var userID int64
+	var date time.Time
+	var startTime, endTime string
+	err := tx.QueryRowContext(ctx, `
+		SELECT user_id, date, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')
+		FROM appointments
+		WHERE id = $1 AND status = $2
+		FOR UPDATE
+	`, appointmentID, StatusPendingPayment).Scan(&userID, &date, &startTime, &endTime)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Already confirmed, expired or deleted
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE appointments SET status = $1, hold_expires_at = NULL WHERE id = $2
+	`, StatusExpired, appointmentID)
+	if err != nil {
+		return err
+	}
+	return restoreAndMergeSlot(ctx, tx, userID, date.Format("2006-01-02"), startTime, endTime)
+}
@@ -0,0 +1,214 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"example.com/db"
+	"example.com/pagination"
+)
+
+// UserRepository stores provider accounts
+type UserRepository interface {
+	// Create hashes the user's password and inserts them, setting ID
+	Create(ctx context.Context, u *User) error
+	// ValidateCredentials checks the email and password, setting ID
+	ValidateCredentials(ctx context.Context, u *User) error
+	GetByAlias(ctx context.Context, alias string) (*User, error)
+	GetAlias(ctx context.Context, userID int64) (string, error)
+	UpdateAlias(ctx context.Context, userID int64, alias string) error
+	// FindOrCreateOAuth returns the user signed in with the provider account,
+	// linking it to an existing user with the same email or creating one
+	FindOrCreateOAuth(ctx context.Context, oauthUser *OAuthUser) (*User, error)
+}
+
+// ServiceRepository stores the services providers offer
+type ServiceRepository interface {
+	List(ctx context.Context, userID int64, page pagination.Request) ([]Service, pagination.Meta, error)
+	GetByID(ctx context.Context, id, userID int64) (*Service, error)
+	// Create validates and inserts the service, setting ID
+	Create(ctx context.Context, s *Service) error
+	// Update validates and saves the service's details, leaving its media
+	Update(ctx context.Context, s *Service) error
+	// SaveMedia saves the service's media list, setting Timestamp
+	SaveMedia(ctx context.Context, s *Service) error
+	Delete(ctx context.Context, id, userID int64) error
+	// CreateOption validates and adds a variant or add-on to a service of
+	// the user, setting ID
+	CreateOption(ctx context.Context, kind OptionKind, opt *ServiceOption, userID int64) error
+	UpdateOption(ctx context.Context, kind OptionKind, opt *ServiceOption, userID int64) error
+	DeleteOption(ctx context.Context, kind OptionKind, serviceID, optionID, userID int64) error
+}
+
+// ScheduleRepository stores the time ranges providers can be booked in
+type ScheduleRepository interface {
+	Get(ctx context.Context, userID int64, date time.Time) ([]TimeRange, error)
+	// GetRange returns the schedule of days days starting at start
+	GetRange(ctx context.Context, userID int64, start time.Time, days int) (ScheduleByDate, error)
+	// Save replaces the schedule of a day
+	Save(ctx context.Context, userID int64, date time.Time, ranges []TimeRangePayload) ([]TimeRange, error)
+}
+
+// AppointmentRepository stores bookings
+type AppointmentRepository interface {
+	// Create takes the appointment's slot from the schedule (or the client's
+	// hold) and inserts it with its items, setting ID and CancelToken
+	Create(ctx context.Context, appt *Appointment) error
+	List(ctx context.Context, userID int64, filter AppointmentFilter, page pagination.Request) ([]Appointment, pagination.Meta, error)
+	// Delete removes the appointment and gives its slot back to the schedule
+	Delete(ctx context.Context, appointmentID string, userID int64) error
+	// Release is Delete for an appointment that was never really taken, such
+	// as one whose checkout could not start: the slot isn't offered to the
+	// waitlist
+	Release(ctx context.Context, appointmentID string, userID int64) error
+	SetNoShow(ctx context.Context, appointmentID string, userID int64, noShow bool) error
+	GetForClient(ctx context.Context, appointmentID string, userID int64, cancelToken string) (*Appointment, error)
+}
+
+// EventRepository stores events and their registrations
+type EventRepository interface {
+	List(ctx context.Context, page pagination.Request) ([]Event, pagination.Meta, error)
+	GetByID(ctx context.Context, id int64) (*Event, error)
+	Create(ctx context.Context, e *Event) error
+	Update(ctx context.Context, e *Event) error
+	Delete(ctx context.Context, id int64) error
+	Register(ctx context.Context, eventID, userID int64) error
+	Unregister(ctx context.Context, eventID, userID int64) error
+}
+
+// PaymentRepository stores deposit settings and the payments taken for
+// appointments
+type PaymentRepository interface {
+	GetSettings(ctx context.Context, userID int64) (PaymentSettings, error)
+	// SaveSettings validates and saves the provider's deposit settings
+	SaveSettings(ctx context.Context, userID int64, settings PaymentSettings) error
+	// Create records a pending payment for a checkout, setting ID
+	Create(ctx context.Context, p *Payment) error
+	// Confirm records a successful payment and confirms its appointment
+	Confirm(ctx context.Context, checkoutID, paymentID string) (*Payment, PaymentOutcome, error)
+	// Fail marks a pending payment with status and releases its slot
+	Fail(ctx context.Context, checkoutID, status string) error
+	// MarkRefundDue moves the captured payment of an appointment to
+	// refund_due and returns it, or nil if there is none
+	MarkRefundDue(ctx context.Context, appointmentID string, userID int64) (*Payment, error)
+	// ListRefundDue returns the payments whose refund hasn't gone through
+	ListRefundDue(ctx context.Context) ([]Payment, error)
+	// MarkRefunded records the gateway's refund of a refund_due payment
+	MarkRefunded(ctx context.Context, id int64, refundID string) error
+	// ExpireUnpaid releases appointments whose payment hold ran out,
+	// returning how many
+	ExpireUnpaid(ctx context.Context) (int, error)
+}
+
+// ClientRepository stores the provider's records of the people who book
+// with them
+type ClientRepository interface {
+	List(ctx context.Context, userID int64, page pagination.Request) ([]ClientSummary, pagination.Meta, error)
+	Get(ctx context.Context, clientID, userID int64) (*ClientDetail, error)
+	// Update validates and saves the client's details, notes and tags
+	Update(ctx context.Context, cl *Client) error
+	// Merge folds the source client into the target and deletes it
+	Merge(ctx context.Context, userID, targetID, sourceID int64) error
+}
+
+// SlotHoldRepository stores the slots clients reserve during checkout
+type SlotHoldRepository interface {
+	// Create takes the hold's slot from the schedule, setting ID, Token and
+	// ExpiresAt
+	Create(ctx context.Context, hold *SlotHold) error
+	// Release gives a held slot back to the schedule
+	Release(ctx context.Context, holdID string, userID int64, token string) error
+	// Expire releases holds that ran out, returning how many
+	Expire(ctx context.Context) (int, error)
+}
+
+// WaitlistRepository stores clients waiting for a slot and the offers made
+// to them
+type WaitlistRepository interface {
+	// Create validates and inserts the entry, setting ID and Token
+	Create(ctx context.Context, e *WaitlistEntry) error
+	List(ctx context.Context, userID int64) ([]WaitlistEntry, error)
+	Leave(ctx context.Context, entryID string, userID int64, token string) error
+	GetOffer(ctx context.Context, entryID string, userID int64, offerToken string) (*WaitlistEntry, error)
+	// MarkBooked closes the entry holding the unexpired offer, failing with
+	// ErrWaitlistOfferNotFound when it is gone
+	MarkBooked(ctx context.Context, entryID, offerToken, appointmentID string) error
+	// OfferFreedSlots offers availability that opened up, and that of offers
+	// that lapsed, to waiting clients, returning the offers to send out
+	OfferFreedSlots(ctx context.Context) ([]WaitlistOffer, error)
+}
+
+// RestrictionRepository stores providers' blocklists and booking rules
+type RestrictionRepository interface {
+	ListBlocks(ctx context.Context, userID int64) ([]BlockEntry, error)
+	// CreateBlock validates and adds an entry, setting ID
+	CreateBlock(ctx context.Context, b *BlockEntry) error
+	DeleteBlock(ctx context.Context, id, userID int64) error
+	GetRules(ctx context.Context, userID int64) (BookingRules, error)
+	// SaveRules validates and saves the provider's booking rules
+	SaveRules(ctx context.Context, userID int64, rules BookingRules) error
+	// Check applies the blocklist and rules to a client about to book
+	Check(ctx context.Context, userID int64, email, phone, ip string) (BookingCheck, error)
+}
+
+// Repositories bundles the repositories handlers depend on
+type Repositories struct {
+	Users        UserRepository
+	Services     ServiceRepository
+	Schedules    ScheduleRepository
+	Appointments AppointmentRepository
+	Events       EventRepository
+	Payments     PaymentRepository
+	Clients      ClientRepository
+	Holds        SlotHoldRepository
+	Waitlist     WaitlistRepository
+	Restrictions RestrictionRepository
+
+	inTx func(ctx context.Context, fn func(Repositories) error) error
+	ping func(ctx context.Context) error
+}
+
+// InTx runs fn with repositories sharing one transaction, which is committed
+// if fn returns nil and rolled back otherwise
+func (r Repositories) InTx(ctx context.Context, fn func(tx Repositories) error) error {
+	return r.inTx(ctx, fn)
+}
+
+// Ping checks that the storage behind the repositories can serve requests
+func (r Repositories) Ping(ctx context.Context) error {
+	if r.ping == nil {
+		return nil
+	}
+	return r.ping(ctx)
+}
+
+// NewPostgresRepositories returns repositories running their queries on conn,
+// a pool or a transaction
+func NewPostgresRepositories(conn db.DBTX) Repositories {
+	return Repositories{
+		Users:        postgresUsers{conn: conn},
+		Services:     postgresServices{conn: conn},
+		Schedules:    postgresSchedules{conn: conn},
+		Appointments: postgresAppointments{conn: conn},
+		Events:       postgresEvents{conn: conn},
+		Payments:     postgresPayments{conn: conn},
+		Clients:      postgresClients{conn: conn},
+		Holds:        postgresSlotHolds{conn: conn},
+		Waitlist:     postgresWaitlist{conn: conn},
+		Restrictions: postgresRestrictions{conn: conn},
+		inTx: func(ctx context.Context, fn func(Repositories) error) error {
+			return db.WithTx(ctx, conn, func(tx *sql.Tx) error {
+				return fn(NewPostgresRepositories(tx))
+			})
+		},
+		ping: func(ctx context.Context) error {
+			if !db.Ready() {
+				return errors.New("database tables have not been created")
+			}
+			var one int
+			return conn.QueryRowContext(ctx, `SELECT 1`).Scan(&one)
+		},
+	}
+}
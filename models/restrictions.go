@@ -0,0 +1,233 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"example.com/db"
+)
+
+const (
+	BlockEmail = "email"
+	BlockPhone = "phone"
+	BlockIP    = "ip"
+)
+
+// ErrBookingRestricted is returned when a provider's blocklist or rules refuse
+// a booking. Its message is deliberately neutral so clients cannot tell why.
+var ErrBookingRestricted = Forbidden("booking_restricted", "this booking could not be completed, please contact the provider directly")
+
+var ErrBlockNotFound = NotFound("blocklist_entry_not_found", "blocklist entry not found")
+
+// BlockEntry refuses bookings from an email, phone number or IP address
+type BlockEntry struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"-"`
+	Kind      string    `json:"kind" binding:"required"`
+	Value     string    `json:"value" binding:"required"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Validate checks the kind and normalizes the value so it matches bookings
+// regardless of formatting
+func (b *BlockEntry) Validate() error {
+	switch b.Kind {
+	case BlockEmail:
+		b.Value = NormalizeEmail(b.Value)
+	case BlockPhone:
+		b.Value = NormalizePhone(b.Value)
+	case BlockIP:
+		ip := net.ParseIP(strings.TrimSpace(b.Value))
+		if ip == nil {
+			return &ValidationError{Field: "value", Message: "must be an IP address"}
+		}
+		b.Value = ip.String()
+	default:
+		return &ValidationError{Field: "kind", Message: "must be one of email, phone, ip"}
+	}
+	if b.Value == "" {
+		return &ValidationError{Field: "value", Message: "is required"}
+	}
+	if len(b.Reason) > 500 {
+		return &ValidationError{Field: "reason", Message: "must be at most 500 characters"}
+	}
+	return nil
+}
+
+// postgresRestrictions is the RestrictionRepository backed by the
+// blocked_clients and booking_rules tables
+type postgresRestrictions struct {
+	conn db.DBTX
+}
+
+// CreateBlock adds an entry; blocking the same value twice updates the reason
+func (r postgresRestrictions) CreateBlock(ctx context.Context, b *BlockEntry) error {
+	if err := b.Validate(); err != nil {
+		return err
+	}
+	return r.conn.QueryRowContext(ctx, `
+		INSERT INTO blocked_clients (user_id, kind, value, reason)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, kind, value) DO UPDATE SET reason = EXCLUDED.reason
+		RETURNING id, created_at
+	`, b.UserID, b.Kind, b.Value, b.Reason).Scan(&b.ID, &b.CreatedAt)
+}
+
+func (r postgresRestrictions) ListBlocks(ctx context.Context, userID int64) ([]BlockEntry, error) {
+	rows, err := r.conn.QueryContext(ctx, `
+		SELECT id, user_id, kind, value, reason, created_at
+		FROM blocked_clients
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []BlockEntry
+	for rows.Next() {
+		var b BlockEntry
+		if err := rows.Scan(&b.ID, &b.UserID, &b.Kind, &b.Value, &b.Reason, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+func (r postgresRestrictions) DeleteBlock(ctx context.Context, id, userID int64) error {
+	result, err := r.conn.ExecContext(ctx, `DELETE FROM blocked_clients WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrBlockNotFound
+	}
+	return nil
+}
+
+// BookingRules restrict bookings by clients with a poor record. Zero disables a rule.
+type BookingRules struct {
+	// PrepayAfterNoShows requires the full price to be paid online once a
+	// client has this many no-shows
+	PrepayAfterNoShows int `json:"prepayAfterNoShows"`
+	// MaxFutureBookings caps how many upcoming appointments a client may hold
+	MaxFutureBookings int `json:"maxFutureBookings"`
+	// DisableCaptcha lets public bookings through without a CAPTCHA
+	DisableCaptcha bool `json:"disableCaptcha"`
+}
+
+func (r *BookingRules) Validate() error {
+	if r.PrepayAfterNoShows < 0 || r.PrepayAfterNoShows > 100 {
+		return &ValidationError{Field: "prepayAfterNoShows", Message: "must be between 0 and 100"}
+	}
+	if r.MaxFutureBookings < 0 || r.MaxFutureBookings > 100 {
+		return &ValidationError{Field: "maxFutureBookings", Message: "must be between 0 and 100"}
+	}
+	return nil
+}
+
+func (r postgresRestrictions) GetRules(ctx context.Context, userID int64) (BookingRules, error) {
+	var rules BookingRules
+	err := r.conn.QueryRowContext(ctx, `
+		SELECT prepay_after_no_shows, max_future_bookings, disable_captcha
+		FROM booking_rules
+		WHERE user_id = $1
+	`, userID).Scan(&rules.PrepayAfterNoShows, &rules.MaxFutureBookings, &rules.DisableCaptcha)
+	if errors.Is(err, sql.ErrNoRows) {
+		return BookingRules{}, nil
+	}
+	return rules, err
+}
+
+func (r postgresRestrictions) SaveRules(ctx context.Context, userID int64, rules BookingRules) error {
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+	_, err := r.conn.ExecContext(ctx, `
+		INSERT INTO booking_rules (user_id, prepay_after_no_shows, max_future_bookings, disable_captcha)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET prepay_after_no_shows = EXCLUDED.prepay_after_no_shows,
+		    max_future_bookings = EXCLUDED.max_future_bookings,
+		    disable_captcha = EXCLUDED.disable_captcha
+	`, userID, rules.PrepayAfterNoShows, rules.MaxFutureBookings, rules.DisableCaptcha)
+	return err
+}
+
+// BookingCheck is what a provider's restrictions demand of a booking
+type BookingCheck struct {
+	// RequirePrepayment means the full price must be paid online
+	RequirePrepayment bool
+}
+
+// Check applies the provider's blocklist and rules to a client about to book.
+// It returns ErrBookingRestricted when the booking must be refused.
+func (r postgresRestrictions) Check(ctx context.Context, userID int64, email, phone, ip string) (BookingCheck, error) {
+	var check BookingCheck
+
+	email = NormalizeEmail(email)
+	phone = NormalizePhone(phone)
+	if parsed := net.ParseIP(ip); parsed != nil {
+		ip = parsed.String()
+	}
+
+	var blocked bool
+	err := r.conn.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM blocked_clients
+			WHERE user_id = $1
+			  AND ((kind = 'email' AND value = $2)
+			    OR (kind = 'phone' AND value = $3)
+			    OR (kind = 'ip' AND value = $4))
+		)
+	`, userID, email, phone, ip).Scan(&blocked)
+	if err != nil {
+		return check, err
+	}
+	if blocked {
+		return check, ErrBookingRestricted
+	}
+
+	rules, err := r.GetRules(ctx, userID)
+	if err != nil {
+		return check, err
+	}
+	if rules.PrepayAfterNoShows == 0 && rules.MaxFutureBookings == 0 {
+		return check, nil
+	}
+
+	// Rules look at the client's history, which is tracked on their client record
+	var noShows, futureBookings int
+	err = r.conn.QueryRowContext(ctx, `
+		SELECT COUNT(*) FILTER (WHERE a.no_show),
+		       COUNT(*) FILTER (WHERE a.status IN ('confirmed', 'pending_payment')
+		                          AND a.date >= $4::date)
+		FROM appointments a
+		JOIN clients c ON c.id = a.client_id
+		WHERE c.user_id = $1
+		  AND ((c.email_normalized <> '' AND c.email_normalized = $2)
+		    OR (c.phone_normalized <> '' AND c.phone_normalized = $3))
+	`, userID, email, phone, Today().Format("2006-01-02")).Scan(&noShows, &futureBookings)
+	if err != nil {
+		return check, err
+	}
+
+	if rules.MaxFutureBookings > 0 && futureBookings >= rules.MaxFutureBookings {
+		return check, ErrBookingRestricted
+	}
+	if rules.PrepayAfterNoShows > 0 && noShows >= rules.PrepayAfterNoShows {
+		check.RequirePrepayment = true
+	}
+	return check, nil
+}
@@ -3,7 +3,6 @@ package models
 import (
 	"context"
 	"database/sql"
-	"errors"
 	"sort"
 	"time"
 
@@ -25,10 +24,15 @@ type TimeRange struct {
 	EndTime   string `json:"end"`   // "HH:MM"
 }
 
+// postgresSchedules is the ScheduleRepository backed by the schedules table
+type postgresSchedules struct {
+	conn db.DBTX
+}
+
 // -------- Single day getter --------
-func GetSchedule(ctx context.Context, userID int64, date time.Time) ([]TimeRange, error) {
+func (r postgresSchedules) Get(ctx context.Context, userID int64, date time.Time) ([]TimeRange, error) {
 	day := date.UTC().Format("2006-01-02")
-	rows, err := db.DB.QueryContext(ctx, `
+	rows, err := r.conn.QueryContext(ctx, `
 		SELECT id, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')
 		FROM schedules
 		WHERE user_id = $1 AND date = $2::date
@@ -54,7 +58,7 @@ func GetSchedule(ctx context.Context, userID int64, date time.Time) ([]TimeRange
 
 type ScheduleByDate map[string][]TimeRange // key: "YYYY-MM-DD"
 
-func GetScheduleForRange(ctx context.Context, userID int64, start time.Time, days int) (ScheduleByDate, error) {
+func (r postgresSchedules) GetRange(ctx context.Context, userID int64, start time.Time, days int) (ScheduleByDate, error) {
 	if days <= 0 {
 		days = 1
 	}
@@ -63,7 +67,7 @@ func GetScheduleForRange(ctx context.Context, userID int64, start time.Time, day
 	startDay := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
 	endDay := startDay.AddDate(0, 0, days)
 
-	rows, err := db.DB.QueryContext(ctx, `
+	rows, err := r.conn.QueryContext(ctx, `
 		SELECT date, id, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')
 		FROM schedules
 		WHERE user_id = $1
@@ -101,59 +105,54 @@ func GetScheduleForRange(ctx context.Context, userID int64, start time.Time, day
 
 // -------- Save (replace a day) --------
 
-func SaveSchedule(ctx context.Context, userID int64, date time.Time, ranges []TimeRangePayload) ([]TimeRange, error) {
+func (r postgresSchedules) Save(ctx context.Context, userID int64, date time.Time, ranges []TimeRangePayload) ([]TimeRange, error) {
 	// Normalize + validate
 	norm, err := normalizeAndValidate(ranges)
 	if err != nil {
 		return nil, err
 	}
 
-	tx, err := db.DB.BeginTx(ctx, &sql.TxOptions{})
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
-
 	day := date.UTC().Format("2006-01-02")
+	inserted := make([]TimeRange, 0, len(norm))
 
-	// delete the day
-	if _, err := tx.ExecContext(ctx,
-		`DELETE FROM schedules WHERE user_id = $1 AND date = $2::date`,
-		userID, day,
-	); err != nil {
-		return nil, err
-	}
-
-	// empty payload → commit
-	if len(norm) == 0 {
-		if err := tx.Commit(); err != nil {
-			return nil, err
+	err = db.WithTx(ctx, r.conn, func(tx *sql.Tx) error {
+		// delete the day
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM schedules WHERE user_id = $1 AND date = $2::date`,
+			userID, day,
+		); err != nil {
+			return err
 		}
-		return []TimeRange{}, nil
-	}
 
-	// insert new rows
-	stmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO schedules (user_id, date, start_time, end_time)
-		VALUES ($1, $2::date, $3::time, $4::time)
-		RETURNING id, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')
-	`)
-	if err != nil {
-		return nil, err
-	}
-	defer stmt.Close()
+		// empty payload → commit
+		if len(norm) == 0 {
+			return nil
+		}
 
-	inserted := make([]TimeRange, 0, len(norm))
-	for _, r := range norm {
-		var tr TimeRange
-		if err := stmt.QueryRowContext(ctx, userID, day, r.Start, r.End).
-			Scan(&tr.ID, &tr.StartTime, &tr.EndTime); err != nil {
-			return nil, err
+		// insert new rows
+		stmt, err := tx.PrepareContext(ctx, `
+			INSERT INTO schedules (user_id, date, start_time, end_time)
+			VALUES ($1, $2::date, $3::time, $4::time)
+			RETURNING id, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')
+		`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, r := range norm {
+			var tr TimeRange
+			if err := stmt.QueryRowContext(ctx, userID, day, r.Start, r.End).
+				Scan(&tr.ID, &tr.StartTime, &tr.EndTime); err != nil {
+				return err
+			}
+			inserted = append(inserted, tr)
 		}
-		inserted = append(inserted, tr)
-	}
 
-	if err := tx.Commit(); err != nil {
+		// The day may have gained availability waitlisted clients are after
+		return markSlotFreed(ctx, tx, userID, day)
+	})
+	if err != nil {
 		return nil, err
 	}
 	return inserted, nil
@@ -184,10 +183,10 @@ func normalizeAndValidate(in []TimeRangePayload) ([]normRange, error) {
 		startT, err1 := time.Parse(timeLayout, r.Start)
 		endT, err2 := time.Parse(timeLayout, r.End)
 		if err1 != nil || err2 != nil {
-			return nil, errors.New("invalid time format (expected HH:MM)")
+			return nil, Invalid("invalid_schedule", "invalid time format (expected HH:MM)")
 		}
 		if !startT.Before(endT) {
-			return nil, errors.New("each range must satisfy start < end")
+			return nil, Invalid("invalid_schedule", "each range must satisfy start < end")
 		}
 		pts = append(pts, point{
 			startMin: startT.Hour()*60 + startT.Minute(),
@@ -200,7 +199,7 @@ func normalizeAndValidate(in []TimeRangePayload) ([]normRange, error) {
 	sort.Slice(pts, func(i, j int) bool { return pts[i].startMin < pts[j].startMin })
 	for i := 1; i < len(pts); i++ {
 		if pts[i].startMin < pts[i-1].endMin {
-			return nil, errors.New("time ranges overlap")
+			return nil, Invalid("invalid_schedule", "time ranges overlap")
 		}
 	}
 
@@ -0,0 +1,291 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"example.com/db"
+)
+
+type OptionKind string
+
+const (
+	OptionVariant OptionKind = "variant"
+	OptionAddOn   OptionKind = "addon"
+)
+
+func (k OptionKind) table() (string, error) {
+	switch k {
+	case OptionVariant:
+		return "service_variants", nil
+	case OptionAddOn:
+		return "service_addons", nil
+	}
+	return "", fmt.Errorf("unknown option kind %q", k)
+}
+
+// ServiceOption is either a variant (replaces the base price/duration of the
+// service, e.g. "with gel") or an add-on (adds its price/duration on top).
+type ServiceOption struct {
+	ID        int64   `json:"id"`
+	ServiceID int64   `json:"serviceId"`
+	Name      string  `json:"name" binding:"required"`
+	Price     Decimal `json:"price"`
+	Duration  int64   `json:"duration"`
+	Position  int     `json:"position"`
+
+	priceMinor int64
+}
+
+// AppointmentOption is the snapshot of a chosen variant/add-on stored on the appointment
+type AppointmentOption struct {
+	Kind     OptionKind `json:"kind"`
+	ID       int64      `json:"id"`
+	Name     string     `json:"name"`
+	Price    Decimal    `json:"price"`
+	Duration int64      `json:"duration"`
+}
+
+var (
+	ErrServiceNotFound = NotFound("service_not_found", "service not found")
+	ErrOptionNotFound  = NotFound("option_not_found", "service option not found")
+)
+
+// Validate checks the option against the currency of its service and
+// normalizes its price. Variants replace the service duration so it must be positive.
+func (o *ServiceOption) Validate(kind OptionKind, currency string) error {
+	if strings.TrimSpace(o.Name) == "" {
+		return &ValidationError{Field: "name", Message: "option name is required"}
+	}
+	if o.Price == "" {
+		o.Price = "0"
+	}
+	price, err := ParseMoney(o.Price, currency)
+	if err != nil {
+		return err
+	}
+	if kind == OptionVariant || o.Duration != 0 {
+		if err := ValidateDuration("duration", o.Duration); err != nil {
+			return err
+		}
+	}
+	o.Price = price.Decimal()
+	o.priceMinor = price.Amount
+	return nil
+}
+
+// currency returns the currency of a service owned by the user
+func (r postgresServices) currency(ctx context.Context, serviceID, userID int64) (string, error) {
+	var currency string
+	err := r.conn.QueryRowContext(ctx, `SELECT COALESCE(currency, '') FROM services WHERE id = $1 AND user_id = $2`, serviceID, userID).Scan(&currency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrServiceNotFound
+	}
+	return currency, err
+}
+
+func (r postgresServices) CreateOption(ctx context.Context, kind OptionKind, opt *ServiceOption, userID int64) error {
+	table, err := kind.table()
+	if err != nil {
+		return err
+	}
+	currency, err := r.currency(ctx, opt.ServiceID, userID)
+	if err != nil {
+		return err
+	}
+	if err := opt.Validate(kind, currency); err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s (service_id, name, price_minor, duration, position)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, table)
+	return r.conn.QueryRowContext(ctx, query, opt.ServiceID, opt.Name, opt.priceMinor, opt.Duration, opt.Position).Scan(&opt.ID)
+}
+
+func (r postgresServices) UpdateOption(ctx context.Context, kind OptionKind, opt *ServiceOption, userID int64) error {
+	table, err := kind.table()
+	if err != nil {
+		return err
+	}
+	currency, err := r.currency(ctx, opt.ServiceID, userID)
+	if errors.Is(err, ErrServiceNotFound) {
+		return ErrOptionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := opt.Validate(kind, currency); err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE %s o
+		SET name = $1, price_minor = $2, duration = $3, position = $4
+		FROM services s
+		WHERE o.id = $5 AND o.service_id = $6 AND s.id = o.service_id AND s.user_id = $7
+	`, table)
+	result, err := r.conn.ExecContext(ctx, query, opt.Name, opt.priceMinor, opt.Duration, opt.Position, opt.ID, opt.ServiceID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrOptionNotFound
+	}
+	return nil
+}
+
+func (r postgresServices) DeleteOption(ctx context.Context, kind OptionKind, serviceID, optionID, userID int64) error {
+	table, err := kind.table()
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+		DELETE FROM %s o
+		USING services s
+		WHERE o.id = $1 AND o.service_id = $2 AND s.id = o.service_id AND s.user_id = $3
+	`, table)
+	result, err := r.conn.ExecContext(ctx, query, optionID, serviceID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrOptionNotFound
+	}
+	return nil
+}
+
+// getOptionsForUser loads all options of the given kind for a user's services, grouped by service id
+func getOptionsForUser(ctx context.Context, conn db.DBTX, kind OptionKind, userID int64) (map[int64][]ServiceOption, error) {
+	table, err := kind.table()
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT o.id, o.service_id, o.name, COALESCE(o.price_minor, 0), COALESCE(s.currency, ''), o.duration, o.position
+		FROM %s o
+		JOIN services s ON s.id = o.service_id
+		WHERE s.user_id = $1
+		ORDER BY o.position, o.id
+	`, table)
+	rows, err := conn.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[int64][]ServiceOption)
+	for rows.Next() {
+		var o ServiceOption
+		var currency string
+		if err := rows.Scan(&o.ID, &o.ServiceID, &o.Name, &o.priceMinor, &currency, &o.Duration, &o.Position); err != nil {
+			return nil, err
+		}
+		o.Price = Money{Amount: o.priceMinor, Currency: currency}.Decimal()
+		out[o.ServiceID] = append(out[o.ServiceID], o)
+	}
+	return out, rows.Err()
+}
+
+func getOptionsForService(ctx context.Context, conn db.DBTX, kind OptionKind, serviceID int64, currency string) ([]ServiceOption, error) {
+	table, err := kind.table()
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, service_id, name, COALESCE(price_minor, 0), duration, position
+		FROM %s
+		WHERE service_id = $1
+		ORDER BY position, id
+	`, table)
+	rows, err := conn.QueryContext(ctx, query, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []ServiceOption{}
+	for rows.Next() {
+		var o ServiceOption
+		if err := rows.Scan(&o.ID, &o.ServiceID, &o.Name, &o.priceMinor, &o.Duration, &o.Position); err != nil {
+			return nil, err
+		}
+		o.Price = Money{Amount: o.priceMinor, Currency: currency}.Decimal()
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
+
+// ResolveSelection validates the chosen variant/add-ons against the service and
+// returns the total price, total duration (minutes) and the option snapshots.
+// A service with variants requires one to be chosen.
+func (s *Service) ResolveSelection(variantID *int64, addOnIDs []int64) (price Money, duration int64, options []AppointmentOption, err error) {
+	price = s.PriceMoney()
+	duration = s.Duration
+	options = []AppointmentOption{}
+
+	if variantID != nil {
+		var variant *ServiceOption
+		for i := range s.Variants {
+			if s.Variants[i].ID == *variantID {
+				variant = &s.Variants[i]
+				break
+			}
+		}
+		if variant == nil {
+			return Money{}, 0, nil, Invalid("invalid_selection", "variant not found for this service")
+		}
+		price.Amount = variant.priceMinor
+		duration = variant.Duration
+		options = append(options, AppointmentOption{
+			Kind: OptionVariant, ID: variant.ID, Name: variant.Name, Price: variant.Price, Duration: variant.Duration,
+		})
+	} else if len(s.Variants) > 0 {
+		return Money{}, 0, nil, Invalid("invalid_selection", "a variant must be selected for this service")
+	}
+
+	seen := make(map[int64]bool, len(addOnIDs))
+	for _, id := range addOnIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		var addOn *ServiceOption
+		for i := range s.AddOns {
+			if s.AddOns[i].ID == id {
+				addOn = &s.AddOns[i]
+				break
+			}
+		}
+		if addOn == nil {
+			return Money{}, 0, nil, Invalid("invalid_selection", fmt.Sprintf("add-on %d not found for this service", id))
+		}
+		price, err = price.Add(Money{Amount: addOn.priceMinor, Currency: price.Currency})
+		if err != nil {
+			return Money{}, 0, nil, err
+		}
+		duration += addOn.Duration
+		options = append(options, AppointmentOption{
+			Kind: OptionAddOn, ID: addOn.ID, Name: addOn.Name, Price: addOn.Price, Duration: addOn.Duration,
+		})
+	}
+
+	return price, duration, options, nil
+}
@@ -1,85 +1,212 @@
 package models
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"example.com/db"
+	"example.com/pagination"
+)
+
+// MediaKind tells photos from video clips
+type MediaKind string
+
+const (
+	MediaImage MediaKind = "image"
+	MediaVideo MediaKind = "video"
 )
 
 type MediaItem struct {
 	PublicID string `json:"public_id"`
 	FileName string `json:"fileName"`
+	// Kind is empty for media uploaded before videos were supported, all of
+	// which are images
+	Kind MediaKind `json:"kind,omitempty"`
+	// URI is the full size rendition of a photo, or the clip itself
 	URI      string `json:"uri"`
 	MimeType string `json:"mimeType"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	// Duration is the length of a clip in seconds
+	Duration float64 `json:"duration,omitempty"`
+	// Variants are the renditions of a photo, or of a clip's poster frame, by
+	// size name: thumbnail, medium and full. Photos uploaded before they were
+	// generated have none, as do clips no poster could be made for.
+	Variants map[string]MediaVariant `json:"variants,omitempty"`
+}
+
+// IsVideo reports whether the item is a video clip
+func (m MediaItem) IsVideo() bool { return m.Kind == MediaVideo }
+
+type MediaVariant struct {
+	URI    string `json:"uri"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
 }
 
 type Service struct {
-	ID          int64       `json:"id"`
-	Name        string      `binding:"required" json:"name"`
-	Description string      `json:"description"`
-	Price       int64       `binding:"required" json:"price"`
-	Currency    string      `binding:"required" json:"currency"`
-	Duration    int64       `json:"duration"`
-	Timestamp   *time.Time  `json:"timestamp,omitempty"`
-	UserID      int64       `json:"user_id"`
-	Media       []MediaItem `json:"media"`
+	ID          int64           `json:"id"`
+	Name        string          `binding:"required" json:"name"`
+	Description string          `json:"description"`
+	Price       Decimal         `binding:"required" json:"price"`
+	Currency    string          `binding:"required" json:"currency"`
+	Duration    int64           `json:"duration"`
+	Timestamp   *time.Time      `json:"timestamp,omitempty"`
+	UserID      int64           `json:"user_id"`
+	Media       []MediaItem     `json:"media"`
+	Variants    []ServiceOption `json:"variants"`
+	AddOns      []ServiceOption `json:"addOns"`
+
+	priceMinor int64
 }
 
-func GetServicesForUser(id int64) ([]Service, error) {
-	query := "SELECT id, name, description, price, duration, media, currency, timestamp FROM services WHERE user_id = $1"
-	rows, err := db.DB.Query(query, id)
+// Validate checks name, currency, price precision and duration, normalizing
+// the currency code and price. Failures are returned as *ValidationError.
+func (s *Service) Validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return &ValidationError{Field: "name", Message: "name is required"}
+	}
+	price, err := ParseMoney(s.Price, s.Currency)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if err := ValidateDuration("duration", s.Duration); err != nil {
+		return err
+	}
+	s.Currency = price.Currency
+	s.Price = price.Decimal()
+	s.priceMinor = price.Amount
+	return nil
+}
+
+// PriceMoney returns the base price of the service in minor units
+func (s *Service) PriceMoney() Money {
+	return Money{Amount: s.priceMinor, Currency: s.Currency}
+}
+
+func (s *Service) setPriceMinor(minor int64) {
+	s.priceMinor = minor
+	s.Price = s.PriceMoney().Decimal()
+}
+
+// ServiceKeyset lists the orders services can be listed in
+var ServiceKeyset = pagination.Keyset{
+	Sorts: map[string]pagination.Column{
+		"createdAt": {Expr: "COALESCE(timestamp, 'epoch')", Type: "timestamp"},
+		"name":      {Expr: "COALESCE(name, '')", Type: "text"},
+		"price":     {Expr: "COALESCE(price_minor, 0)", Type: "bigint"},
+		"duration":  {Expr: "COALESCE(duration, 0)", Type: "bigint"},
+	},
+	Default: "createdAt",
+	ID:      pagination.Column{Expr: "id", Type: "bigint"},
+}
+
+// postgresServices is the ServiceRepository backed by the services table
+type postgresServices struct {
+	conn db.DBTX
+}
+
+func (r postgresServices) List(ctx context.Context, id int64, page pagination.Request) ([]Service, pagination.Meta, error) {
+	var total int64
+	err := r.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM services WHERE user_id = $1", id).Scan(&total)
+	if err != nil {
+		return nil, pagination.Meta{}, err
+	}
+
+	after, args := page.After(2)
+	query := "SELECT id, name, description, COALESCE(price_minor, 0), duration, media, COALESCE(currency, ''), timestamp, " + page.SortValue() +
+		" FROM services WHERE user_id = $1 AND " + after + " ORDER BY " + page.OrderBy() + page.LimitClause()
+	rows, err := r.conn.QueryContext(ctx, query, append([]any{id}, args...)...)
+	if err != nil {
+		return nil, pagination.Meta{}, err
 	}
 	defer rows.Close()
 
 	var services []Service
+	var values []string
 
 	for rows.Next() {
 		var service Service
 		service.Media = []MediaItem{}
 		var mediaJson *string
+		var priceMinor int64
+		var value string
 		err := rows.Scan(
 			&service.ID,
 			&service.Name,
 			&service.Description,
-			&service.Price,
+			&priceMinor,
 			&service.Duration,
 			&mediaJson,
 			&service.Currency,
 			&service.Timestamp,
+			&value,
 		)
 		if err != nil {
-			return nil, err
+			return nil, pagination.Meta{}, err
 		}
+		service.setPriceMinor(priceMinor)
 
 		if mediaJson != nil && *mediaJson != "" {
 			err = json.Unmarshal([]byte(*mediaJson), &service.Media)
 			if err != nil {
-				return nil, fmt.Errorf("failed to decode media JSON: %w", err)
+				return nil, pagination.Meta{}, fmt.Errorf("failed to decode media JSON: %w", err)
 			}
 		} else {
 			service.Media = []MediaItem{}
 		}
 
 		services = append(services, service)
+		values = append(values, value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, pagination.Meta{}, err
+	}
+	services, meta := pagination.Finish(page, services, values, func(s Service) string { return strconv.FormatInt(s.ID, 10) }, total)
+
+	variants, err := getOptionsForUser(ctx, r.conn, OptionVariant, id)
+	if err != nil {
+		return nil, pagination.Meta{}, err
+	}
+	addOns, err := getOptionsForUser(ctx, r.conn, OptionAddOn, id)
+	if err != nil {
+		return nil, pagination.Meta{}, err
+	}
+	for i := range services {
+		services[i].Variants = variants[services[i].ID]
+		if services[i].Variants == nil {
+			services[i].Variants = []ServiceOption{}
+		}
+		services[i].AddOns = addOns[services[i].ID]
+		if services[i].AddOns == nil {
+			services[i].AddOns = []ServiceOption{}
+		}
 	}
 
-	return services, nil
+	return services, meta, nil
 }
 
-func GetServiceById(id, userId int64) (*Service, error) {
-	query := "SELECT id, name, description, price, duration, media, currency, timestamp, user_id FROM services WHERE user_id = $1 AND id = $2"
-	row := db.DB.QueryRow(query, userId, id)
+func (r postgresServices) GetByID(ctx context.Context, id, userId int64) (*Service, error) {
+	query := "SELECT id, name, description, COALESCE(price_minor, 0), duration, media, COALESCE(currency, ''), timestamp, user_id FROM services WHERE user_id = $1 AND id = $2"
+	row := r.conn.QueryRowContext(ctx, query, userId, id)
 
 	var service Service
 	var mediaJson *string
-	err := row.Scan(&service.ID, &service.Name, &service.Description, &service.Price, &service.Duration, &mediaJson, &service.Currency, &service.Timestamp, &service.UserID)
+	var priceMinor int64
+	err := row.Scan(&service.ID, &service.Name, &service.Description, &priceMinor, &service.Duration, &mediaJson, &service.Currency, &service.Timestamp, &service.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrServiceNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
+	service.setPriceMinor(priceMinor)
 	if mediaJson != nil && *mediaJson != "" {
 		err = json.Unmarshal([]byte(*mediaJson), &service.Media)
 		if err != nil {
@@ -89,61 +216,62 @@ func GetServiceById(id, userId int64) (*Service, error) {
 		service.Media = []MediaItem{}
 	}
 
+	service.Variants, err = getOptionsForService(ctx, r.conn, OptionVariant, service.ID, service.Currency)
+	if err != nil {
+		return nil, err
+	}
+	service.AddOns, err = getOptionsForService(ctx, r.conn, OptionAddOn, service.ID, service.Currency)
+	if err != nil {
+		return nil, err
+	}
+
 	return &service, nil
 }
 
-func (s *Service) CreateService() (*Service, error) {
+func (r postgresServices) Create(ctx context.Context, s *Service) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
 	mediaJson, err := json.Marshal(s.Media)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	query := `
-		INSERT INTO services(name, description, price, currency, duration, timestamp, user_id, media)
+		INSERT INTO services(name, description, price_minor, currency, duration, timestamp, user_id, media)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id
 	`
-	err = db.DB.QueryRow(
+	return r.conn.QueryRowContext(
+		ctx,
 		query,
 		s.Name,
 		s.Description,
-		s.Price,
+		s.priceMinor,
 		s.Currency,
 		s.Duration,
 		s.Timestamp,
 		s.UserID,
 		string(mediaJson),
 	).Scan(&s.ID)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return s, err
 }
 
-func (s *Service) UpdateService() error {
+func (r postgresServices) Update(ctx context.Context, s *Service) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
 	query := `
 		UPDATE services
-		SET name = $1, description = $2, price = $3, currency = $4, duration = $5, timestamp = $6
+		SET name = $1, description = $2, price_minor = $3, currency = $4, duration = $5, timestamp = $6
 		WHERE id = $7 AND user_id = $8
 	`
-
-	stmt, err := db.DB.Prepare(query)
-
-	if err != nil {
-		return err
-	}
-
-	defer stmt.Close()
-
-	_, err = stmt.Exec(s.Name, s.Description, s.Price, s.Currency, s.Duration, time.Now().UTC(), s.ID, s.UserID)
+	_, err := r.conn.ExecContext(ctx, query, s.Name, s.Description, s.priceMinor, s.Currency, s.Duration, time.Now().UTC(), s.ID, s.UserID)
 	return err
 }
 
-func (s *Service) SaveMedia() (*Service, error) {
+func (r postgresServices) SaveMedia(ctx context.Context, s *Service) error {
 	mediaJSON, err := json.Marshal(s.Media)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal media: %w", err)
+		return fmt.Errorf("failed to marshal media: %w", err)
 	}
 	query := `
 		UPDATE services
@@ -151,31 +279,17 @@ func (s *Service) SaveMedia() (*Service, error) {
 		WHERE id = $3 AND user_id = $4
 	`
 
-	stmt, err := db.DB.Prepare(query)
-	if err != nil {
-		return nil, err
-	}
-
-	defer stmt.Close()
-
 	now := time.Now().UTC()
 	s.Timestamp = &now
 
-	_, err = stmt.Exec(mediaJSON, s.Timestamp, s.ID, s.UserID)
-	return s, err
+	_, err = r.conn.ExecContext(ctx, query, mediaJSON, s.Timestamp, s.ID, s.UserID)
+	return err
 }
 
-func (s *Service) DeleteService() error {
+func (r postgresServices) Delete(ctx context.Context, id, userID int64) error {
 	query := `DELETE FROM services WHERE id = $1 AND user_id = $2`
 
-	stmt, err := db.DB.Prepare(query)
-	if err != nil {
-		return err
-	}
-
-	defer stmt.Close()
-
-	result, err := stmt.Exec(s.ID, s.UserID)
+	result, err := r.conn.ExecContext(ctx, query, id, userID)
 	if err != nil {
 		return err
 	}
@@ -186,7 +300,7 @@ func (s *Service) DeleteService() error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("service not found or you are not authorized to delete it")
+		return ErrServiceNotFound
 	}
 
 	return nil
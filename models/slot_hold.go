@@ -0,0 +1,200 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"example.com/db"
+)
+
+// SlotHoldDuration is how long a slot stays reserved while the client fills in the booking form
+const SlotHoldDuration = 10 * time.Minute
+
+// Holds don't need a CAPTCHA, so how many slots can be held at once is
+// capped per client address and per provider to keep a script from
+// emptying a provider's schedule
+const (
+	MaxHoldsPerIP       = 3
+	MaxHoldsPerProvider = 20
+)
+
+var (
+	ErrHoldNotFound = NotFound("hold_not_found", "slot hold not found or expired")
+	// ErrHoldExpired is returned when booking with a hold that ran out in the meantime
+	ErrHoldExpired  = Conflict("hold_expired", "slot hold expired")
+	ErrTooManyHolds = TooManyRequests("too_many_holds", "too many slots are being held, finish or release a booking first")
+)
+
+// SlotHold reserves a time range for a client during checkout. While it
+// exists the range is carved out of the schedule, so it is not publicly available.
+type SlotHold struct {
+	ID        string    `json:"id"`
+	UserID    int64     `json:"-"`
+	Date      string    `json:"date"`
+	StartTime string    `json:"startTime"`
+	EndTime   string    `json:"endTime"`
+	Token     string    `json:"token,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// IP is the address of the client holding the slot
+	IP string `json:"-"`
+}
+
+// postgresSlotHolds is the SlotHoldRepository backed by the slot_holds table
+type postgresSlotHolds struct {
+	conn db.DBTX
+}
+
+func (r postgresSlotHolds) Create(ctx context.Context, hold *SlotHold) error {
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+	hold.Token = token
+	hold.ExpiresAt = time.Now().UTC().Add(SlotHoldDuration)
+
+	return db.WithTx(ctx, r.conn, func(tx *sql.Tx) error {
+		// Concurrent holds for the same provider or address would all count
+		// the same holds and get past the caps, so they queue on a lock for
+		// each until this one commits. The provider's is always taken first.
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('slot_holds_user'), hashtext($1::text))`, hold.UserID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('slot_holds_ip'), hashtext($1))`, hold.IP); err != nil {
+			return err
+		}
+
+		var byIP, byProvider int
+		err := tx.QueryRowContext(ctx, `
+			SELECT COUNT(*) FILTER (WHERE ip = $2), COUNT(*) FILTER (WHERE user_id = $1)
+			FROM slot_holds
+			WHERE (ip = $2 OR user_id = $1) AND expires_at > NOW() AT TIME ZONE 'UTC'
+		`, hold.UserID, hold.IP).Scan(&byIP, &byProvider)
+		if err != nil {
+			return err
+		}
+		if byIP >= MaxHoldsPerIP || byProvider >= MaxHoldsPerProvider {
+			return ErrTooManyHolds
+		}
+
+		if err := carveSlot(ctx, tx, hold.UserID, hold.Date, hold.StartTime, hold.EndTime); err != nil {
+			return err
+		}
+		return tx.QueryRowContext(ctx, `
+			INSERT INTO slot_holds (user_id, date, start_time, end_time, token, expires_at, ip)
+			VALUES ($1, $2::date, $3::time, $4::time, $5, $6, $7)
+			RETURNING id
+		`, hold.UserID, hold.Date, hold.StartTime, hold.EndTime, hold.Token, hold.ExpiresAt, hold.IP).Scan(&hold.ID)
+	})
+}
+
+// Release gives a held slot back to the schedule before it expires
+func (r postgresSlotHolds) Release(ctx context.Context, holdID string, userID int64, token string) error {
+	return db.WithTx(ctx, r.conn, func(tx *sql.Tx) error {
+		hold, err := getSlotHoldForUpdate(ctx, tx, holdID, userID, token)
+		if err != nil {
+			return err
+		}
+		return deleteSlotHold(ctx, tx, hold, true)
+	})
+}
+
+// consumeSlotHold turns the client's hold into the appointment's slot. The
+// appointment must cover exactly the held range.
+func consumeSlotHold(ctx context.Context, tx *sql.Tx, appt *Appointment) error {
+	hold, err := getSlotHoldForUpdate(ctx, tx, appt.HoldID, appt.UserID, appt.HoldToken)
+	if errors.Is(err, ErrHoldNotFound) {
+		return ErrHoldExpired
+	}
+	if err != nil {
+		return err
+	}
+	if time.Now().UTC().After(hold.ExpiresAt) {
+		return ErrHoldExpired
+	}
+	if hold.Date != appt.Date || hold.StartTime != appt.StartTime || hold.EndTime != appt.EndTime {
+		return Invalid("hold_mismatch", fmt.Sprintf("booking does not match the held slot (%s %s-%s)", hold.Date, hold.StartTime, hold.EndTime))
+	}
+	return deleteSlotHold(ctx, tx, hold, false)
+}
+
+// Expire releases holds that ran out. It returns the number released.
+func (r postgresSlotHolds) Expire(ctx context.Context) (int, error) {
+	released := 0
+	err := db.WithTx(ctx, r.conn, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT id, user_id, date, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI'), token, expires_at
+			FROM slot_holds
+			WHERE expires_at < NOW() AT TIME ZONE 'UTC'
+			FOR UPDATE SKIP LOCKED
+		`)
+		if err != nil {
+			return err
+		}
+		var holds []SlotHold
+		for rows.Next() {
+			hold, err := scanSlotHold(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			holds = append(holds, *hold)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for i := range holds {
+			if err := deleteSlotHold(ctx, tx, &holds[i], true); err != nil {
+				return err
+			}
+		}
+		released = len(holds)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return released, nil
+}
+
+func getSlotHoldForUpdate(ctx context.Context, tx *sql.Tx, holdID string, userID int64, token string) (*SlotHold, error) {
+	row := tx.QueryRowContext(ctx, `
+		SELECT id, user_id, date, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI'), token, expires_at
+		FROM slot_holds
+		WHERE id::text = $1 AND user_id = $2 AND token = $3
+		FOR UPDATE
+	`, holdID, userID, token)
+	hold, err := scanSlotHold(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrHoldNotFound
+	}
+	return hold, err
+}
+
+// deleteSlotHold removes the hold, optionally restoring its range to the schedule
+func deleteSlotHold(ctx context.Context, tx *sql.Tx, hold *SlotHold, restore bool) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM slot_holds WHERE id = $1`, hold.ID)
+	if err != nil || !restore {
+		return err
+	}
+	return restoreAndMergeSlot(ctx, tx, hold.UserID, hold.Date, hold.StartTime, hold.EndTime)
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSlotHold(row rowScanner) (*SlotHold, error) {
+	var hold SlotHold
+	var date time.Time
+	err := row.Scan(&hold.ID, &hold.UserID, &date, &hold.StartTime, &hold.EndTime, &hold.Token, &hold.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	hold.Date = date.Format("2006-01-02")
+	return &hold, nil
+}
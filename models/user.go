@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 
@@ -25,7 +26,12 @@ type OAuthUser struct {
 	OAuthProviderID string
 }
 
-func (u *User) Save() error {
+// postgresUsers is the UserRepository backed by the users table
+type postgresUsers struct {
+	conn db.DBTX
+}
+
+func (r postgresUsers) Create(ctx context.Context, u *User) error {
 	query := `INSERT INTO users(email, password) VALUES ($1, $2) RETURNING id`
 
 	hashedPassword, err := utils.Hash(u.Password)
@@ -33,17 +39,23 @@ func (u *User) Save() error {
 		return err
 	}
 
-	err = db.DB.QueryRow(query, u.Email, hashedPassword).Scan(&u.ID)
+	err = r.conn.QueryRowContext(ctx, query, u.Email, hashedPassword).Scan(&u.ID)
+	if isUniqueViolation(err) {
+		return ErrEmailTaken
+	}
 	return err
 }
 
-func (u *User) ValidateCredentials() error {
+func (r postgresUsers) ValidateCredentials(ctx context.Context, u *User) error {
 	query := `SELECT id, password FROM users WHERE email = $1`
-	row := db.DB.QueryRow(query, u.Email)
+	row := r.conn.QueryRowContext(ctx, query, u.Email)
 
 	var retrievedPassword string
 	err := row.Scan(&u.ID, &retrievedPassword)
 
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidCredentials
+	}
 	if err != nil {
 		return err
 	}
@@ -51,34 +63,40 @@ func (u *User) ValidateCredentials() error {
 	passwordIsValid := utils.CheckPasswordHash(u.Password, retrievedPassword)
 
 	if !passwordIsValid {
-		return errors.New("invalid credentials")
+		return ErrInvalidCredentials
 	}
 
 	return nil
 }
 
-func GetUserByAlias(alias string) (*User, error) {
+func (r postgresUsers) GetByAlias(ctx context.Context, alias string) (*User, error) {
 	query := `SELECT id, email, alias FROM users WHERE alias = $1`
-	row := db.DB.QueryRow(query, alias)
+	row := r.conn.QueryRowContext(ctx, query, alias)
 
 	var user User
 	err := row.Scan(&user.ID, &user.Email, &user.Alias)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-func GetAlias(userId int64) (string, error) {
+func (r postgresUsers) GetAlias(ctx context.Context, userId int64) (string, error) {
 	query := `SELECT alias FROM users WHERE id = $1`
 	var alias string
-	err := db.DB.QueryRow(query, userId).Scan(&alias)
+	err := r.conn.QueryRowContext(ctx, query, userId).Scan(&alias)
 	return alias, err
 }
 
-func UpdateAlias(userId int64, alias string) error {
+func (r postgresUsers) UpdateAlias(ctx context.Context, userId int64, alias string) error {
 	query := `UPDATE users SET alias = $1 WHERE id = $2`
-	result, err := db.DB.Exec(query, alias, userId)
+	result, err := r.conn.ExecContext(ctx, query, alias, userId)
+	if isUniqueViolation(err) {
+		return ErrAliasTaken
+	}
 	if err != nil {
 		return err
 	}
@@ -87,16 +105,16 @@ func UpdateAlias(userId int64, alias string) error {
 		return err
 	}
 	if rowsAffected == 0 {
-		return errors.New("user not found")
+		return ErrUserNotFound
 	}
 	return nil
 }
 
-// FindOrCreateOAuthUser finds an existing OAuth user or creates a new one
-func FindOrCreateOAuthUser(oauthUser *OAuthUser) (*User, error) {
+// FindOrCreateOAuth finds an existing OAuth user or creates a new one
+func (r postgresUsers) FindOrCreateOAuth(ctx context.Context, oauthUser *OAuthUser) (*User, error) {
 	// First, try to find by OAuth provider and provider ID
 	query := `SELECT id, email, alias, name FROM users WHERE oauth_provider = $1 AND oauth_provider_id = $2`
-	row := db.DB.QueryRow(query, oauthUser.OAuthProvider, oauthUser.OAuthProviderID)
+	row := r.conn.QueryRowContext(ctx, query, oauthUser.OAuthProvider, oauthUser.OAuthProviderID)
 
 	var user User
 	var name sql.NullString
@@ -114,14 +132,14 @@ func FindOrCreateOAuthUser(oauthUser *OAuthUser) (*User, error) {
 
 	// Check if a user with this email already exists (linked to another provider or password auth)
 	emailQuery := `SELECT id, email, alias, name, oauth_provider FROM users WHERE email = $1`
-	row = db.DB.QueryRow(emailQuery, oauthUser.Email)
+	row = r.conn.QueryRowContext(ctx, emailQuery, oauthUser.Email)
 
 	var existingProvider sql.NullString
 	err = row.Scan(&user.ID, &user.Email, &user.Alias, &name, &existingProvider)
 	if err == nil {
 		// User exists with this email - update to link OAuth provider
 		updateQuery := `UPDATE users SET oauth_provider = $1, oauth_provider_id = $2, name = COALESCE(name, $3) WHERE id = $4`
-		_, err = db.DB.Exec(updateQuery, oauthUser.OAuthProvider, oauthUser.OAuthProviderID, oauthUser.Name, user.ID)
+		_, err = r.conn.ExecContext(ctx, updateQuery, oauthUser.OAuthProvider, oauthUser.OAuthProviderID, oauthUser.Name, user.ID)
 		if err != nil {
 			return nil, err
 		}
@@ -141,7 +159,7 @@ func FindOrCreateOAuthUser(oauthUser *OAuthUser) (*User, error) {
 		VALUES ($1, $2, $3, $4)
 		RETURNING id, alias
 	`
-	err = db.DB.QueryRow(insertQuery, oauthUser.Email, oauthUser.Name, oauthUser.OAuthProvider, oauthUser.OAuthProviderID).Scan(&user.ID, &user.Alias)
+	err = r.conn.QueryRowContext(ctx, insertQuery, oauthUser.Email, oauthUser.Name, oauthUser.OAuthProvider, oauthUser.OAuthProviderID).Scan(&user.ID, &user.Alias)
 	if err != nil {
 		return nil, err
 	}
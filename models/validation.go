@@ -0,0 +1,225 @@
+package models
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"example.com/config"
+	"github.com/nyaruka/phonenumbers"
+)
+
+const (
+	maxNameLength      = 100
+	maxEmailLength     = 254
+	maxInstagramLength = 30
+)
+
+// ValidationErrors collects every invalid field of a request so clients can
+// show them all at once
+type ValidationErrors []*ValidationError
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, len(v))
+	for i, e := range v {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (v *ValidationErrors) Add(field, message string) {
+	*v = append(*v, &ValidationError{Field: field, Message: message})
+}
+
+// Err returns nil when nothing was invalid, so callers can `return errs.Err()`
+func (v ValidationErrors) Err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
+
+var (
+	// timeZone is where schedules and bookings are
+	timeZone = time.UTC
+	// phoneRegion is the country phone numbers without a country code are
+	// dialled in; empty when they must have one
+	phoneRegion string
+)
+
+// Init sets how the dates, times and phone numbers clients give are read
+func Init(cfg config.LocaleConfig) {
+	if loc, err := time.LoadLocation(cfg.TimeZone); err == nil {
+		timeZone = loc
+	}
+	phoneRegion = cfg.PhoneRegion
+}
+
+// Today returns the current date where bookings are, at midnight UTC like the
+// dates ParseDate returns
+func Today() time.Time {
+	y, m, d := time.Now().In(timeZone).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// LocalTime returns t on the clock where bookings are
+func LocalTime(t time.Time) time.Time {
+	return t.In(timeZone)
+}
+
+// NormalizeE164 converts a phone number to E.164 ("+442079460958"). It may
+// be written with a country code ("+44 20 7946 0958", "0044-20-7946-0958")
+// or, when a phone region is configured, as dialled there ("020 7946 0958").
+func NormalizeE164(phone string) (string, error) {
+	s := strings.TrimSpace(phone)
+	// An international prefix only means "+" in the countries that use it
+	if rest, ok := strings.CutPrefix(s, "00"); ok {
+		s = "+" + rest
+	}
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+		case r == '+' || r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", fmt.Errorf("must contain only digits, spaces, dashes, dots and parentheses")
+		}
+	}
+	if !strings.HasPrefix(s, "+") && phoneRegion == "" {
+		return "", fmt.Errorf("must include the country code, e.g. +14155552671")
+	}
+
+	number, err := phonenumbers.Parse(s, phoneRegion)
+	if err != nil || !phonenumbers.IsValidNumber(number) {
+		return "", fmt.Errorf("is not a valid phone number")
+	}
+	return phonenumbers.Format(number, phonenumbers.E164), nil
+}
+
+// NormalizeEmailAddress checks a bare address ("jane@example.com", no display
+// name) and lowercases it. Its result is the NormalizeEmail of the address.
+func NormalizeEmailAddress(email string) (string, error) {
+	s := strings.TrimSpace(email)
+	if len(s) > maxEmailLength {
+		return "", fmt.Errorf("must be at most %d characters", maxEmailLength)
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s || addr.Name != "" {
+		return "", fmt.Errorf("is not a valid email address")
+	}
+	domain := s[strings.LastIndex(s, "@")+1:]
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", fmt.Errorf("is not a valid email address")
+	}
+	return NormalizeEmail(s), nil
+}
+
+// ParseDate parses a "YYYY-MM-DD" date, rejecting any other spelling
+func ParseDate(s string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil || t.Format("2006-01-02") != s {
+		return time.Time{}, fmt.Errorf("must be a date (YYYY-MM-DD)")
+	}
+	return t, nil
+}
+
+// ParseClock parses an "HH:MM" time of day, rejecting any other spelling
+func ParseClock(s string) (time.Time, error) {
+	t, err := time.Parse(timeLayout, s)
+	if err != nil || t.Format(timeLayout) != s {
+		return time.Time{}, fmt.Errorf("must be a time (HH:MM)")
+	}
+	return t, nil
+}
+
+// ValidateSlotTime checks a booking's date and times are well-formed, in
+// order and not in the past. endTime may be empty when it is derived from
+// the booked services.
+func ValidateSlotTime(date, startTime, endTime string) error {
+	var errs ValidationErrors
+	validateSlotTime(&errs, date, startTime, endTime)
+	return errs.Err()
+}
+
+func validateSlotTime(errs *ValidationErrors, date, startTime, endTime string) {
+	day, dateErr := ParseDate(date)
+	if dateErr != nil {
+		errs.Add("date", dateErr.Error())
+	}
+	start, startErr := ParseClock(startTime)
+	if startErr != nil {
+		errs.Add("startTime", startErr.Error())
+	}
+	if endTime != "" {
+		end, err := ParseClock(endTime)
+		if err != nil {
+			errs.Add("endTime", err.Error())
+		} else if startErr == nil && !start.Before(end) {
+			errs.Add("endTime", "must be after startTime")
+		}
+	}
+	if dateErr == nil && startErr == nil {
+		startsAt := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, timeZone)
+		if startsAt.Before(time.Now()) {
+			errs.Add("date", "must not be in the past")
+		}
+	}
+}
+
+// validateContact trims and normalizes a client's contact details in place
+func validateContact(errs *ValidationErrors, firstName, lastName, email, phone *string) {
+	validateName(errs, "firstName", firstName)
+	validateName(errs, "lastName", lastName)
+
+	normalized, err := NormalizeEmailAddress(*email)
+	if err != nil {
+		errs.Add("email", err.Error())
+	} else {
+		*email = normalized
+	}
+
+	normalized, err = NormalizeE164(*phone)
+	if err != nil {
+		errs.Add("phone", err.Error())
+	} else {
+		*phone = normalized
+	}
+}
+
+func validateName(errs *ValidationErrors, field string, name *string) {
+	*name = strings.TrimSpace(*name)
+	switch {
+	case *name == "":
+		errs.Add(field, "is required")
+	case utf8.RuneCountInString(*name) > maxNameLength:
+		errs.Add(field, fmt.Sprintf("must be at most %d characters", maxNameLength))
+	}
+}
+
+// validateInstagram accepts "@handle" or "handle" and stores the bare handle
+func validateInstagram(errs *ValidationErrors, handle *string) {
+	*handle = strings.TrimPrefix(strings.TrimSpace(*handle), "@")
+	if *handle == "" {
+		return
+	}
+	if len(*handle) > maxInstagramLength {
+		errs.Add("instagram", fmt.Sprintf("must be at most %d characters", maxInstagramLength))
+		return
+	}
+	for _, r := range *handle {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_') {
+			errs.Add("instagram", "may contain only letters, digits, dots and underscores")
+			return
+		}
+	}
+}
+
+// Validate checks and normalizes the client-supplied fields of a booking
+func (a *Appointment) Validate() error {
+	var errs ValidationErrors
+	validateContact(&errs, &a.FirstName, &a.LastName, &a.Email, &a.Phone)
+	validateInstagram(&errs, &a.Instagram)
+	validateSlotTime(&errs, a.Date, a.StartTime, a.EndTime)
+	return errs.Err()
+}
@@ -0,0 +1,514 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"example.com/db"
+)
+
+const (
+	// WaitlistClaimWindow is how long a client has to claim a slot they were offered
+	WaitlistClaimWindow = 30 * time.Minute
+	// MaxWaitlistDays caps the date range a client can wait for
+	MaxWaitlistDays = 90
+)
+
+const (
+	WaitlistWaiting   = "waiting"
+	WaitlistBooked    = "booked"
+	WaitlistCancelled = "cancelled"
+)
+
+var (
+	ErrWaitlistEntryNotFound = NotFound("waitlist_entry_not_found", "waitlist entry not found")
+	ErrWaitlistOfferNotFound = NotFound("waitlist_offer_not_found", "waitlist offer not found or expired")
+)
+
+// WaitlistEntry is a client waiting for a slot for a service within a date range
+type WaitlistEntry struct {
+	ID        string  `json:"id"`
+	UserID    int64   `json:"-"`
+	ServiceID int64   `json:"serviceId" binding:"required"`
+	VariantID *int64  `json:"variantId,omitempty"`
+	AddOnIDs  []int64 `json:"addOnIds,omitempty"`
+	DateFrom  string  `json:"dateFrom" binding:"required"`
+	DateTo    string  `json:"dateTo" binding:"required"`
+	FirstName string  `json:"firstName" binding:"required"`
+	LastName  string  `json:"lastName" binding:"required"`
+	Email     string  `json:"email" binding:"required"`
+	Phone     string  `json:"phone" binding:"required"`
+	Status    string  `json:"status"`
+	// Token lets the client leave the waitlist; only returned on creation
+	Token string `json:"token,omitempty"`
+	// Offer is the slot currently offered to the client, if any
+	Offer     *WaitlistOffer `json:"offer,omitempty"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+// WaitlistOffer is a freed slot offered to one waitlisted client until it
+// expires, when it passes to the next in line
+type WaitlistOffer struct {
+	EntryID   string    `json:"-"`
+	Alias     string    `json:"-"`
+	Date      string    `json:"date"`
+	StartTime string    `json:"startTime"`
+	EndTime   string    `json:"endTime"`
+	Token     string    `json:"-"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Entry is the waitlisted client the offer was made to
+	Entry *WaitlistEntry `json:"-"`
+}
+
+func (e *WaitlistEntry) Validate() error {
+	var errs ValidationErrors
+	validateContact(&errs, &e.FirstName, &e.LastName, &e.Email, &e.Phone)
+
+	from, fromErr := ParseDate(e.DateFrom)
+	if fromErr != nil {
+		errs.Add("dateFrom", fromErr.Error())
+	}
+	to, toErr := ParseDate(e.DateTo)
+	if toErr != nil {
+		errs.Add("dateTo", toErr.Error())
+	}
+	if fromErr == nil && toErr == nil {
+		switch {
+		case to.Before(from):
+			errs.Add("dateTo", "must not be before dateFrom")
+		case to.Before(Today()):
+			errs.Add("dateTo", "must not be in the past")
+		case to.Sub(from) > MaxWaitlistDays*24*time.Hour:
+			errs.Add("dateTo", fmt.Sprintf("range must not exceed %d days", MaxWaitlistDays))
+		}
+	}
+	return errs.Err()
+}
+
+// duration returns the minutes the waited-for service takes with its selected options
+func (e *WaitlistEntry) duration(ctx context.Context, conn db.DBTX) (int64, error) {
+	service, err := postgresServices{conn: conn}.GetByID(ctx, e.ServiceID, e.UserID)
+	if err != nil || service == nil {
+		return 0, ErrServiceNotFound
+	}
+	_, duration, _, err := service.ResolveSelection(e.VariantID, e.AddOnIDs)
+	return duration, err
+}
+
+// postgresWaitlist is the WaitlistRepository backed by the waitlist_entries
+// and freed_slots tables
+type postgresWaitlist struct {
+	conn db.DBTX
+}
+
+func (r postgresWaitlist) Create(ctx context.Context, e *WaitlistEntry) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	if _, err := e.duration(ctx, r.conn); err != nil {
+		return err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+	e.Token = token
+	e.Status = WaitlistWaiting
+
+	addOnsJSON, err := json.Marshal(nonNilIDs(e.AddOnIDs))
+	if err != nil {
+		return err
+	}
+	return r.conn.QueryRowContext(ctx, `
+		INSERT INTO waitlist_entries (user_id, service_id, variant_id, add_on_ids, date_from, date_to,
+		                              first_name, last_name, email, phone, status, token)
+		VALUES ($1, $2, $3, $4, $5::date, $6::date, $7, $8, $9, $10, $11, $12)
+		RETURNING id, created_at
+	`, e.UserID, e.ServiceID, e.VariantID, string(addOnsJSON), e.DateFrom, e.DateTo,
+		e.FirstName, e.LastName, e.Email, e.Phone, e.Status, e.Token,
+	).Scan(&e.ID, &e.CreatedAt)
+}
+
+// List returns the provider's active waitlist in the order clients joined
+func (r postgresWaitlist) List(ctx context.Context, userID int64) ([]WaitlistEntry, error) {
+	rows, err := r.conn.QueryContext(ctx, `
+		SELECT `+waitlistColumns+`
+		FROM waitlist_entries
+		WHERE user_id = $1 AND status = $2 AND date_to >= $3::date
+		ORDER BY created_at
+	`, userID, WaitlistWaiting, Today().Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []WaitlistEntry
+	for rows.Next() {
+		e, err := scanWaitlistEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		e.Token = ""
+		out = append(out, *e)
+	}
+	return out, rows.Err()
+}
+
+// Leave cancels an entry for the client holding its token
+func (r postgresWaitlist) Leave(ctx context.Context, entryID string, userID int64, token string) error {
+	result, err := r.conn.ExecContext(ctx, `
+		UPDATE waitlist_entries SET status = $1
+		WHERE id::text = $2 AND user_id = $3 AND token = $4 AND status = $5
+	`, WaitlistCancelled, entryID, userID, token, WaitlistWaiting)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrWaitlistEntryNotFound
+	}
+	return nil
+}
+
+// GetOffer returns the entry holding an unexpired offer for the given claim token
+func (r postgresWaitlist) GetOffer(ctx context.Context, entryID string, userID int64, offerToken string) (*WaitlistEntry, error) {
+	row := r.conn.QueryRowContext(ctx, `
+		SELECT `+waitlistColumns+`
+		FROM waitlist_entries
+		WHERE id::text = $1 AND user_id = $2 AND offer_token = $3 AND status = $4
+		  AND offer_expires_at > NOW() AT TIME ZONE 'UTC'
+	`, entryID, userID, offerToken, WaitlistWaiting)
+	e, err := scanWaitlistEntry(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWaitlistOfferNotFound
+	}
+	return e, err
+}
+
+// MarkBooked closes an entry once its offer was claimed. Run in the booking's
+// transaction, it keeps an offer that lapsed meanwhile from being booked.
+func (r postgresWaitlist) MarkBooked(ctx context.Context, entryID, offerToken, appointmentID string) error {
+	result, err := r.conn.ExecContext(ctx, `
+		UPDATE waitlist_entries
+		SET status = $1, appointment_id = $2, offer_token = NULL, offer_expires_at = NULL
+		WHERE id::text = $3 AND offer_token = $4 AND status = $5
+		  AND offer_expires_at > NOW() AT TIME ZONE 'UTC'
+	`, WaitlistBooked, appointmentID, entryID, offerToken, WaitlistWaiting)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrWaitlistOfferNotFound
+	}
+	return nil
+}
+
+// markSlotFreed records that availability opened up on a day so the waitlist
+// is checked once the surrounding transaction commits
+func markSlotFreed(ctx context.Context, tx *sql.Tx, userID int64, date string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO freed_slots (user_id, date) VALUES ($1, $2::date)
+	`, userID, date)
+	return err
+}
+
+// OfferFreedSlots matches days where availability opened up against waiting
+// clients, in the order they joined. Each slot is offered to one client at a
+// time: the first in line whose service fits it. An offer that lapses passes
+// the day to the next in line. It returns the offers made so they can be
+// sent out.
+func (r postgresWaitlist) OfferFreedSlots(ctx context.Context) ([]WaitlistOffer, error) {
+	var offers []WaitlistOffer
+	err := db.WithTx(ctx, r.conn, func(tx *sql.Tx) error {
+		// Lapsed offers free their slot again, and their clients are skipped
+		// for that day
+		_, err := tx.ExecContext(ctx, `
+			WITH lapsed AS (
+				UPDATE waitlist_entries
+				SET passed_dates = array_append(passed_dates, offer_date),
+				    offer_date = NULL, offer_start = NULL, offer_end = NULL, offer_token = NULL, offer_expires_at = NULL
+				WHERE status = $1 AND offer_token IS NOT NULL AND offer_expires_at <= NOW() AT TIME ZONE 'UTC'
+				RETURNING user_id, passed_dates[cardinality(passed_dates)] AS date
+			)
+			INSERT INTO freed_slots (user_id, date) SELECT user_id, date FROM lapsed
+		`, WaitlistWaiting)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.QueryContext(ctx, `
+			SELECT id, user_id, date FROM freed_slots
+			ORDER BY id
+			FOR UPDATE SKIP LOCKED
+		`)
+		if err != nil {
+			return err
+		}
+		type freedDay struct {
+			userID int64
+			date   string
+		}
+		var ids []int64
+		var days []freedDay
+		seen := make(map[freedDay]bool)
+		for rows.Next() {
+			var id int64
+			var day freedDay
+			var date time.Time
+			if err := rows.Scan(&id, &day.userID, &date); err != nil {
+				rows.Close()
+				return err
+			}
+			day.date = date.Format("2006-01-02")
+			ids = append(ids, id)
+			if !seen[day] {
+				seen[day] = true
+				days = append(days, day)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		today := Today().Format("2006-01-02")
+		for _, day := range days {
+			if day.date < today {
+				continue
+			}
+			dayOffers, err := offerDay(ctx, tx, day.userID, day.date)
+			if err != nil {
+				return err
+			}
+			offers = append(offers, dayOffers...)
+		}
+
+		for _, id := range ids {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM freed_slots WHERE id = $1`, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return offers, nil
+}
+
+func offerDay(ctx context.Context, tx *sql.Tx, userID int64, date string) ([]WaitlistOffer, error) {
+	var free []TimeRange
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')
+		FROM schedules
+		WHERE user_id = $1 AND date = $2::date
+		ORDER BY start_time
+	`, userID, date)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var tr TimeRange
+		if err := rows.Scan(&tr.ID, &tr.StartTime, &tr.EndTime); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		free = append(free, tr)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Slots offered to someone stay theirs until the offer lapses
+	rows, err = tx.QueryContext(ctx, `
+		SELECT to_char(offer_start, 'HH24:MI'), to_char(offer_end, 'HH24:MI')
+		FROM waitlist_entries
+		WHERE user_id = $1 AND status = $2 AND offer_date = $3::date
+		  AND offer_expires_at > NOW() AT TIME ZONE 'UTC'
+	`, userID, WaitlistWaiting, date)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var start, end string
+		if err := rows.Scan(&start, &end); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		free = withoutRange(free, start, end)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(free) == 0 {
+		return nil, nil
+	}
+
+	// Clients already holding a live offer keep it rather than being
+	// re-offered, and those who let one lapse for the day wait for the next
+	rows, err = tx.QueryContext(ctx, `
+		SELECT `+waitlistColumns+`
+		FROM waitlist_entries
+		WHERE user_id = $1 AND status = $2
+		  AND date_from <= $3::date AND date_to >= $3::date
+		  AND offer_token IS NULL AND NOT ($3::date = ANY(passed_dates))
+		ORDER BY created_at
+		FOR UPDATE SKIP LOCKED
+	`, userID, WaitlistWaiting, date)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*WaitlistEntry
+	for rows.Next() {
+		e, err := scanWaitlistEntry(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var alias string
+	if len(entries) > 0 {
+		if err := tx.QueryRowContext(ctx, `SELECT COALESCE(alias, '') FROM users WHERE id = $1`, userID).Scan(&alias); err != nil {
+			return nil, err
+		}
+	}
+
+	var offers []WaitlistOffer
+	for _, e := range entries {
+		duration, err := e.duration(ctx, tx)
+		if err != nil || duration <= 0 {
+			// The service or its options changed since the client joined
+			continue
+		}
+		start, end, ok := firstFit(free, duration)
+		if !ok {
+			continue
+		}
+
+		token, err := newToken()
+		if err != nil {
+			return nil, err
+		}
+		offer := WaitlistOffer{
+			EntryID:   e.ID,
+			Alias:     alias,
+			Date:      date,
+			StartTime: start,
+			EndTime:   end,
+			Token:     token,
+			ExpiresAt: time.Now().UTC().Add(WaitlistClaimWindow),
+			Entry:     e,
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE waitlist_entries
+			SET offer_date = $1::date, offer_start = $2::time, offer_end = $3::time, offer_token = $4, offer_expires_at = $5
+			WHERE id = $6
+		`, offer.Date, offer.StartTime, offer.EndTime, offer.Token, offer.ExpiresAt, e.ID)
+		if err != nil {
+			return nil, err
+		}
+		e.Offer = &offer
+		offers = append(offers, offer)
+		// The next in line can only be offered what is left
+		free = withoutRange(free, start, end)
+	}
+	return offers, nil
+}
+
+// withoutRange removes start-end from the free ranges
+func withoutRange(free []TimeRange, start, end string) []TimeRange {
+	var out []TimeRange
+	for _, tr := range free {
+		if end <= tr.StartTime || start >= tr.EndTime {
+			out = append(out, tr)
+			continue
+		}
+		if tr.StartTime < start {
+			out = append(out, TimeRange{ID: tr.ID, StartTime: tr.StartTime, EndTime: start})
+		}
+		if end < tr.EndTime {
+			out = append(out, TimeRange{ID: tr.ID, StartTime: end, EndTime: tr.EndTime})
+		}
+	}
+	return out
+}
+
+// firstFit returns the earliest slot of the given length within the free ranges
+func firstFit(free []TimeRange, minutes int64) (string, string, bool) {
+	for _, tr := range free {
+		end, err := addMinutes(tr.StartTime, minutes)
+		if err != nil {
+			continue
+		}
+		if end <= tr.EndTime {
+			return tr.StartTime, end, true
+		}
+	}
+	return "", "", false
+}
+
+func nonNilIDs(ids []int64) []int64 {
+	if ids == nil {
+		return []int64{}
+	}
+	return ids
+}
+
+const waitlistColumns = `id, user_id, service_id, variant_id, add_on_ids, date_from, date_to,
+		       first_name, last_name, email, phone, status, token,
+		       offer_date, to_char(offer_start, 'HH24:MI'), to_char(offer_end, 'HH24:MI'), offer_token, offer_expires_at,
+		       created_at`
+
+func scanWaitlistEntry(row rowScanner) (*WaitlistEntry, error) {
+	var e WaitlistEntry
+	var variantID sql.NullInt64
+	var addOnsJSON []byte
+	var from, to time.Time
+	var offerDate, offerExpiresAt sql.NullTime
+	var offerStart, offerEnd, offerToken sql.NullString
+	err := row.Scan(&e.ID, &e.UserID, &e.ServiceID, &variantID, &addOnsJSON, &from, &to,
+		&e.FirstName, &e.LastName, &e.Email, &e.Phone, &e.Status, &e.Token,
+		&offerDate, &offerStart, &offerEnd, &offerToken, &offerExpiresAt, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if variantID.Valid {
+		e.VariantID = &variantID.Int64
+	}
+	if err := json.Unmarshal(addOnsJSON, &e.AddOnIDs); err != nil {
+		return nil, err
+	}
+	e.DateFrom = from.Format("2006-01-02")
+	e.DateTo = to.Format("2006-01-02")
+	if offerDate.Valid && offerExpiresAt.Valid && offerExpiresAt.Time.After(time.Now().UTC()) {
+		e.Offer = &WaitlistOffer{
+			EntryID:   e.ID,
+			Date:      offerDate.Time.Format("2006-01-02"),
+			StartTime: offerStart.String,
+			EndTime:   offerEnd.String,
+			Token:     offerToken.String,
+			ExpiresAt: offerExpiresAt.Time,
+		}
+	}
+	return &e, nil
+}
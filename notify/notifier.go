@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"context"
+
+	"example.com/config"
+	"example.com/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// Message is a plain-text notification to a client
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier delivers messages to clients
+type Notifier interface {
+	Name() string
+	Send(ctx context.Context, msg Message) error
+}
+
+// Default is the notifier selected by NOTIFIER. It falls back to logging so
+// flows that notify clients still work in development.
+var Default Notifier = Log{}
+
+func Init(cfg config.NotifierConfig) {
+	switch cfg.Kind {
+	case "smtp":
+		Default = NewSMTP(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom)
+	case "", "log":
+		Default = Log{}
+	default:
+		logging.Logger.Warnf("Unknown NOTIFIER %q, logging notifications instead", cfg.Kind)
+		Default = Log{}
+	}
+}
+
+// Log writes messages to the application log instead of delivering them
+type Log struct{}
+
+func (Log) Name() string { return "log" }
+
+func (Log) Send(ctx context.Context, msg Message) error {
+	logging.FromContext(ctx).WithFields(logrus.Fields{
+		"to":      msg.To,
+		"subject": msg.Subject,
+		"body":    msg.Body,
+	}).Info("notification")
+	return nil
+}
@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"example.com/config"
+	"example.com/logging"
+	"example.com/models"
+)
+
+// ProcessWaitlist offers freed slots to waitlisted clients and sends each a
+// claim link. It returns the number of offers sent.
+func ProcessWaitlist(ctx context.Context, waitlist models.WaitlistRepository) (int, error) {
+	offers, err := waitlist.OfferFreedSlots(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, offer := range offers {
+		if err := Default.Send(ctx, waitlistOfferMessage(offer)); err != nil {
+			logging.FromContext(ctx).WithError(err).WithField("waitlistEntryId", offer.EntryID).Error("failed to send waitlist offer")
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+func waitlistOfferMessage(offer models.WaitlistOffer) Message {
+	claimURL := fmt.Sprintf("%s/booking/%s/waitlist/%s/claim?token=%s",
+		config.FrontendURL, url.PathEscape(offer.Alias), url.PathEscape(offer.EntryID), url.QueryEscape(offer.Token))
+	// Slots are in the business's local time, so the deadline is too
+	expiresAt := models.LocalTime(offer.ExpiresAt)
+	return Message{
+		To:      offer.Entry.Email,
+		Subject: "A slot opened up for you",
+		Body: fmt.Sprintf("Hi %s,\n\nA slot is available on %s at %s. Claim it before %s at %s:\n%s\n",
+			offer.Entry.FirstName, offer.Date, offer.StartTime,
+			expiresAt.Format("2006-01-02"), expiresAt.Format("15:04"), claimURL),
+	}
+}
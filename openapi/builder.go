@@ -0,0 +1,271 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fields describes an ad-hoc JSON object such as a gin.H body. Each value is
+// an example of the field's type, e.g. Fields{"clients": []models.Client{}}.
+type Fields map[string]any
+
+// File is a file part of a multipart form
+type File struct{}
+
+// Op documents a single route
+type Op struct {
+	Method string
+	// Path uses gin syntax, e.g. /api/services/:id
+	Path    string
+	Tag     string
+	Summary string
+	// Auth marks routes behind the authentication middleware
+	Auth  bool
+	Query []Parameter
+	// Body is an example of the JSON request body, Form of a multipart one
+	Body any
+	Form Fields
+	// Status is the success status, 200 when zero
+	Status int
+	// Response is an example of the JSON success body, nil when there is none
+	Response any
+	// ContentType overrides application/json for the success body
+	ContentType string
+	Deprecated  bool
+}
+
+type Builder struct {
+	doc       *Document
+	overrides map[reflect.Type]*Schema
+	security  string
+	problem   *Schema
+}
+
+func New(info Info) *Builder {
+	b := &Builder{
+		doc: &Document{
+			OpenAPI: Version,
+			Info:    info,
+			Paths:   map[string]PathItem{},
+			Components: Components{
+				Schemas:         map[string]*Schema{},
+				SecuritySchemes: map[string]*SecurityScheme{},
+			},
+		},
+		overrides: map[reflect.Type]*Schema{},
+	}
+	b.Override(time.Time{}, &Schema{Type: "string", Format: "date-time"})
+	b.Override(File{}, &Schema{Type: "string", Format: "binary"})
+	return b
+}
+
+// Override sets the schema of a type with a custom JSON encoding
+func (b *Builder) Override(example any, s *Schema) {
+	b.overrides[reflect.TypeOf(example)] = s
+}
+
+// Security registers the scheme required by operations with Auth set
+func (b *Builder) Security(name string, scheme *SecurityScheme) {
+	b.doc.Components.SecuritySchemes[name] = scheme
+	b.security = name
+}
+
+// Problem sets the error body every operation may return
+func (b *Builder) Problem(example any) {
+	b.problem = b.schemaOf(reflect.TypeOf(example))
+}
+
+func (b *Builder) Add(ops ...Op) {
+	for _, op := range ops {
+		b.add(op)
+	}
+}
+
+func (b *Builder) Document() *Document {
+	return b.doc
+}
+
+func (b *Builder) add(op Op) {
+	path, params := Path(op.Path)
+	item := b.doc.Paths[path]
+	if item == nil {
+		item = PathItem{}
+		b.doc.Paths[path] = item
+	}
+
+	operation := &Operation{
+		Summary:    op.Summary,
+		Responses:  map[string]*Response{},
+		Deprecated: op.Deprecated,
+	}
+	if op.Tag != "" {
+		operation.Tags = []string{op.Tag}
+	}
+	for _, name := range params {
+		operation.Parameters = append(operation.Parameters, Parameter{
+			Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"},
+		})
+	}
+	for _, p := range op.Query {
+		if p.In == "" {
+			p.In = "query"
+		}
+		if p.Schema == nil {
+			p.Schema = &Schema{Type: "string"}
+		}
+		operation.Parameters = append(operation.Parameters, p)
+	}
+
+	switch {
+	case op.Body != nil:
+		operation.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{"application/json": {Schema: b.valueSchema(op.Body)}},
+		}
+	case op.Form != nil:
+		operation.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{"multipart/form-data": {Schema: b.valueSchema(op.Form)}},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := &Response{Description: http.StatusText(status)}
+	if op.Response != nil {
+		contentType := op.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		success.Content = map[string]MediaType{contentType: {Schema: b.valueSchema(op.Response)}}
+	}
+	operation.Responses[strconv.Itoa(status)] = success
+	if b.problem != nil {
+		operation.Responses["default"] = &Response{
+			Description: "Error",
+			Content:     map[string]MediaType{"application/problem+json": {Schema: b.problem}},
+		}
+	}
+
+	if op.Auth && b.security != "" {
+		operation.Security = []map[string][]string{{b.security: {}}}
+	}
+	item[strings.ToLower(op.Method)] = operation
+}
+
+// Path converts a gin route path to an OpenAPI one and lists its parameters
+func Path(ginPath string) (string, []string) {
+	segments := strings.Split(ginPath, "/")
+	var params []string
+	for i, seg := range segments {
+		if len(seg) > 1 && (seg[0] == ':' || seg[0] == '*') {
+			params = append(params, seg[1:])
+			segments[i] = "{" + seg[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func (b *Builder) valueSchema(v any) *Schema {
+	if fields, ok := v.(Fields); ok {
+		s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		for name, example := range fields {
+			s.Properties[name] = b.valueSchema(example)
+		}
+		return s
+	}
+	return b.schemaOf(reflect.TypeOf(v))
+}
+
+// schemaOf describes how encoding/json writes values of type t. Named structs
+// become shared components.
+func (b *Builder) schemaOf(t reflect.Type) *Schema {
+	if s, ok := b.overrides[t]; ok {
+		copied := *s
+		return &copied
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := b.schemaOf(t.Elem())
+		if s.Ref == "" {
+			s.Nullable = true
+		}
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if t.Size() == 8 {
+			return &Schema{Type: "integer", Format: "int64"}
+		}
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		name := t.Name()
+		if _, ok := b.doc.Components.Schemas[name]; !ok {
+			// Registered before recursing so self-referencing types terminate
+			b.doc.Components.Schemas[name] = &Schema{}
+			*b.doc.Components.Schemas[name] = *b.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	return &Schema{}
+}
+
+func (b *Builder) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	b.addFields(s, t)
+	sort.Strings(s.Required)
+	return s
+}
+
+func (b *Builder) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				b.addFields(s, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = b.schemaOf(f.Type)
+		if strings.Contains(f.Tag.Get("binding"), "required") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
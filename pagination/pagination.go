@@ -0,0 +1,278 @@
+// Package pagination implements keyset pagination for list endpoints. Pages
+// are addressed by opaque cursors encoding the sort value and id of the last
+// item returned, so results stay stable while rows are inserted.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// Column is a sortable SQL expression. Expr must never be NULL; Type is the
+// Postgres type cursor values are cast back to: bigint, uuid, timestamp or
+// text.
+type Column struct {
+	Expr string
+	Type string
+}
+
+// Keyset lists the sort orders a list endpoint allows
+type Keyset struct {
+	// Sorts maps a client-facing sort key ("date", "name") to its column
+	Sorts map[string]Column
+	// Default is the sort key used when none is requested; prefix with "-"
+	// for descending order
+	Default string
+	// ID breaks ties between rows with the same sort value
+	ID Column
+}
+
+// Request is a validated page request
+type Request struct {
+	// Limit is the page size, or 0 for every item past the cursor
+	Limit  int
+	Sort   string
+	Desc   bool
+	column Column
+	id     Column
+	after  *cursor
+}
+
+// FieldError reports an invalid pagination parameter
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// cursor is the position after the last item of a page
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"i"`
+}
+
+// Parse validates the limit, sort and cursor query parameters against ks.
+// Empty parameters select the first page in the default order.
+func (ks Keyset) Parse(limit, sort, after string) (Request, error) {
+	r := Request{Limit: DefaultLimit, id: ks.ID}
+
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxLimit {
+			return Request{}, &FieldError{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", MaxLimit)}
+		}
+		r.Limit = n
+	}
+
+	if sort == "" {
+		sort = ks.Default
+	}
+	r.Sort = sort
+	key := strings.TrimPrefix(sort, "-")
+	r.Desc = key != sort
+	column, ok := ks.Sorts[key]
+	if !ok {
+		return Request{}, &FieldError{Field: "sort", Message: "must be one of " + strings.Join(ks.keys(), ", ")}
+	}
+	r.column = column
+
+	if after != "" {
+		c, err := decodeCursor(after)
+		if err != nil {
+			return Request{}, &FieldError{Field: "cursor", Message: "is not a valid cursor"}
+		}
+		if c.Sort != r.Sort {
+			return Request{}, &FieldError{Field: "cursor", Message: "was issued for a different sort order"}
+		}
+		if !castable(c.Value, column.Type) || !castable(c.ID, ks.ID.Type) {
+			return Request{}, &FieldError{Field: "cursor", Message: "is not a valid cursor"}
+		}
+		r.after = c
+	}
+	return r, nil
+}
+
+// timestampLayouts are the text forms of timestamps cursors carry: as
+// Postgres prints them, and as the in-memory repositories do
+var timestampLayouts = []string{"2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999", "2006-01-02 15:04"}
+
+// castable reports whether a cursor value casts to the Postgres type t, so
+// a tampered cursor is refused rather than failing the query
+func castable(value, t string) bool {
+	switch t {
+	case "bigint":
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	case "uuid":
+		digits := strings.ReplaceAll(strings.Trim(value, "{}"), "-", "")
+		_, err := hex.DecodeString(digits)
+		return len(digits) == 32 && err == nil
+	case "timestamp":
+		for _, layout := range timestampLayouts {
+			if _, err := time.Parse(layout, value); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+	return utf8.ValidString(value) && !strings.ContainsRune(value, 0)
+}
+
+func (ks Keyset) keys() []string {
+	keys := make([]string, 0, len(ks.Sorts))
+	for k := range ks.Sorts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SortValue is the select-list expression for the cursor value of a row;
+// scan it alongside each item and pass the values to Finish
+func (r Request) SortValue() string {
+	return "(" + r.column.Expr + ")::text"
+}
+
+// After returns the condition selecting rows past the cursor, using
+// placeholders from $next on, or "TRUE" on the first page
+func (r Request) After(next int) (string, []any) {
+	if r.after == nil {
+		return "TRUE", nil
+	}
+	op := ">"
+	if r.Desc {
+		op = "<"
+	}
+	cond := fmt.Sprintf("(%s, %s) %s ($%d::%s, $%d::%s)",
+		r.column.Expr, r.id.Expr, op, next, r.column.Type, next+1, r.id.Type)
+	return cond, []any{r.after.Value, r.after.ID}
+}
+
+// OrderBy returns the ORDER BY list matching After
+func (r Request) OrderBy() string {
+	dir := "ASC"
+	if r.Desc {
+		dir = "DESC"
+	}
+	return fmt.Sprintf("%s %s, %s %s", r.column.Expr, dir, r.id.Expr, dir)
+}
+
+// Unlimited returns the request without a page size, for the legacy routes
+// that listed everything before they were paginated
+func (r Request) Unlimited() Request {
+	r.Limit = 0
+	return r
+}
+
+// FetchLimit is the LIMIT to query with: one extra row reveals whether
+// another page follows
+func (r Request) FetchLimit() int {
+	return r.Limit + 1
+}
+
+// LimitClause is the LIMIT clause to query with, empty when r is
+// Unlimited
+func (r Request) LimitClause() string {
+	if r.Limit == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" LIMIT %d", r.FetchLimit())
+}
+
+// Meta describes a page to the client
+type Meta struct {
+	Total      int64  `json:"total"`
+	Limit      int    `json:"limit"`
+	Sort       string `json:"sort"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// Finish trims the extra row fetched with FetchLimit and builds the page
+// metadata. values holds the SortValue of each item; id returns its key.
+func Finish[T any](r Request, items []T, values []string, id func(T) string, total int64) ([]T, Meta) {
+	meta := Meta{Total: total, Limit: r.Limit, Sort: r.Sort}
+	if r.Limit > 0 && len(items) > r.Limit {
+		items = items[:r.Limit]
+		last := items[len(items)-1]
+		meta.NextCursor = cursor{Sort: r.Sort, Value: values[r.Limit-1], ID: id(last)}.encode()
+	}
+	return items, meta
+}
+
+// Slice pages items held in memory the same way the SQL queries do. value
+// returns an item's value for the sort key (without "-") and id its
+// tie-breaker; both must order correctly as strings, so pad numbers and use
+// fixed-width timestamps.
+func Slice[T any](r Request, items []T, value func(item T, key string) string, id func(T) string) ([]T, Meta) {
+	key := strings.TrimPrefix(r.Sort, "-")
+	less := func(v1, id1, v2, id2 string) bool {
+		if v1 != v2 {
+			return v1 < v2
+		}
+		return id1 < id2
+	}
+
+	sorted := make([]T, len(items))
+	copy(sorted, items)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		vi, vj := value(sorted[i], key), value(sorted[j], key)
+		if r.Desc {
+			return less(vj, id(sorted[j]), vi, id(sorted[i]))
+		}
+		return less(vi, id(sorted[i]), vj, id(sorted[j]))
+	})
+
+	var page []T
+	var values []string
+	for _, item := range sorted {
+		v := value(item, key)
+		if r.after != nil {
+			past := less(r.after.Value, r.after.ID, v, id(item))
+			if r.Desc {
+				past = less(v, id(item), r.after.Value, r.after.ID)
+			}
+			if !past {
+				continue
+			}
+		}
+		if r.Limit > 0 && len(page) == r.FetchLimit() {
+			break
+		}
+		page = append(page, item)
+		values = append(values, v)
+	}
+	return Finish(r, page, values, id, int64(len(items)))
+}
+
+func (c cursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c cursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
@@ -0,0 +1,160 @@
+package pagination
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var testKeyset = Keyset{
+	Sorts: map[string]Column{
+		"name":      {Expr: "name", Type: "text"},
+		"createdAt": {Expr: "created_at", Type: "timestamp"},
+		"price":     {Expr: "price", Type: "bigint"},
+	},
+	Default: "name",
+	ID:      Column{Expr: "id", Type: "uuid"},
+}
+
+const testID = "0b5e3a4c-7d1f-4e2a-9c3b-5f6d7e8f9a0b"
+
+func TestParseCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+		field  string
+	}{
+		{"text value", "name", cursor{Sort: "name", Value: "Cut", ID: testID}.encode(), ""},
+		{"Postgres timestamp", "createdAt", cursor{Sort: "createdAt", Value: "2026-10-19 09:30:00.123456", ID: testID}.encode(), ""},
+		{"in-memory timestamp", "-createdAt", cursor{Sort: "-createdAt", Value: "2026-10-19T09:30:00.000000000", ID: strings.ReplaceAll(testID, "-", "")}.encode(), ""},
+		{"number", "price", cursor{Sort: "price", Value: "2500", ID: testID}.encode(), ""},
+		{"not base64", "name", "%%%", "cursor"},
+		{"other sort", "price", cursor{Sort: "name", Value: "Cut", ID: testID}.encode(), "cursor"},
+		{"tampered number", "price", cursor{Sort: "price", Value: "1 OR 1=1", ID: testID}.encode(), "cursor"},
+		{"tampered timestamp", "createdAt", cursor{Sort: "createdAt", Value: "yesterday", ID: testID}.encode(), "cursor"},
+		{"tampered id", "name", cursor{Sort: "name", Value: "Cut", ID: "42"}.encode(), "cursor"},
+		{"NUL in text", "name", cursor{Sort: "name", Value: "Cut\x00", ID: testID}.encode(), "cursor"},
+		{"unknown sort", "colour", "", "sort"},
+	}
+	for _, tt := range tests {
+		_, err := testKeyset.Parse("", tt.sort, tt.cursor)
+		var fieldErr *FieldError
+		switch {
+		case tt.field == "" && err != nil:
+			t.Errorf("%s: Parse() = %v, want nil", tt.name, err)
+		case tt.field != "" && (!errors.As(err, &fieldErr) || fieldErr.Field != tt.field):
+			t.Errorf("%s: Parse() = %v, want a %s error", tt.name, err, tt.field)
+		}
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	for _, limit := range []string{"0", "-1", "201", "ten"} {
+		if _, err := testKeyset.Parse(limit, "", ""); err == nil {
+			t.Errorf("Parse(limit %q) = nil, want an error", limit)
+		}
+	}
+	r, err := testKeyset.Parse("", "", "")
+	if err != nil || r.Limit != DefaultLimit || r.Sort != "name" || r.Desc {
+		t.Errorf("Parse() = %+v, %v, want the default page", r, err)
+	}
+}
+
+type item struct {
+	id    string
+	name  string
+	price int64
+}
+
+func items() []item {
+	return []item{
+		{"01", "Cut", 2000},
+		{"02", "Colour", 6000},
+		{"03", "Blow dry", 2000},
+		{"04", "Beard", 1500},
+		{"05", "Cut", 2500},
+	}
+}
+
+func itemValue(it item, key string) string {
+	if key == "price" {
+		return fmt.Sprintf("%020d", it.price)
+	}
+	return it.name
+}
+
+func itemID(it item) string { return it.id }
+
+// itemKeyset sorts items, which have numeric ids
+var itemKeyset = Keyset{Sorts: testKeyset.Sorts, Default: "name", ID: Column{Expr: "id", Type: "bigint"}}
+
+func TestSlicePages(t *testing.T) {
+	tests := []struct {
+		sort  string
+		limit string
+		want  []string // ids, one page per entry
+	}{
+		{"name", "2", []string{"04 03", "02 01", "05"}},
+		{"-name", "2", []string{"05 01", "02 03", "04"}},
+		{"price", "3", []string{"04 01 03", "05 02"}},
+		{"-price", "5", []string{"02 05 03 01 04"}},
+		{"name", "10", []string{"04 03 02 01 05"}},
+	}
+	for _, tt := range tests {
+		var pages []string
+		after := ""
+		for {
+			r, err := itemKeyset.Parse(tt.limit, tt.sort, after)
+			if err != nil {
+				t.Fatalf("%s: Parse(cursor %q) = %v", tt.sort, after, err)
+			}
+			page, meta := Slice(r, items(), itemValue, itemID)
+			if meta.Total != 5 || meta.Sort != tt.sort {
+				t.Errorf("%s: meta = %+v, want total 5", tt.sort, meta)
+			}
+			ids := make([]string, len(page))
+			for i, it := range page {
+				ids[i] = it.id
+			}
+			pages = append(pages, strings.Join(ids, " "))
+			if meta.NextCursor == "" || len(pages) > len(tt.want) {
+				break
+			}
+			after = meta.NextCursor
+		}
+		if strings.Join(pages, " | ") != strings.Join(tt.want, " | ") {
+			t.Errorf("%s by %s: pages %q, want %q", tt.sort, tt.limit, pages, tt.want)
+		}
+	}
+}
+
+func TestFinish(t *testing.T) {
+	r, _ := itemKeyset.Parse("2", "price", "")
+	fetched := items()[:3]
+	values := []string{"2000", "6000", "2000"}
+
+	page, meta := Finish(r, fetched, values, itemID, 5)
+	if len(page) != 2 || meta.Limit != 2 || meta.Total != 5 {
+		t.Fatalf("Finish() = %v, %+v, want 2 of 5 items", page, meta)
+	}
+	c, err := decodeCursor(meta.NextCursor)
+	if err != nil || *c != (cursor{Sort: "price", Value: "6000", ID: "02"}) {
+		t.Errorf("next cursor = %+v, %v, want the last item kept", c, err)
+	}
+
+	// A short fetch is the last page
+	if _, meta := Finish(r, fetched[:2], values[:2], itemID, 2); meta.NextCursor != "" {
+		t.Errorf("last page has next cursor %q", meta.NextCursor)
+	}
+
+	// Unlimited requests keep every item fetched
+	page, meta = Finish(r.Unlimited(), fetched, values, itemID, 3)
+	if len(page) != 3 || meta.NextCursor != "" || r.Unlimited().LimitClause() != "" {
+		t.Errorf("unlimited Finish() = %v, %+v", page, meta)
+	}
+	if r.LimitClause() != " LIMIT 3" {
+		t.Errorf("LimitClause() = %q, want one row over the page", r.LimitClause())
+	}
+}
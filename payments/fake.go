@@ -0,0 +1,114 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Fake is an in-memory gateway for local development and tests. Webhooks use
+// the same "t=<unix>,v1=<hmac>" signature scheme as Stripe in the
+// Fake-Signature header.
+type Fake struct {
+	webhookSecret string
+
+	mu        sync.Mutex
+	seq       int
+	checkouts map[string]CheckoutRequest
+	refunds   []FakeRefund
+	// refundKeys maps idempotency keys to the refunds they issued
+	refundKeys map[string]*Refund
+}
+
+type FakeRefund struct {
+	PaymentID string
+	Amount    int64
+}
+
+func NewFake(webhookSecret string) *Fake {
+	if webhookSecret == "" {
+		webhookSecret = "fake-webhook-secret"
+	}
+	return &Fake{webhookSecret: webhookSecret, checkouts: make(map[string]CheckoutRequest), refundKeys: make(map[string]*Refund)}
+}
+
+func (f *Fake) Name() string { return "fake" }
+
+func (f *Fake) CreateCheckout(ctx context.Context, req CheckoutRequest) (*Checkout, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.seq++
+	id := fmt.Sprintf("fake_cs_%d", f.seq)
+	f.checkouts[id] = req
+	return &Checkout{ID: id, URL: "https://payments.invalid/checkout/" + id}, nil
+}
+
+func (f *Fake) Refund(ctx context.Context, paymentID string, amount int64, idempotencyKey string) (*Refund, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if refund, ok := f.refundKeys[idempotencyKey]; ok && idempotencyKey != "" {
+		return refund, nil
+	}
+	f.refunds = append(f.refunds, FakeRefund{PaymentID: paymentID, Amount: amount})
+	refund := &Refund{ID: fmt.Sprintf("fake_re_%d", len(f.refunds)), Amount: amount}
+	if idempotencyKey != "" {
+		f.refundKeys[idempotencyKey] = refund
+	}
+	return refund, nil
+}
+
+type fakeEvent struct {
+	Type          EventType `json:"type"`
+	CheckoutID    string    `json:"checkoutId"`
+	PaymentID     string    `json:"paymentId"`
+	AppointmentID string    `json:"appointmentId"`
+}
+
+func (f *Fake) ParseWebhook(payload []byte, header http.Header) (*Event, error) {
+	if err := verifyStripeSignature(payload, header.Get("Fake-Signature"), f.webhookSecret, time.Now()); err != nil {
+		return nil, err
+	}
+
+	var evt fakeEvent
+	if err := json.Unmarshal(payload, &evt); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+	return &Event{
+		Type:          evt.Type,
+		CheckoutID:    evt.CheckoutID,
+		PaymentID:     evt.PaymentID,
+		AppointmentID: evt.AppointmentID,
+	}, nil
+}
+
+// Webhook builds a signed webhook body and headers for the given checkout,
+// as the provider would send it once the client pays (or abandons) checkout.
+func (f *Fake) Webhook(eventType EventType, checkoutID string) ([]byte, http.Header) {
+	f.mu.Lock()
+	req := f.checkouts[checkoutID]
+	f.mu.Unlock()
+
+	payload, _ := json.Marshal(fakeEvent{
+		Type:          eventType,
+		CheckoutID:    checkoutID,
+		PaymentID:     "fake_pi_" + checkoutID,
+		AppointmentID: req.AppointmentID,
+	})
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	header := http.Header{}
+	header.Set("Fake-Signature", "t="+timestamp+",v1="+signPayload(f.webhookSecret, timestamp, payload))
+	return payload, header
+}
+
+// Refunds returns the refunds issued so far
+func (f *Fake) Refunds() []FakeRefund {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeRefund(nil), f.refunds...)
+}
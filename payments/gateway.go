@@ -0,0 +1,79 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"example.com/config"
+	"example.com/logging"
+)
+
+// Gateway is a payment provider able to take a deposit through a hosted
+// checkout page, report the outcome through signed webhooks and refund.
+type Gateway interface {
+	Name() string
+	CreateCheckout(ctx context.Context, req CheckoutRequest) (*Checkout, error)
+	ParseWebhook(payload []byte, header http.Header) (*Event, error)
+	// Refund returns the deposit. Calls with the same idempotencyKey refund
+	// once, so a refund can be retried after an error.
+	Refund(ctx context.Context, paymentID string, amount int64, idempotencyKey string) (*Refund, error)
+}
+
+type CheckoutRequest struct {
+	AppointmentID string
+	Amount        int64  // minor units
+	Currency      string // ISO 4217
+	Description   string
+	CustomerEmail string
+	SuccessURL    string
+	CancelURL     string
+	ExpiresAt     time.Time
+}
+
+type Checkout struct {
+	ID  string
+	URL string
+}
+
+type EventType string
+
+const (
+	EventPaymentSucceeded EventType = "payment_succeeded"
+	EventPaymentFailed    EventType = "payment_failed"
+	EventCheckoutExpired  EventType = "checkout_expired"
+	// EventIgnored is returned for verified events we don't act on
+	EventIgnored EventType = "ignored"
+)
+
+type Event struct {
+	Type          EventType
+	CheckoutID    string
+	PaymentID     string
+	AppointmentID string
+}
+
+type Refund struct {
+	ID     string
+	Amount int64
+}
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Default is the configured gateway, or nil when online payments are disabled
+var Default Gateway
+
+func Init(cfg config.PaymentsConfig) {
+	switch cfg.Gateway {
+	case "stripe":
+		Default = NewStripe(cfg.StripeSecretKey, cfg.StripeWebhookSecret)
+	case "fake":
+		Default = NewFake(cfg.FakeWebhookSecret)
+	case "":
+		Default = nil
+	default:
+		logging.Logger.Warnf("Unknown PAYMENT_GATEWAY %q, online payments disabled", cfg.Gateway)
+		Default = nil
+	}
+}
@@ -0,0 +1,43 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"example.com/logging"
+	"example.com/models"
+)
+
+// RefundDue returns the deposit of a refund_due payment through the gateway
+// it was taken with and records the refund. The idempotency key is derived
+// from the payment, so retrying after an error never refunds twice.
+func RefundDue(ctx context.Context, repo models.PaymentRepository, p *models.Payment) error {
+	if Default == nil || Default.Name() != p.Gateway {
+		return fmt.Errorf("payment gateway %q is not configured", p.Gateway)
+	}
+	refund, err := Default.Refund(ctx, p.PaymentID, p.Amount.Amount, "refund-"+strconv.FormatInt(p.ID, 10))
+	if err != nil {
+		return err
+	}
+	return repo.MarkRefunded(ctx, p.ID, refund.ID)
+}
+
+// RetryRefunds refunds the payments left refund_due after an earlier attempt
+// failed. It returns the number refunded.
+func RetryRefunds(ctx context.Context, repo models.PaymentRepository) (int, error) {
+	due, err := repo.ListRefundDue(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	refunded := 0
+	for i := range due {
+		if err := RefundDue(ctx, repo, &due[i]); err != nil {
+			logging.FromContext(ctx).WithError(err).WithField("paymentId", due[i].ID).Error("failed to refund deposit")
+			continue
+		}
+		refunded++
+	}
+	return refunded, nil
+}
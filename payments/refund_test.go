@@ -0,0 +1,67 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"example.com/models"
+)
+
+// failingRefunds is a gateway whose refunds fail until fail is cleared
+type failingRefunds struct {
+	*Fake
+	fail bool
+}
+
+func (f *failingRefunds) Refund(ctx context.Context, paymentID string, amount int64, idempotencyKey string) (*Refund, error) {
+	if f.fail {
+		return nil, errors.New("gateway unavailable")
+	}
+	return f.Fake.Refund(ctx, paymentID, amount, idempotencyKey)
+}
+
+func TestLatePaymentIsRefundedOnce(t *testing.T) {
+	gateway := &failingRefunds{Fake: NewFake(""), fail: true}
+	saved := Default
+	t.Cleanup(func() { Default = saved })
+	Default = gateway
+
+	ctx := context.Background()
+	repo := models.NewMemoryRepositories().Payments
+	payment := &models.Payment{AppointmentID: "expired", UserID: 1, Gateway: "fake", CheckoutID: "fake_cs_1",
+		Amount: models.Money{Amount: 1500, Currency: "EUR"}}
+	if err := repo.Create(ctx, payment); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// The appointment is no longer held, so the money has to go back
+	confirmed, outcome, err := repo.Confirm(ctx, "fake_cs_1", "pi_1")
+	if err != nil || outcome != models.PaymentLate || confirmed.Status != models.PaymentRefundDue {
+		t.Fatalf("Confirm = %+v, %v, %v, want a late payment left refund_due", confirmed, outcome, err)
+	}
+	if err := RefundDue(ctx, repo, confirmed); err == nil {
+		t.Fatal("RefundDue succeeded with the gateway down")
+	}
+
+	// A redelivered webhook still sees the refund as due
+	redelivered, outcome, err := repo.Confirm(ctx, "fake_cs_1", "pi_1")
+	if err != nil || outcome != models.PaymentDuplicate || redelivered.Status != models.PaymentRefundDue {
+		t.Fatalf("Confirm again = %+v, %v, %v, want a duplicate still refund_due", redelivered, outcome, err)
+	}
+
+	gateway.fail = false
+	for i, want := range []int{1, 0} {
+		refunded, err := RetryRefunds(ctx, repo)
+		if err != nil || refunded != want {
+			t.Errorf("RetryRefunds #%d = %d, %v, want %d", i+1, refunded, err, want)
+		}
+	}
+	// Refunding with the same idempotency key again returns the same refund
+	if err := RefundDue(ctx, repo, confirmed); err != nil {
+		t.Fatalf("RefundDue again: %v", err)
+	}
+	if refunds := gateway.Refunds(); len(refunds) != 1 || refunds[0].Amount != 1500 {
+		t.Errorf("refunds = %+v, want one of 1500", refunds)
+	}
+}
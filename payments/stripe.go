@@ -0,0 +1,220 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/tracing"
+)
+
+const (
+	stripeAPIURL = "https://api.stripe.com/v1"
+	// Stripe rejects checkout sessions expiring sooner than 30 minutes
+	stripeMinCheckoutTTL = 30 * time.Minute
+	// Webhooks signed longer ago than this are rejected to prevent replays
+	stripeSignatureTolerance = 5 * time.Minute
+)
+
+type Stripe struct {
+	secretKey     string
+	webhookSecret string
+	baseURL       string
+	client        *http.Client
+}
+
+func NewStripe(secretKey, webhookSecret string) *Stripe {
+	return &Stripe{
+		secretKey:     secretKey,
+		webhookSecret: webhookSecret,
+		baseURL:       stripeAPIURL,
+		client:        tracing.HTTPClient,
+	}
+}
+
+func (s *Stripe) Name() string { return "stripe" }
+
+func (s *Stripe) CreateCheckout(ctx context.Context, req CheckoutRequest) (*Checkout, error) {
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("success_url", req.SuccessURL)
+	form.Set("cancel_url", req.CancelURL)
+	form.Set("client_reference_id", req.AppointmentID)
+	form.Set("metadata[appointment_id]", req.AppointmentID)
+	form.Set("payment_intent_data[metadata][appointment_id]", req.AppointmentID)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", strings.ToLower(req.Currency))
+	form.Set("line_items[0][price_data][unit_amount]", strconv.FormatInt(req.Amount, 10))
+	form.Set("line_items[0][price_data][product_data][name]", req.Description)
+	if req.CustomerEmail != "" {
+		form.Set("customer_email", req.CustomerEmail)
+	}
+	if !req.ExpiresAt.IsZero() {
+		expiresAt := req.ExpiresAt
+		if min := time.Now().Add(stripeMinCheckoutTTL); expiresAt.Before(min) {
+			expiresAt = min
+		}
+		form.Set("expires_at", strconv.FormatInt(expiresAt.Unix(), 10))
+	}
+
+	var session struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	if err := s.post(ctx, "/checkout/sessions", form, "", &session); err != nil {
+		return nil, err
+	}
+	return &Checkout{ID: session.ID, URL: session.URL}, nil
+}
+
+func (s *Stripe) Refund(ctx context.Context, paymentID string, amount int64, idempotencyKey string) (*Refund, error) {
+	form := url.Values{}
+	form.Set("payment_intent", paymentID)
+	if amount > 0 {
+		form.Set("amount", strconv.FormatInt(amount, 10))
+	}
+
+	var refund struct {
+		ID     string `json:"id"`
+		Amount int64  `json:"amount"`
+	}
+	if err := s.post(ctx, "/refunds", form, idempotencyKey, &refund); err != nil {
+		return nil, err
+	}
+	return &Refund{ID: refund.ID, Amount: refund.Amount}, nil
+}
+
+// ParseWebhook verifies the Stripe-Signature header (t=<unix>,v1=<hex hmac>)
+// and maps checkout session events onto gateway events.
+func (s *Stripe) ParseWebhook(payload []byte, header http.Header) (*Event, error) {
+	if err := verifyStripeSignature(payload, header.Get("Stripe-Signature"), s.webhookSecret, time.Now()); err != nil {
+		return nil, err
+	}
+
+	var evt struct {
+		Type string `json:"type"`
+		Data struct {
+			Object struct {
+				ID                string            `json:"id"`
+				PaymentIntent     string            `json:"payment_intent"`
+				PaymentStatus     string            `json:"payment_status"`
+				ClientReferenceID string            `json:"client_reference_id"`
+				Metadata          map[string]string `json:"metadata"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &evt); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+
+	obj := evt.Data.Object
+	out := &Event{
+		Type:          EventIgnored,
+		CheckoutID:    obj.ID,
+		PaymentID:     obj.PaymentIntent,
+		AppointmentID: obj.Metadata["appointment_id"],
+	}
+	if out.AppointmentID == "" {
+		out.AppointmentID = obj.ClientReferenceID
+	}
+
+	switch evt.Type {
+	case "checkout.session.completed", "checkout.session.async_payment_succeeded":
+		if obj.PaymentStatus == "paid" {
+			out.Type = EventPaymentSucceeded
+		}
+	case "checkout.session.async_payment_failed":
+		out.Type = EventPaymentFailed
+	case "checkout.session.expired":
+		out.Type = EventCheckoutExpired
+	}
+	return out, nil
+}
+
+func verifyStripeSignature(payload []byte, header, secret string, now time.Time) error {
+	if secret == "" || header == "" {
+		return ErrInvalidSignature
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > stripeSignatureTolerance || age < -stripeSignatureTolerance {
+		return ErrInvalidSignature
+	}
+
+	expected := signPayload(secret, timestamp, payload)
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// signPayload computes the hex HMAC-SHA256 of "<timestamp>.<payload>"
+func signPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Stripe) post(ctx context.Context, path string, form url.Values, idempotencyKey string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(s.secretKey, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("stripe request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(body, &apiErr)
+		return fmt.Errorf("stripe %s failed with status %d: %s", path, resp.StatusCode, apiErr.Error.Message)
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"context"
+
+	"example.com/db"
+)
+
+// PostgresStore keeps buckets in the rate_limit_buckets table, so every
+// instance sharing the database shares the limits
+type PostgresStore struct {
+	conn db.DBTX
+}
+
+func NewPostgresStore(conn db.DBTX) *PostgresStore {
+	return &PostgresStore{conn: conn}
+}
+
+// refilled is the bucket's tokens after refilling since its last use. In
+// the SET list of an upsert, b holds the row as it was before the update.
+const refilled = `LEAST($2::float8, b.tokens + GREATEST(0, EXTRACT(EPOCH FROM now() - b.updated_at)::float8) * $3::float8)`
+
+// Take refills and takes from the bucket in one statement, so concurrent
+// requests on different instances can't both spend the same token
+func (s *PostgresStore) Take(ctx context.Context, key string, p Policy) (Result, error) {
+	query := `
+	INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+	VALUES ($1, $2::float8 - 1, true, now())
+	ON CONFLICT (key) DO UPDATE SET
+		allowed = ` + refilled + ` >= 1,
+		tokens = CASE WHEN ` + refilled + ` >= 1 THEN ` + refilled + ` - 1 ELSE ` + refilled + ` END,
+		updated_at = now()
+	RETURNING tokens, allowed`
+	var tokens float64
+	var allowed bool
+	err := s.conn.QueryRowContext(ctx, query, key, p.Limit, p.rate()).Scan(&tokens, &allowed)
+	if err != nil {
+		return Result{}, err
+	}
+	return result(p, tokens, allowed), nil
+}
+
+// DeleteIdle removes buckets that haven't been used for a day; they would
+// have refilled long ago
+func (s *PostgresStore) DeleteIdle(ctx context.Context) (int64, error) {
+	res, err := s.conn.ExecContext(ctx, `DELETE FROM rate_limit_buckets WHERE updated_at < now() - interval '1 day'`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
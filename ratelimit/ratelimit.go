@@ -0,0 +1,132 @@
+// Package ratelimit throttles requests with token buckets. A Limiter holds
+// named policies; Limit returns a middleware applying one of them to buckets
+// keyed by client IP, user or route parameter. Buckets live in a Store,
+// in memory for a single instance or in Postgres when several share limits.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"example.com/logging"
+	"example.com/middlewares"
+	"example.com/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Policy lets Limit requests through per Period, in bursts of up to Limit.
+// The bucket refills continuously at Limit/Period.
+type Policy struct {
+	Limit  int
+	Period time.Duration
+}
+
+func (p Policy) rate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// Result is the state of a bucket after a request took from it
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until a denied request would be allowed
+	RetryAfter time.Duration
+}
+
+// result describes a bucket left holding tokens under p
+func result(p Policy, tokens float64, allowed bool) Result {
+	r := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     time.Duration((float64(p.Limit) - tokens) / p.rate() * float64(time.Second)),
+	}
+	if !allowed {
+		r.RetryAfter = time.Duration((1 - tokens) / p.rate() * float64(time.Second))
+	}
+	return r
+}
+
+// Store keeps token buckets
+type Store interface {
+	// Take refills the bucket for key under p and takes one token if there is
+	// one
+	Take(ctx context.Context, key string, p Policy) (Result, error)
+}
+
+// KeyFunc picks the bucket a request counts against
+type KeyFunc func(c *gin.Context) string
+
+// ByIP keys requests by client address
+func ByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// ByUser keys authenticated requests by user, and others by client address
+func ByUser(c *gin.Context) string {
+	if userID := c.GetInt64("userId"); userID != 0 {
+		return "user:" + strconv.FormatInt(userID, 10)
+	}
+	return ByIP(c)
+}
+
+// ByParam keys requests by a route parameter, such as the provider alias
+func ByParam(name string) KeyFunc {
+	return func(c *gin.Context) string {
+		return name + ":" + c.Param(name)
+	}
+}
+
+var ErrRateLimited = models.TooManyRequests("rate_limited", "too many requests, try again later")
+
+// Limiter applies named policies. A nil Limiter lets every request through.
+type Limiter struct {
+	store    Store
+	policies map[string]Policy
+}
+
+func New(store Store, policies map[string]Policy) *Limiter {
+	return &Limiter{store: store, policies: policies}
+}
+
+// Limit returns a middleware holding requests to the named policy, with
+// buckets chosen by key. Responses carry RateLimit-Limit, -Remaining, -Reset
+// and -Policy headers; denied requests get 429 with Retry-After. When the
+// store fails, requests are let through rather than refused.
+func (l *Limiter) Limit(name string, key KeyFunc) gin.HandlerFunc {
+	var p Policy
+	ok := false
+	if l != nil {
+		p, ok = l.policies[name]
+	}
+	if !ok || p.Limit <= 0 || p.Period <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		r, err := l.store.Take(c.Request.Context(), name+"|"+key(c), p)
+		if err != nil {
+			logging.FromContext(c.Request.Context()).WithError(err).WithField("policy", name).Warn("rate limit check failed")
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(p.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(r.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(r.Reset)))
+		c.Header("RateLimit-Policy", strconv.Itoa(p.Limit)+";w="+strconv.Itoa(ceilSeconds(p.Period)))
+		if !r.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(r.RetryAfter)))
+			middlewares.WriteProblem(c, ErrRateLimited)
+			return
+		}
+		c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
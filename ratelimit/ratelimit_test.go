@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMemoryStoreRefills(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	policy := Policy{Limit: 2, Period: time.Minute}
+
+	for i, want := range []bool{true, true, false} {
+		r, err := store.Take(context.Background(), "k", policy)
+		if err != nil || r.Allowed != want {
+			t.Fatalf("take %d = %+v, %v, want allowed %v", i, r, err, want)
+		}
+	}
+
+	r, _ := store.Take(context.Background(), "k", policy)
+	if r.RetryAfter != 30*time.Second {
+		t.Errorf("RetryAfter = %v, want 30s for one token at 2/min", r.RetryAfter)
+	}
+
+	now = now.Add(30 * time.Second)
+	if r, _ := store.Take(context.Background(), "k", policy); !r.Allowed || r.Remaining != 0 {
+		t.Errorf("after 30s = %+v, want one token refilled and spent", r)
+	}
+	if r, _ := store.Take(context.Background(), "other", policy); !r.Allowed || r.Remaining != 1 {
+		t.Errorf("other key = %+v, want its own full bucket", r)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, Policy) (Result, error) {
+	return Result{}, errors.New("database is down")
+}
+
+func serve(limit gin.HandlerFunc, n int) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	server.GET("/schedule/:alias", limit, func(c *gin.Context) { c.Status(http.StatusOK) })
+	var w *httptest.ResponseRecorder
+	for range n {
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/schedule/ada", nil))
+	}
+	return w
+}
+
+func TestLimitRejectsWithHeaders(t *testing.T) {
+	limiter := New(NewMemoryStore(), map[string]Policy{"public": {Limit: 2, Period: time.Minute}})
+
+	w := serve(limiter.Limit("public", ByIP), 2)
+	if w.Code != http.StatusOK || w.Header().Get("RateLimit-Remaining") != "0" || w.Header().Get("RateLimit-Policy") != "2;w=60" {
+		t.Errorf("second request = %d %v, want 200 with headers", w.Code, w.Header())
+	}
+
+	w = serve(limiter.Limit("public", ByParam("alias")), 3)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "30" {
+		t.Errorf("third request = %d %v, want 429 with Retry-After", w.Code, w.Header())
+	}
+}
+
+func TestLimitPassesThrough(t *testing.T) {
+	var off *Limiter
+	if w := serve(off.Limit("public", ByIP), 5); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("nil limiter = %d %v, want 200 without headers", w.Code, w.Header())
+	}
+
+	failing := New(failingStore{}, map[string]Policy{"public": {Limit: 1, Period: time.Minute}})
+	if w := serve(failing.Limit("public", ByIP), 5); w.Code != http.StatusOK {
+		t.Errorf("failing store = %d, want requests let through", w.Code)
+	}
+}
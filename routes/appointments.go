@@ -1,59 +1,200 @@
 package routes
 
 import (
+	"context"
+	"errors"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
 
+	"example.com/captcha"
+	"example.com/logging"
+	"example.com/metrics"
 	"example.com/models"
+	"example.com/payments"
 	"github.com/gin-gonic/gin"
 )
 
-func createAppointment(c *gin.Context) {
+// bookingRequest is a public booking along with the signals showing a
+// person, not a bot, filled in the form
+type bookingRequest struct {
+	models.Appointment
+	captcha.Form
+}
+
+func (h *Handlers) createAppointment(c *gin.Context) {
 	alias := c.Param("alias")
 
-	user, err := models.GetUserByAlias(alias)
+	user, err := h.repos.Users.GetByAlias(c.Request.Context(), alias)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"message": "user not found"})
+		c.Error(err)
 		return
 	}
 
-	var appt models.Appointment
-	if err := c.ShouldBindJSON(&appt); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid request body: " + err.Error()})
+	var req bookingRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if err := h.checkBookingForm(c, user.ID, req.Form); err != nil {
+		c.Error(err)
 		return
 	}
+	appt := req.Appointment
 
-	// Validate service belongs to this user
-	service, err := models.GetServiceById(appt.ServiceID, user.ID)
-	if err != nil || service == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "service not found for this user"})
+	payment, ok := h.bookAppointment(c, alias, user.ID, &appt, nil)
+	if !ok {
 		return
 	}
+	result := bookingResult{Appointment: &appt, Payment: payment}
+	if payment == nil {
+		respond(c, http.StatusCreated, result, gin.H{
+			"message":     "appointment created",
+			"appointment": appt,
+		})
+		return
+	}
+
+	respond(c, http.StatusCreated, result, gin.H{
+		"message":     "appointment awaiting payment",
+		"appointment": appt,
+		"payment":     payment,
+	})
+}
+
+// bookAppointment prices the appointment, takes its slot and, when the
+// provider requires a deposit, opens the checkout. A non-nil booked runs in
+// the booking's transaction once the appointment is saved, and fails it when
+// it fails. It returns the pending payment (nil if none is due), or records
+// the error and returns false.
+func (h *Handlers) bookAppointment(c *gin.Context, alias string, userID int64, appt *models.Appointment, booked func(tx models.Repositories) error) (*models.Payment, bool) {
+	if err := appt.Validate(); err != nil {
+		c.Error(err)
+		return nil, false
+	}
 
-	appt.UserID = user.ID
+	appt.UserID = userID
+	appt.Status = models.StatusConfirmed
+	appt.HoldExpiresAt = nil
+
+	// Check the client, price the services and take the slot in one
+	// transaction, so the booking is saved with the prices and rules it was
+	// checked against
+	var deposit models.Money
+	requiresPayment := false
+	err := h.repos.InTx(c.Request.Context(), func(tx models.Repositories) error {
+		// Apply the provider's blocklist and rules for problem clients
+		check, err := tx.Restrictions.Check(c.Request.Context(), userID, appt.Email, appt.Phone, c.ClientIP())
+		if err != nil {
+			return err
+		}
+
+		// Providers requiring a deposit get the slot held until the client pays
+		settings, err := tx.Payments.GetSettings(c.Request.Context(), userID)
+		if err != nil {
+			return err
+		}
 
-	err = models.CreateAppointment(c.Request.Context(), &appt)
+		if err := applyAppointmentServices(c.Request.Context(), tx.Services, userID, appt); err != nil {
+			return err
+		}
+
+		deposit = settings.DepositFor(appt.Price)
+		if check.RequirePrepayment {
+			if payments.Default == nil {
+				return models.ErrBookingRestricted
+			}
+			deposit = appt.Price
+		}
+		requiresPayment = payments.Default != nil && deposit.Amount > 0
+		if requiresPayment {
+			holdExpiresAt := time.Now().UTC().Add(time.Duration(settings.HoldMinutes) * time.Minute)
+			appt.Status = models.StatusPendingPayment
+			appt.HoldExpiresAt = &holdExpiresAt
+		}
+
+		if err := tx.Appointments.Create(c.Request.Context(), appt); err != nil {
+			return err
+		}
+		if booked != nil {
+			return booked(tx)
+		}
+		return nil
+	})
 	if err != nil {
-		if strings.Contains(err.Error(), "no available timeslot") {
-			c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
-			return
+		var domainErr *models.Error
+		if errors.As(err, &domainErr) && domainErr.Kind == models.KindConflict {
+			metrics.BookingConflicts.Inc()
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "failed to create appointment: " + err.Error()})
-		return
+		c.Error(err)
+		return nil, false
 	}
+	metrics.AppointmentsCreated.Inc()
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message":     "appointment created",
-		"appointment": appt,
-	})
+	if !requiresPayment {
+		return nil, true
+	}
+
+	payment, err := h.startCheckout(c, alias, appt, deposit)
+	if err != nil {
+		// Give the slot back rather than leaving an unpayable hold. It was never
+		// really taken, so the waitlist isn't told it freed up
+		if delErr := h.repos.Appointments.Release(c.Request.Context(), appt.ID, userID); delErr != nil {
+			logging.FromContext(c.Request.Context()).WithError(delErr).WithField("appointmentId", appt.ID).
+				Error("failed to release appointment after checkout error")
+		}
+		c.Error(errPaymentGateway.Wrap(err))
+		return nil, false
+	}
+	return payment, true
+}
+
+// applyAppointmentServices loads the requested services of the provider and
+// computes the appointment's items, end time and price
+func applyAppointmentServices(ctx context.Context, repo models.ServiceRepository, userID int64, appt *models.Appointment) error {
+	// Validate every requested service belongs to this user
+	services := make(map[int64]*models.Service)
+	for _, serviceID := range appt.ServiceIDs() {
+		service, err := repo.GetByID(ctx, serviceID, userID)
+		if errors.Is(err, models.ErrServiceNotFound) {
+			return models.Invalid("invalid_selection", "service not found for this user")
+		}
+		if err != nil {
+			return err
+		}
+		services[serviceID] = service
+	}
+
+	return appt.ApplyServices(services)
 }
 
-func getAppointments(c *gin.Context) {
+func (h *Handlers) getAppointments(c *gin.Context) {
 	userID := c.GetInt64("userId")
 
-	appointments, err := models.GetAppointments(c.Request.Context(), userID)
+	filter := models.AppointmentFilter{
+		From:   c.Query("from"),
+		To:     c.Query("to"),
+		Status: c.Query("status"),
+	}
+	if raw := c.Query("clientId"); raw != "" {
+		clientID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			c.Error(&models.ValidationError{Field: "clientId", Message: "must be a numeric id"})
+			return
+		}
+		filter.ClientID = &clientID
+	}
+	if err := filter.Validate(); err != nil {
+		c.Error(err)
+		return
+	}
+	page, ok := pageRequest(c, models.AppointmentKeyset)
+	if !ok {
+		return
+	}
+
+	appointments, meta, err := h.repos.Appointments.List(c.Request.Context(), userID, filter, page)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "failed to get appointments: " + err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -61,22 +202,48 @@ func getAppointments(c *gin.Context) {
 		appointments = []models.Appointment{}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"appointments": appointments})
+	respondPage(c, appointments, meta, gin.H{"appointments": appointments})
 }
 
-func deleteAppointment(c *gin.Context) {
+func (h *Handlers) deleteAppointment(c *gin.Context) {
+	ctx := c.Request.Context()
 	userID := c.GetInt64("userId")
 	appointmentID := c.Param("id")
 
-	err := models.DeleteAppointment(c.Request.Context(), appointmentID, userID)
-	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
-			return
+	// Cancellations by the provider always refund the deposit, recorded as
+	// due along with the deletion
+	var due *models.Payment
+	err := h.repos.InTx(ctx, func(tx models.Repositories) error {
+		var err error
+		if due, err = tx.Payments.MarkRefundDue(ctx, appointmentID, userID); err != nil {
+			return err
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "failed to delete appointment: " + err.Error()})
+		return tx.Appointments.Delete(ctx, appointmentID, userID)
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	metrics.AppointmentsCancelled.WithLabelValues("provider").Inc()
+	h.offerFreedSlots(c)
+	h.refundDeposit(c, due)
+
+	respond(c, http.StatusOK, nil, gin.H{"message": "appointment deleted"})
+}
+
+func (h *Handlers) markNoShow(c *gin.Context) {
+	var body struct {
+		NoShow bool `json:"noShow"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	err := h.repos.Appointments.SetNoShow(c.Request.Context(), c.Param("id"), c.GetInt64("userId"), body.NoShow)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "appointment deleted"})
+	respond(c, http.StatusOK, nil, gin.H{"message": "appointment updated", "noShow": body.NoShow})
 }
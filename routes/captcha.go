@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"net/http"
+
+	"example.com/captcha"
+	"github.com/gin-gonic/gin"
+)
+
+// captchaSettings tells the booking page which CAPTCHA widget to render, if
+// any
+type captchaSettings struct {
+	Required bool   `json:"required"`
+	Provider string `json:"provider,omitempty"`
+	SiteKey  string `json:"siteKey,omitempty"`
+}
+
+func (h *Handlers) getCaptchaSettings(c *gin.Context) {
+	user, err := h.repos.Users.GetByAlias(c.Request.Context(), c.Param("alias"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	required, err := h.captchaRequired(c, user.ID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	settings := captchaSettings{Required: required}
+	if required {
+		settings.Provider = captcha.Default.Name()
+		settings.SiteKey = captcha.Default.SiteKey()
+	}
+	respond(c, http.StatusOK, settings, gin.H{"captcha": settings})
+}
+
+// captchaRequired reports whether public bookings with the provider need a
+// CAPTCHA: one is configured and the provider hasn't turned it off
+func (h *Handlers) captchaRequired(c *gin.Context, userID int64) (bool, error) {
+	if captcha.Default == nil {
+		return false, nil
+	}
+	rules, err := h.repos.Restrictions.GetRules(c.Request.Context(), userID)
+	if err != nil {
+		return false, err
+	}
+	return !rules.DisableCaptcha, nil
+}
+
+// checkBookingForm refuses public bookings that look automated or lack a
+// CAPTCHA the provider requires
+func (h *Handlers) checkBookingForm(c *gin.Context, userID int64, form captcha.Form) error {
+	required, err := h.captchaRequired(c, userID)
+	if err != nil {
+		return err
+	}
+	return captcha.CheckForm(c.Request.Context(), form, c.ClientIP(), required)
+}
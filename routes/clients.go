@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"net/http"
+
+	"example.com/models"
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handlers) getClients(c *gin.Context) {
+	page, ok := pageRequest(c, models.ClientKeyset)
+	if !ok {
+		return
+	}
+
+	clients, meta, err := h.repos.Clients.List(c.Request.Context(), c.GetInt64("userId"), page)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if clients == nil {
+		clients = []models.ClientSummary{}
+	}
+	respondPage(c, clients, meta, gin.H{"clients": clients})
+}
+
+func (h *Handlers) getClient(c *gin.Context) {
+	clientID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	client, err := h.repos.Clients.Get(c.Request.Context(), clientID, c.GetInt64("userId"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	respond(c, http.StatusOK, client, gin.H{"client": client})
+}
+
+func (h *Handlers) updateClient(c *gin.Context) {
+	clientID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	var client models.Client
+	if !bindJSON(c, &client) {
+		return
+	}
+	client.ID = clientID
+	client.UserID = c.GetInt64("userId")
+
+	err := h.repos.Clients.Update(c.Request.Context(), &client)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	respond(c, http.StatusOK, client, gin.H{"message": "client updated", "client": client})
+}
+
+// mergeClient folds the client given as sourceId into the one in the URL
+func (h *Handlers) mergeClient(c *gin.Context) {
+	targetID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	var body struct {
+		SourceID int64 `json:"sourceId" binding:"required"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	userID := c.GetInt64("userId")
+	err := h.repos.Clients.Merge(c.Request.Context(), userID, targetID, body.SourceID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	client, err := h.repos.Clients.Get(c.Request.Context(), targetID, userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	respond(c, http.StatusOK, client, gin.H{"message": "clients merged", "client": client})
+}
@@ -0,0 +1,11 @@
+package routes
+
+import "example.com/models"
+
+// Errors shared by handlers that don't come from the models package
+var (
+	errNotOwner       = models.Forbidden("not_owner", "you are not allowed to modify this resource")
+	errPaymentGateway = models.Unavailable("payment_gateway_error", "the payment provider could not be reached")
+	errUploadFailed   = models.Unavailable("upload_failed", "the media could not be uploaded")
+	errMediaNotFound  = models.NotFound("media_not_found", "the service has no such media")
+)
@@ -2,117 +2,116 @@ package routes
 
 import (
 	"net/http"
-	"strconv"
 
 	"example.com/models"
 	"github.com/gin-gonic/gin"
 )
 
-func getEvents(context *gin.Context) {
-	events, err := models.GetAllEvents()
+func (h *Handlers) getEvents(context *gin.Context) {
+	page, ok := pageRequest(context, models.EventKeyset)
+	if !ok {
+		return
+	}
+
+	events, meta, err := h.repos.Events.List(context.Request.Context(), page)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Server error: " + err.Error()})
+		context.Error(err)
 		return
 	}
-	context.JSON(http.StatusOK, events)
+	if events == nil {
+		events = []models.Event{}
+	}
+	respondPage(context, events, meta, events)
 }
 
-func getEvent(context *gin.Context) {
-	id, err := strconv.ParseInt(context.Param("id"), 10, 64)
-	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Could not parse id: " + err.Error()})
+func (h *Handlers) getEvent(context *gin.Context) {
+	id, ok := paramID(context, "id")
+	if !ok {
 		return
 	}
 
-	event, err := models.GetEventById(id)
+	event, err := h.repos.Events.GetByID(context.Request.Context(), id)
 	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Could not fetch event by id: " + err.Error()})
+		context.Error(err)
 		return
 	}
-	context.JSON(http.StatusOK, event)
+	respond(context, http.StatusOK, event, event)
 }
 
-func createEvent(context *gin.Context) {
+func (h *Handlers) createEvent(context *gin.Context) {
 	var event models.Event
-	err := context.ShouldBindJSON(&event)
-
-	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "can't parse the request"})
+	if !bindJSON(context, &event) {
 		return
 	}
 
 	userId := context.GetInt64("userId")
 	event.UserID = userId
 
-	err = event.Save()
+	err := h.repos.Events.Create(context.Request.Context(), &event)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Server error: " + err.Error()})
+		context.Error(err)
 		return
 	}
 
-	context.JSON(http.StatusCreated, gin.H{"message": "Event created"})
+	respond(context, http.StatusCreated, event, gin.H{"message": "Event created"})
 }
 
-func updateEvent(context *gin.Context) {
-	id, err := strconv.ParseInt(context.Param("id"), 10, 64)
-	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Could not parse id: " + err.Error()})
+func (h *Handlers) updateEvent(context *gin.Context) {
+	id, ok := paramID(context, "id")
+	if !ok {
 		return
 	}
 
 	userId := context.GetInt64("userId")
-	event, err := models.GetEventById(id)
+	event, err := h.repos.Events.GetByID(context.Request.Context(), id)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch event by id: " + err.Error()})
+		context.Error(err)
 		return
 	}
 
 	if userId != event.UserID {
-		context.JSON(http.StatusUnauthorized, gin.H{"message": "Could not authorize user"})
+		context.Error(errNotOwner)
 		return
 	}
 
 	var updatedEvent models.Event
-	err = context.ShouldBindJSON(&updatedEvent)
-	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "can't parse the request: " + err.Error()})
+	if !bindJSON(context, &updatedEvent) {
 		return
 	}
 
 	updatedEvent.ID = id
-	err = updatedEvent.Update()
+	err = h.repos.Events.Update(context.Request.Context(), &updatedEvent)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Could not update event by id: " + err.Error()})
+		context.Error(err)
 		return
 	}
 
-	context.JSON(http.StatusOK, gin.H{"message": "Success!"})
+	respond(context, http.StatusOK, updatedEvent, gin.H{"message": "Success!"})
 }
 
-func deleteEvent(context *gin.Context) {
-	id, err := strconv.ParseInt(context.Param("id"), 10, 64)
-	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Could not parse id: " + err.Error()})
+func (h *Handlers) deleteEvent(context *gin.Context) {
+	id, ok := paramID(context, "id")
+	if !ok {
 		return
 	}
 
 	userId := context.GetInt64("userId")
-	event, err := models.GetEventById(id)
+	event, err := h.repos.Events.GetByID(context.Request.Context(), id)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch event by id: " + err.Error()})
+		context.Error(err)
 		return
 	}
 
 	if userId != event.UserID {
-		context.JSON(http.StatusUnauthorized, gin.H{"message": "Could not authorize user"})
+		context.Error(errNotOwner)
 		return
 	}
 
-	err = event.Delete()
+	err = h.repos.Events.Delete(context.Request.Context(), event.ID)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Could not delete event of id: " + err.Error()})
+		context.Error(err)
 		return
 	}
 
-	context.JSON(http.StatusOK, gin.H{"message": "Event deleted!"})
+	respond(context, http.StatusOK, nil, gin.H{"message": "Event deleted!"})
 }
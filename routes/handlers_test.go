@@ -0,0 +1,292 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"example.com/middlewares"
+	"example.com/models"
+	"example.com/pagination"
+	"github.com/gin-gonic/gin"
+)
+
+// newTestServer serves the API from in-memory repositories holding one provider
+func newTestServer(t *testing.T) (*gin.Engine, models.Repositories, *models.User) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	repos := models.NewMemoryRepositories()
+	user, err := repos.Users.FindOrCreateOAuth(context.Background(), &models.OAuthUser{
+		Email: "provider@example.com", Name: "Provider", OAuthProvider: "google", OAuthProviderID: "1",
+	})
+	if err != nil {
+		t.Fatalf("create provider: %v", err)
+	}
+
+	server := gin.New()
+	server.Use(middlewares.ErrorHandler())
+	RegisterRoutes(server, NewHandlers(repos, nil))
+	return server, repos, user
+}
+
+func get(t *testing.T, server *gin.Engine, path string, out any) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("GET %s: decode %q: %v", path, w.Body.String(), err)
+		}
+	}
+	return w.Code
+}
+
+func post(t *testing.T, server *gin.Engine, path string, body any, out any) int {
+	t.Helper()
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("POST %s: encode: %v", path, err)
+	}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	server.ServeHTTP(w, req)
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("POST %s: decode %q: %v", path, w.Body.String(), err)
+		}
+	}
+	return w.Code
+}
+
+func TestScheduleByAliasUsesRepositories(t *testing.T) {
+	server, repos, user := newTestServer(t)
+	date := time.Now().UTC().AddDate(0, 0, 1)
+	_, err := repos.Schedules.Save(context.Background(), user.ID, date, []models.TimeRangePayload{{Start: "09:00", End: "12:00"}})
+	if err != nil {
+		t.Fatalf("save schedule: %v", err)
+	}
+
+	var body struct {
+		Data []models.TimeRange `json:"data"`
+	}
+	path := "/api/v1/schedule/" + user.Alias + "/" + date.Format("2006-01-02")
+	if code := get(t, server, path, &body); code != http.StatusOK {
+		t.Fatalf("GET %s = %d, want 200", path, code)
+	}
+	if len(body.Data) != 1 || body.Data[0].StartTime != "09:00" || body.Data[0].EndTime != "12:00" {
+		t.Errorf("GET %s = %+v, want one 09:00-12:00 range", path, body.Data)
+	}
+
+	if code := get(t, server, "/api/v1/schedule/unknown/"+date.Format("2006-01-02"), nil); code != http.StatusNotFound {
+		t.Errorf("unknown alias = %d, want 404", code)
+	}
+}
+
+func TestServicesByAliasPaginates(t *testing.T) {
+	server, repos, user := newTestServer(t)
+	for _, name := range []string{"Cut", "Colour", "Blow dry"} {
+		service := &models.Service{Name: name, Price: "20.00", Currency: "EUR", Duration: 30, UserID: user.ID}
+		if err := repos.Services.Create(context.Background(), service); err != nil {
+			t.Fatalf("create service: %v", err)
+		}
+	}
+
+	var names []string
+	path := "/api/v1/services/" + user.Alias + "?sort=name&limit=2"
+	for path != "" {
+		var body struct {
+			Data []models.Service `json:"data"`
+			Meta struct {
+				Total      int64  `json:"total"`
+				NextCursor string `json:"nextCursor"`
+			} `json:"meta"`
+		}
+		if code := get(t, server, path, &body); code != http.StatusOK {
+			t.Fatalf("GET %s = %d, want 200", path, code)
+		}
+		if body.Meta.Total != 3 {
+			t.Errorf("GET %s total = %d, want 3", path, body.Meta.Total)
+		}
+		for _, s := range body.Data {
+			names = append(names, s.Name)
+		}
+		path = ""
+		if body.Meta.NextCursor != "" {
+			path = "/api/v1/services/" + user.Alias + "?sort=name&limit=2&cursor=" + body.Meta.NextCursor
+		}
+	}
+
+	want := []string{"Blow dry", "Colour", "Cut"}
+	if len(names) != len(want) {
+		t.Fatalf("listed %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("listed %v, want %v", names, want)
+		}
+	}
+}
+
+func TestMissingEventIsNotFound(t *testing.T) {
+	server, _, _ := newTestServer(t)
+
+	var problem middlewares.Problem
+	if code := get(t, server, "/api/v1/events/42", &problem); code != http.StatusNotFound {
+		t.Fatalf("GET /api/v1/events/42 = %d, want 404", code)
+	}
+	if problem.Code != "event_not_found" {
+		t.Errorf("problem code = %q, want event_not_found", problem.Code)
+	}
+}
+
+func TestBookingChecksRestrictions(t *testing.T) {
+	server, repos, user := newTestServer(t)
+	ctx := context.Background()
+	date := time.Now().UTC().AddDate(0, 0, 1)
+	if _, err := repos.Schedules.Save(ctx, user.ID, date, []models.TimeRangePayload{{Start: "09:00", End: "12:00"}}); err != nil {
+		t.Fatalf("save schedule: %v", err)
+	}
+	service := &models.Service{Name: "Cut", Price: "20.00", Currency: "EUR", Duration: 30, UserID: user.ID}
+	if err := repos.Services.Create(ctx, service); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	block := &models.BlockEntry{UserID: user.ID, Kind: models.BlockEmail, Value: "Blocked@Example.com"}
+	if err := repos.Restrictions.CreateBlock(ctx, block); err != nil {
+		t.Fatalf("create block: %v", err)
+	}
+
+	path := "/api/v1/appointments/" + user.Alias
+	booking := gin.H{
+		"serviceId": service.ID,
+		"date":      date.Format("2006-01-02"),
+		"startTime": "09:00",
+		"firstName": "Ann",
+		"lastName":  "Client",
+		"email":     "blocked@example.com",
+		"phone":     "+14155550100",
+	}
+	var problem middlewares.Problem
+	if code := post(t, server, path, booking, &problem); code != http.StatusForbidden {
+		t.Fatalf("blocked booking = %d, want 403", code)
+	}
+	if problem.Code != "booking_restricted" {
+		t.Errorf("problem code = %q, want booking_restricted", problem.Code)
+	}
+
+	// The refused booking must not have taken the slot
+	booking["email"] = "ann@example.com"
+	if code := post(t, server, path, booking, nil); code != http.StatusCreated {
+		t.Fatalf("booking = %d, want 201", code)
+	}
+
+	// Numbers too short to dial from abroad aren't stored as E.164
+	booking["startTime"], booking["phone"] = "10:00", "+15550100"
+	if code := post(t, server, path, booking, nil); code != http.StatusBadRequest {
+		t.Errorf("booking with a local-only number = %d, want 400", code)
+	}
+}
+
+func TestLegacyListsAreUnbounded(t *testing.T) {
+	server, repos, user := newTestServer(t)
+	for i := 0; i < pagination.DefaultLimit+5; i++ {
+		service := &models.Service{Name: fmt.Sprintf("Service %02d", i), Price: "20.00", Currency: "EUR", Duration: 30, UserID: user.ID}
+		if err := repos.Services.Create(context.Background(), service); err != nil {
+			t.Fatalf("create service: %v", err)
+		}
+	}
+
+	var legacy []models.Service
+	if code := get(t, server, "/api/services/"+user.Alias, &legacy); code != http.StatusOK {
+		t.Fatalf("legacy list = %d, want 200", code)
+	}
+	if len(legacy) != pagination.DefaultLimit+5 {
+		t.Errorf("legacy list has %d services, want all %d", len(legacy), pagination.DefaultLimit+5)
+	}
+
+	var v1 struct {
+		Data []models.Service `json:"data"`
+	}
+	if code := get(t, server, "/api/v1/services/"+user.Alias, &v1); code != http.StatusOK {
+		t.Fatalf("v1 list = %d, want 200", code)
+	}
+	if len(v1.Data) != pagination.DefaultLimit {
+		t.Errorf("v1 list has %d services, want a page of %d", len(v1.Data), pagination.DefaultLimit)
+	}
+}
+
+func TestSlotHoldsAreCappedPerClient(t *testing.T) {
+	server, repos, user := newTestServer(t)
+	ctx := context.Background()
+	date := time.Now().UTC().AddDate(0, 0, 1)
+	if _, err := repos.Schedules.Save(ctx, user.ID, date, []models.TimeRangePayload{{Start: "09:00", End: "17:00"}}); err != nil {
+		t.Fatalf("save schedule: %v", err)
+	}
+	service := &models.Service{Name: "Cut", Price: "20.00", Currency: "EUR", Duration: 30, UserID: user.ID}
+	if err := repos.Services.Create(ctx, service); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+
+	path := "/api/v1/holds/" + user.Alias
+	hold := func(startTime string) int {
+		return post(t, server, path, gin.H{"serviceId": service.ID, "date": date.Format("2006-01-02"), "startTime": startTime}, nil)
+	}
+	for i := 0; i < models.MaxHoldsPerIP; i++ {
+		if code := hold(fmt.Sprintf("%02d:00", 9+i)); code != http.StatusCreated {
+			t.Fatalf("hold %d = %d, want 201", i+1, code)
+		}
+	}
+	if code := hold("16:00"); code != http.StatusTooManyRequests {
+		t.Errorf("hold over the cap = %d, want 429", code)
+	}
+
+	// Blocked addresses can't hold slots at all
+	server, repos, user = newTestServer(t)
+	block := &models.BlockEntry{UserID: user.ID, Kind: models.BlockIP, Value: "192.0.2.1"}
+	if err := repos.Restrictions.CreateBlock(ctx, block); err != nil {
+		t.Fatalf("create block: %v", err)
+	}
+	if code := post(t, server, "/api/v1/holds/"+user.Alias, gin.H{"serviceId": 1, "date": date.Format("2006-01-02"), "startTime": "09:00"}, nil); code != http.StatusForbidden {
+		t.Errorf("hold from a blocked address = %d, want 403", code)
+	}
+}
+
+func TestClientsCannotCancelStartedAppointments(t *testing.T) {
+	server, repos, user := newTestServer(t)
+	ctx := context.Background()
+	book := func(date time.Time) *models.Appointment {
+		if _, err := repos.Schedules.Save(ctx, user.ID, date, []models.TimeRangePayload{{Start: "09:00", End: "10:00"}}); err != nil {
+			t.Fatalf("save schedule: %v", err)
+		}
+		appt := &models.Appointment{UserID: user.ID, Date: date.Format("2006-01-02"), StartTime: "09:00", EndTime: "10:00"}
+		if err := repos.Appointments.Create(ctx, appt); err != nil {
+			t.Fatalf("create appointment: %v", err)
+		}
+		return appt
+	}
+	cancel := func(appt *models.Appointment) (int, middlewares.Problem) {
+		var problem middlewares.Problem
+		code := post(t, server, "/api/v1/appointments/"+user.Alias+"/"+appt.ID+"/cancel", gin.H{"token": appt.CancelToken}, &problem)
+		return code, problem
+	}
+
+	past := book(time.Now().UTC().AddDate(0, 0, -1))
+	if code, problem := cancel(past); code != http.StatusConflict || problem.Code != "not_cancellable" {
+		t.Errorf("cancelling a past appointment = %d %q, want 409 not_cancellable", code, problem.Code)
+	}
+	if err := repos.Appointments.SetNoShow(ctx, past.ID, user.ID, true); err != nil {
+		t.Fatalf("mark no-show: %v", err)
+	}
+	if code, _ := cancel(past); code != http.StatusConflict {
+		t.Errorf("cancelling a no-show = %d, want 409", code)
+	}
+
+	if code, _ := cancel(book(time.Now().UTC().AddDate(0, 0, 2))); code != http.StatusOK {
+		t.Errorf("cancelling an upcoming appointment = %d, want 200", code)
+	}
+}
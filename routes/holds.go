@@ -0,0 +1,91 @@
+package routes
+
+import (
+	"net/http"
+
+	"example.com/models"
+	"github.com/gin-gonic/gin"
+)
+
+type slotHoldRequest struct {
+	ServiceID int64                    `json:"serviceId"`
+	VariantID *int64                   `json:"variantId"`
+	AddOnIDs  []int64                  `json:"addOnIds"`
+	Items     []models.AppointmentItem `json:"items"`
+	Date      string                   `json:"date" binding:"required"`
+	StartTime string                   `json:"startTime" binding:"required"`
+	EndTime   string                   `json:"endTime"`
+}
+
+// createSlotHold reserves a slot for the services the client picked, so it is
+// not offered to anyone else while they fill in the booking form. The
+// booking page asks for a CAPTCHA only when booking, so holds are refused
+// to blocked addresses and capped per address and provider instead.
+func (h *Handlers) createSlotHold(c *gin.Context) {
+	user, err := h.repos.Users.GetByAlias(c.Request.Context(), c.Param("alias"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var body slotHoldRequest
+	if !bindJSON(c, &body) {
+		return
+	}
+	if err := models.ValidateSlotTime(body.Date, body.StartTime, body.EndTime); err != nil {
+		c.Error(err)
+		return
+	}
+	if _, err := h.repos.Restrictions.Check(c.Request.Context(), user.ID, "", "", c.ClientIP()); err != nil {
+		c.Error(err)
+		return
+	}
+
+	// Compute the end time the same way the booking will
+	appt := models.Appointment{
+		ServiceID: body.ServiceID,
+		VariantID: body.VariantID,
+		AddOnIDs:  body.AddOnIDs,
+		Items:     body.Items,
+		Date:      body.Date,
+		StartTime: body.StartTime,
+		EndTime:   body.EndTime,
+	}
+	if err := applyAppointmentServices(c.Request.Context(), h.repos.Services, user.ID, &appt); err != nil {
+		c.Error(err)
+		return
+	}
+
+	hold := models.SlotHold{
+		UserID:    user.ID,
+		Date:      appt.Date,
+		StartTime: appt.StartTime,
+		EndTime:   appt.EndTime,
+		IP:        c.ClientIP(),
+	}
+	err = h.repos.Holds.Create(c.Request.Context(), &hold)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusCreated, hold, gin.H{"message": "slot held", "hold": hold})
+}
+
+func (h *Handlers) releaseSlotHold(c *gin.Context) {
+	user, err := h.repos.Users.GetByAlias(c.Request.Context(), c.Param("alias"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	err = h.repos.Holds.Release(c.Request.Context(), c.Param("id"), user.ID, c.Query("token"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	h.offerFreedSlots(c)
+
+	respond(c, http.StatusOK, nil, gin.H{"message": "hold released"})
+}
@@ -9,9 +9,12 @@ import (
 	"net/url"
 
 	"example.com/config"
+	"example.com/metrics"
 	"example.com/models"
+	"example.com/tracing"
 	"example.com/utils"
 	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
 )
 
 // Google OAuth user info response
@@ -37,7 +40,7 @@ func googleLogin(c *gin.Context) {
 }
 
 // googleCallback handles the callback from Google OAuth
-func googleCallback(c *gin.Context) {
+func (h *Handlers) googleCallback(c *gin.Context) {
 	state := c.Query("state")
 	if state != config.OAuthStateString {
 		redirectWithError(c, "Invalid OAuth state")
@@ -50,14 +53,14 @@ func googleCallback(c *gin.Context) {
 		return
 	}
 
-	token, err := config.GoogleOAuthConfig.Exchange(context.Background(), code)
+	token, err := config.GoogleOAuthConfig.Exchange(oauthContext(c), code)
 	if err != nil {
 		redirectWithError(c, "Failed to exchange token")
 		return
 	}
 
 	// Get user info from Google
-	resp, err := http.Get("https://www.googleapis.com/oauth2/v2/userinfo?access_token=" + token.AccessToken)
+	resp, err := oauthGet(c, "https://www.googleapis.com/oauth2/v2/userinfo?access_token="+token.AccessToken)
 	if err != nil {
 		redirectWithError(c, "Failed to get user info")
 		return
@@ -89,7 +92,7 @@ func googleCallback(c *gin.Context) {
 		OAuthProviderID: googleUser.ID,
 	}
 
-	user, err := models.FindOrCreateOAuthUser(oauthUser)
+	user, err := h.repos.Users.FindOrCreateOAuth(c.Request.Context(), oauthUser)
 	if err != nil {
 		redirectWithError(c, "Failed to create user")
 		return
@@ -102,6 +105,7 @@ func googleCallback(c *gin.Context) {
 		return
 	}
 
+	metrics.OAuthLogins.WithLabelValues("google").Inc()
 	// Redirect to frontend with tokens
 	redirectWithTokens(c, accessToken, refreshToken)
 }
@@ -113,7 +117,7 @@ func facebookLogin(c *gin.Context) {
 }
 
 // facebookCallback handles the callback from Facebook OAuth
-func facebookCallback(c *gin.Context) {
+func (h *Handlers) facebookCallback(c *gin.Context) {
 	state := c.Query("state")
 	if state != config.OAuthStateString {
 		redirectWithError(c, "Invalid OAuth state")
@@ -126,14 +130,14 @@ func facebookCallback(c *gin.Context) {
 		return
 	}
 
-	token, err := config.FacebookOAuthConfig.Exchange(context.Background(), code)
+	token, err := config.FacebookOAuthConfig.Exchange(oauthContext(c), code)
 	if err != nil {
 		redirectWithError(c, "Failed to exchange token")
 		return
 	}
 
 	// Get user info from Facebook
-	resp, err := http.Get(fmt.Sprintf(
+	resp, err := oauthGet(c, fmt.Sprintf(
 		"https://graph.facebook.com/me?fields=id,email,name&access_token=%s",
 		token.AccessToken,
 	))
@@ -168,7 +172,7 @@ func facebookCallback(c *gin.Context) {
 		OAuthProviderID: fbUser.ID,
 	}
 
-	user, err := models.FindOrCreateOAuthUser(oauthUser)
+	user, err := h.repos.Users.FindOrCreateOAuth(c.Request.Context(), oauthUser)
 	if err != nil {
 		redirectWithError(c, "Failed to create user")
 		return
@@ -181,12 +185,19 @@ func facebookCallback(c *gin.Context) {
 		return
 	}
 
+	metrics.OAuthLogins.WithLabelValues("facebook").Inc()
 	// Redirect to frontend with tokens
 	redirectWithTokens(c, accessToken, refreshToken)
 }
 
 // Mobile token endpoints
 
+var (
+	errOAuthProvider     = models.Unavailable("oauth_provider_error", "the sign-in provider could not be reached")
+	errInvalidOAuthToken = models.Unauthorized("invalid_token", "the sign-in token is invalid")
+	errOAuthEmailMissing = models.Invalid("email_required", "the sign-in provider did not share an email address")
+)
+
 type GoogleTokenRequest struct {
 	IDToken string `json:"id_token" binding:"required"`
 }
@@ -196,29 +207,29 @@ type FacebookTokenRequest struct {
 }
 
 // googleTokenLogin verifies a Google ID token from a mobile app and returns JWTs
-func googleTokenLogin(c *gin.Context) {
+func (h *Handlers) googleTokenLogin(c *gin.Context) {
 	var req GoogleTokenRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "id_token is required"})
+		c.Error(&models.ValidationError{Field: "id_token", Message: "is required"})
 		return
 	}
 
 	// Verify the ID token with Google
-	resp, err := http.Get("https://oauth2.googleapis.com/tokeninfo?id_token=" + req.IDToken)
+	resp, err := oauthGet(c, "https://oauth2.googleapis.com/tokeninfo?id_token="+req.IDToken)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to verify token"})
+		c.Error(errOAuthProvider.Wrap(err))
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid ID token"})
+		c.Error(errInvalidOAuthToken)
 		return
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to read token info"})
+		c.Error(errOAuthProvider.Wrap(err))
 		return
 	}
 
@@ -230,18 +241,18 @@ func googleTokenLogin(c *gin.Context) {
 		Aud           string `json:"aud"`
 	}
 	if err := json.Unmarshal(body, &tokenInfo); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to parse token info"})
+		c.Error(errOAuthProvider.Wrap(err))
 		return
 	}
 
 	// Verify the token was issued for our app
 	if tokenInfo.Aud != config.GoogleOAuthConfig.ClientID {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "Token was not issued for this application"})
+		c.Error(errInvalidOAuthToken)
 		return
 	}
 
 	if tokenInfo.Email == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Email not available in token"})
+		c.Error(errOAuthEmailMissing)
 		return
 	}
 
@@ -252,62 +263,63 @@ func googleTokenLogin(c *gin.Context) {
 		OAuthProviderID: tokenInfo.Sub,
 	}
 
-	user, err := models.FindOrCreateOAuthUser(oauthUser)
+	user, err := h.repos.Users.FindOrCreateOAuth(c.Request.Context(), oauthUser)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create user"})
+		c.Error(err)
 		return
 	}
 
 	accessToken, refreshToken, err := utils.GenerateTokens(user.Email, user.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to generate tokens"})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	metrics.OAuthLogins.WithLabelValues("google").Inc()
+	respond(c, http.StatusOK, tokenPair{AccessToken: accessToken, RefreshToken: refreshToken}, gin.H{
 		"access_token":  accessToken,
 		"refresh_token": refreshToken,
 	})
 }
 
 // facebookTokenLogin verifies a Facebook access token from a mobile app and returns JWTs
-func facebookTokenLogin(c *gin.Context) {
+func (h *Handlers) facebookTokenLogin(c *gin.Context) {
 	var req FacebookTokenRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "access_token is required"})
+		c.Error(&models.ValidationError{Field: "access_token", Message: "is required"})
 		return
 	}
 
 	// Verify and get user info from Facebook
-	resp, err := http.Get(fmt.Sprintf(
+	resp, err := oauthGet(c, fmt.Sprintf(
 		"https://graph.facebook.com/me?fields=id,email,name&access_token=%s",
 		req.AccessToken,
 	))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to verify token"})
+		c.Error(errOAuthProvider.Wrap(err))
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid access token"})
+		c.Error(errInvalidOAuthToken)
 		return
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to read response"})
+		c.Error(errOAuthProvider.Wrap(err))
 		return
 	}
 
 	var fbUser FacebookUserInfo
 	if err := json.Unmarshal(body, &fbUser); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to parse user info"})
+		c.Error(errOAuthProvider.Wrap(err))
 		return
 	}
 
 	if fbUser.Email == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Email not provided by Facebook"})
+		c.Error(errOAuthEmailMissing)
 		return
 	}
 
@@ -318,19 +330,20 @@ func facebookTokenLogin(c *gin.Context) {
 		OAuthProviderID: fbUser.ID,
 	}
 
-	user, err := models.FindOrCreateOAuthUser(oauthUser)
+	user, err := h.repos.Users.FindOrCreateOAuth(c.Request.Context(), oauthUser)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create user"})
+		c.Error(err)
 		return
 	}
 
 	accessToken, refreshToken, err := utils.GenerateTokens(user.Email, user.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to generate tokens"})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	metrics.OAuthLogins.WithLabelValues("facebook").Inc()
+	respond(c, http.StatusOK, tokenPair{AccessToken: accessToken, RefreshToken: refreshToken}, gin.H{
 		"access_token":  accessToken,
 		"refresh_token": refreshToken,
 	})
@@ -347,6 +360,21 @@ func redirectWithError(c *gin.Context, errorMsg string) {
 	c.Redirect(http.StatusTemporaryRedirect, redirectURL)
 }
 
+// oauthContext is the request's context, carrying the traced HTTP client for
+// the oauth2 package to exchange codes with
+func oauthContext(c *gin.Context) context.Context {
+	return context.WithValue(c.Request.Context(), oauth2.HTTPClient, tracing.HTTPClient)
+}
+
+// oauthGet fetches rawURL from a provider as part of the request's trace
+func oauthGet(c *gin.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return tracing.HTTPClient.Do(req)
+}
+
 // redirectWithTokens redirects to frontend with tokens
 func redirectWithTokens(c *gin.Context, accessToken, refreshToken string) {
 	redirectURL := fmt.Sprintf("%s/auth/callback?token=%s&refresh_token=%s",
@@ -0,0 +1,315 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"example.com/middlewares"
+	"example.com/models"
+	"example.com/openapi"
+	"example.com/pagination"
+	"github.com/gin-gonic/gin"
+)
+
+var message = openapi.Fields{"message": ""}
+
+// apiOp documents an endpoint mounted by registerAPI. Response is the data
+// of the v1 envelope, nil for 204 No Content.
+type apiOp struct {
+	openapi.Op
+	// Legacy is the body the deprecated unversioned route returns
+	Legacy any
+	// Page is set on list endpoints paginated by pageRequest
+	Page *pagination.Keyset
+}
+
+// pageParameters documents the limit, sort and cursor query parameters
+// accepted by a list endpoint sorted by ks
+func pageParameters(ks *pagination.Keyset) []openapi.Parameter {
+	sorts := make([]string, 0, 2*len(ks.Sorts))
+	for name := range ks.Sorts {
+		sorts = append(sorts, name, "-"+name)
+	}
+	sort.Strings(sorts)
+	return []openapi.Parameter{
+		{Name: "limit", Description: fmt.Sprintf("page size, default %d, at most %d", pagination.DefaultLimit, pagination.MaxLimit),
+			Schema: &openapi.Schema{Type: "integer"}},
+		{Name: "sort", Description: fmt.Sprintf("sort key, prefix with - for descending, default %s", ks.Default),
+			Schema: &openapi.Schema{Type: "string", Enum: sorts}},
+		{Name: "cursor", Description: "nextCursor from the previous page"},
+	}
+}
+
+// systemOperations documents the unversioned routes outside registerAPI
+var systemOperations = []openapi.Op{
+	{Method: "GET", Path: "/health", Tag: "system", Summary: "Liveness check", Response: openapi.Fields{"status": ""}},
+	{Method: "GET", Path: "/ready", Tag: "system", Summary: "Readiness check; 503 until the database is reachable and migrated", Response: openapi.Fields{"status": ""}},
+	{Method: "GET", Path: "/api/openapi.json", Tag: "system", Summary: "This OpenAPI document", Response: openapi.Fields{}},
+	{Method: "GET", Path: "/api/docs", Tag: "system", Summary: "Interactive API documentation", Response: "", ContentType: "text/html"},
+}
+
+// apiOperations documents every route registered in registerAPI. The route
+// coverage test fails when the two drift apart.
+var apiOperations = []apiOp{
+	// Auth
+	{Op: openapi.Op{Method: "POST", Path: "/auth/signup", Tag: "auth", Summary: "Create an account", Body: models.User{}},
+		Legacy: message},
+	{Op: openapi.Op{Method: "POST", Path: "/auth/login", Tag: "auth", Summary: "Log in with email and password", Body: models.User{},
+		Response: tokenPair{}},
+		Legacy: openapi.Fields{"message": "", "token": "", "refresh_token": "", "refresh_token_expire": 0}},
+	{Op: openapi.Op{Method: "POST", Path: "/auth/refresh", Tag: "auth", Summary: "Exchange a refresh token for new tokens",
+		Body: openapi.Fields{"refreshToken": ""}, Response: tokenPair{}},
+		Legacy: openapi.Fields{"accessToken": ""}},
+	{Op: openapi.Op{Method: "GET", Path: "/auth/google", Tag: "auth", Summary: "Start Google sign-in", Status: http.StatusTemporaryRedirect}},
+	{Op: openapi.Op{Method: "GET", Path: "/auth/google/callback", Tag: "auth", Summary: "Google sign-in callback; redirects to the frontend with tokens",
+		Query: []openapi.Parameter{{Name: "code"}, {Name: "state"}}, Status: http.StatusTemporaryRedirect}},
+	{Op: openapi.Op{Method: "GET", Path: "/auth/facebook", Tag: "auth", Summary: "Start Facebook sign-in", Status: http.StatusTemporaryRedirect}},
+	{Op: openapi.Op{Method: "GET", Path: "/auth/facebook/callback", Tag: "auth", Summary: "Facebook sign-in callback; redirects to the frontend with tokens",
+		Query: []openapi.Parameter{{Name: "code"}, {Name: "state"}}, Status: http.StatusTemporaryRedirect}},
+	{Op: openapi.Op{Method: "POST", Path: "/auth/google/token", Tag: "auth", Summary: "Sign in with a Google ID token from a mobile app",
+		Body: GoogleTokenRequest{}, Response: tokenPair{}},
+		Legacy: openapi.Fields{"access_token": "", "refresh_token": ""}},
+	{Op: openapi.Op{Method: "POST", Path: "/auth/facebook/token", Tag: "auth", Summary: "Sign in with a Facebook access token from a mobile app",
+		Body: FacebookTokenRequest{}, Response: tokenPair{}},
+		Legacy: openapi.Fields{"access_token": "", "refresh_token": ""}},
+	{Op: openapi.Op{Method: "GET", Path: "/alias", Tag: "auth", Summary: "Get the public booking alias", Auth: true,
+		Response: openapi.Fields{"alias": ""}},
+		Legacy: openapi.Fields{"alias": ""}},
+	{Op: openapi.Op{Method: "PUT", Path: "/alias", Tag: "auth", Summary: "Change the public booking alias", Auth: true,
+		Body: openapi.Fields{"alias": ""}, Response: openapi.Fields{"alias": ""}},
+		Legacy: openapi.Fields{"message": "", "alias": ""}},
+
+	// Events
+	{Op: openapi.Op{Method: "GET", Path: "/events", Tag: "events", Summary: "List events", Response: []models.Event{}},
+		Legacy: []models.Event{}, Page: &models.EventKeyset},
+	{Op: openapi.Op{Method: "GET", Path: "/events/:id", Tag: "events", Summary: "Get an event", Response: models.Event{}},
+		Legacy: models.Event{}},
+	{Op: openapi.Op{Method: "POST", Path: "/events", Tag: "events", Summary: "Create an event", Auth: true,
+		Body: models.Event{}, Status: http.StatusCreated, Response: models.Event{}},
+		Legacy: message},
+	{Op: openapi.Op{Method: "PUT", Path: "/events/:id", Tag: "events", Summary: "Update an event", Auth: true,
+		Body: models.Event{}, Response: models.Event{}},
+		Legacy: message},
+	{Op: openapi.Op{Method: "DELETE", Path: "/events/:id", Tag: "events", Summary: "Delete an event", Auth: true},
+		Legacy: message},
+	{Op: openapi.Op{Method: "POST", Path: "/events/:id/register", Tag: "events", Summary: "Register for an event", Auth: true, Status: http.StatusCreated},
+		Legacy: message},
+	{Op: openapi.Op{Method: "DELETE", Path: "/events/:id/register", Tag: "events", Summary: "Cancel an event registration", Auth: true},
+		Legacy: message},
+
+	// Services
+	{Op: openapi.Op{Method: "GET", Path: "/services/:alias", Tag: "services", Summary: "List a provider's services", Response: []models.Service{}},
+		Legacy: []models.Service{}, Page: &models.ServiceKeyset},
+	{Op: openapi.Op{Method: "GET", Path: "/services", Tag: "services", Summary: "List your services", Auth: true, Response: []models.Service{}},
+		Legacy: []models.Service{}, Page: &models.ServiceKeyset},
+	{Op: openapi.Op{Method: "POST", Path: "/services", Tag: "services", Summary: "Create a service with media, variants and add-ons", Auth: true,
+		Form: openapi.Fields{
+			"name": "", "description": "", "price": "", "currency": "", "duration": 0,
+			"variants": "", "addOns": "", "media": []openapi.File{},
+		},
+		Status: http.StatusCreated, Response: models.Service{}},
+		Legacy: openapi.Fields{"message": models.Service{}}},
+	{Op: openapi.Op{Method: "PUT", Path: "/services/:id", Tag: "services", Summary: "Update a service", Auth: true,
+		Body: models.Service{}, Response: models.Service{}},
+		Legacy: openapi.Fields{"message": "", "service": models.Service{}}},
+	{Op: openapi.Op{Method: "DELETE", Path: "/services/:id", Tag: "services", Summary: "Delete a service and its media", Auth: true},
+		Legacy: message},
+	{Op: openapi.Op{Method: "PATCH", Path: "/services/:id/add-media", Tag: "services", Summary: "Upload photos or short MP4/MOV clips to a service", Auth: true,
+		Form: openapi.Fields{"media": []openapi.File{}}, Response: models.Service{}},
+		Legacy: openapi.Fields{"message": "", "service": models.Service{}}},
+	{Op: openapi.Op{Method: "DELETE", Path: "/services/:id/delete-media/:mediaId", Tag: "services", Summary: "Delete a service's media item", Auth: true,
+		Response: models.Service{}},
+		Legacy: message},
+	{Op: openapi.Op{Method: "PATCH", Path: "/services/:id/update-media-order", Tag: "services", Summary: "Reorder a service's media", Auth: true,
+		Body: UpdateServiceMedia{}, Response: models.Service{}},
+		Legacy: openapi.Fields{"message": "", "service": models.Service{}}},
+	{Op: openapi.Op{Method: "POST", Path: "/services/:id/variants", Tag: "services", Summary: "Add a variant", Auth: true,
+		Body: models.ServiceOption{}, Status: http.StatusCreated, Response: models.ServiceOption{}},
+		Legacy: openapi.Fields{"message": "", "option": models.ServiceOption{}}},
+	{Op: openapi.Op{Method: "PUT", Path: "/services/:id/variants/:optionId", Tag: "services", Summary: "Update a variant", Auth: true,
+		Body: models.ServiceOption{}, Response: models.ServiceOption{}},
+		Legacy: openapi.Fields{"message": "", "option": models.ServiceOption{}}},
+	{Op: openapi.Op{Method: "DELETE", Path: "/services/:id/variants/:optionId", Tag: "services", Summary: "Delete a variant", Auth: true},
+		Legacy: message},
+	{Op: openapi.Op{Method: "POST", Path: "/services/:id/addons", Tag: "services", Summary: "Add an add-on", Auth: true,
+		Body: models.ServiceOption{}, Status: http.StatusCreated, Response: models.ServiceOption{}},
+		Legacy: openapi.Fields{"message": "", "option": models.ServiceOption{}}},
+	{Op: openapi.Op{Method: "PUT", Path: "/services/:id/addons/:optionId", Tag: "services", Summary: "Update an add-on", Auth: true,
+		Body: models.ServiceOption{}, Response: models.ServiceOption{}},
+		Legacy: openapi.Fields{"message": "", "option": models.ServiceOption{}}},
+	{Op: openapi.Op{Method: "DELETE", Path: "/services/:id/addons/:optionId", Tag: "services", Summary: "Delete an add-on", Auth: true},
+		Legacy: message},
+
+	// Schedule
+	{Op: openapi.Op{Method: "GET", Path: "/schedule/:alias/:date", Tag: "schedule", Summary: "Get a provider's free time on a date",
+		Response: []models.TimeRange{}},
+		Legacy: openapi.Fields{"ranges": []models.TimeRange{}}},
+	{Op: openapi.Op{Method: "GET", Path: "/schedule/me", Tag: "schedule", Summary: "Get your free time for the coming days, keyed by date", Auth: true,
+		Query:    []openapi.Parameter{{Name: "days", Description: "number of days from today, default 1", Schema: &openapi.Schema{Type: "integer"}}},
+		Response: models.ScheduleByDate{}},
+		Legacy: openapi.Fields{"start": "", "days": 0, "ranges": models.ScheduleByDate{}}},
+	{Op: openapi.Op{Method: "GET", Path: "/schedule/me/:date", Tag: "schedule", Summary: "Get your free time on a date", Auth: true,
+		Response: []models.TimeRange{}},
+		Legacy: openapi.Fields{"date": "", "ranges": []models.TimeRange{}}},
+	{Op: openapi.Op{Method: "POST", Path: "/schedule/me/:date", Tag: "schedule", Summary: "Replace your free time on a date", Auth: true,
+		Body: []models.TimeRangePayload{}, Response: []models.TimeRange{}},
+		Legacy: openapi.Fields{"message": "", "date": "", "ranges": []models.TimeRange{}}},
+
+	// Booking
+	{Op: openapi.Op{Method: "POST", Path: "/holds/:alias", Tag: "booking", Summary: "Hold a slot while the client completes the booking",
+		Body: slotHoldRequest{}, Status: http.StatusCreated, Response: models.SlotHold{}},
+		Legacy: openapi.Fields{"message": "", "hold": models.SlotHold{}}},
+	{Op: openapi.Op{Method: "DELETE", Path: "/holds/:alias/:id", Tag: "booking", Summary: "Release a slot hold",
+		Query: []openapi.Parameter{{Name: "token", Required: true}}},
+		Legacy: message},
+	{Op: openapi.Op{Method: "GET", Path: "/captcha/:alias", Tag: "booking", Summary: "Get the CAPTCHA the booking page must show, if any",
+		Response: captchaSettings{}},
+		Legacy: openapi.Fields{"captcha": captchaSettings{}}},
+	{Op: openapi.Op{Method: "POST", Path: "/appointments/:alias", Tag: "booking", Summary: "Book an appointment",
+		Body: bookingRequest{}, Status: http.StatusCreated, Response: bookingResult{}},
+		Legacy: openapi.Fields{"message": "", "appointment": models.Appointment{}, "payment": models.Payment{}}},
+	{Op: openapi.Op{Method: "POST", Path: "/appointments/:alias/:id/cancel", Tag: "booking", Summary: "Cancel a booking with its cancel token",
+		Body: openapi.Fields{"token": ""}, Response: openapi.Fields{"refunded": false}},
+		Legacy: openapi.Fields{"message": "", "refunded": false}},
+	{Op: openapi.Op{Method: "POST", Path: "/waitlist/:alias", Tag: "booking", Summary: "Join a provider's waitlist",
+		Body: models.WaitlistEntry{}, Status: http.StatusCreated, Response: models.WaitlistEntry{}},
+		Legacy: openapi.Fields{"message": "", "entry": models.WaitlistEntry{}}},
+	{Op: openapi.Op{Method: "DELETE", Path: "/waitlist/:alias/:id", Tag: "booking", Summary: "Leave a waitlist",
+		Query: []openapi.Parameter{{Name: "token", Required: true}}},
+		Legacy: message},
+	{Op: openapi.Op{Method: "POST", Path: "/waitlist/:alias/:id/claim", Tag: "booking", Summary: "Book the slot offered to a waitlisted client",
+		Body: openapi.Fields{"token": ""}, Status: http.StatusCreated, Response: bookingResult{}},
+		Legacy: openapi.Fields{"message": "", "appointment": models.Appointment{}, "payment": models.Payment{}}},
+
+	// Appointments
+	{Op: openapi.Op{Method: "GET", Path: "/appointments", Tag: "appointments", Summary: "List your appointments", Auth: true,
+		Query: []openapi.Parameter{
+			{Name: "from", Description: "earliest date, YYYY-MM-DD"},
+			{Name: "to", Description: "latest date, YYYY-MM-DD"},
+			{Name: "status", Schema: &openapi.Schema{Type: "string", Enum: []string{"confirmed", "pending_payment", "expired"}}},
+			{Name: "clientId", Schema: &openapi.Schema{Type: "integer"}},
+		},
+		Response: []models.Appointment{}},
+		Legacy: openapi.Fields{"appointments": []models.Appointment{}}, Page: &models.AppointmentKeyset},
+	{Op: openapi.Op{Method: "DELETE", Path: "/appointments/:id", Tag: "appointments", Summary: "Cancel an appointment and refund its deposit", Auth: true},
+		Legacy: message},
+	{Op: openapi.Op{Method: "PUT", Path: "/appointments/:id/no-show", Tag: "appointments", Summary: "Mark whether the client turned up", Auth: true,
+		Body: openapi.Fields{"noShow": false}},
+		Legacy: openapi.Fields{"message": "", "noShow": false}},
+	{Op: openapi.Op{Method: "GET", Path: "/waitlist", Tag: "appointments", Summary: "List your waitlist", Auth: true,
+		Response: []models.WaitlistEntry{}},
+		Legacy: openapi.Fields{"entries": []models.WaitlistEntry{}}},
+
+	// Clients
+	{Op: openapi.Op{Method: "GET", Path: "/clients", Tag: "clients", Summary: "List your clients", Auth: true,
+		Response: []models.ClientSummary{}},
+		Legacy: openapi.Fields{"clients": []models.ClientSummary{}}, Page: &models.ClientKeyset},
+	{Op: openapi.Op{Method: "GET", Path: "/clients/:id", Tag: "clients", Summary: "Get a client with their history", Auth: true,
+		Response: models.ClientDetail{}},
+		Legacy: openapi.Fields{"client": models.ClientDetail{}}},
+	{Op: openapi.Op{Method: "PUT", Path: "/clients/:id", Tag: "clients", Summary: "Update a client's details, notes and tags", Auth: true,
+		Body: models.Client{}, Response: models.Client{}},
+		Legacy: openapi.Fields{"message": "", "client": models.Client{}}},
+	{Op: openapi.Op{Method: "POST", Path: "/clients/:id/merge", Tag: "clients", Summary: "Merge another client into this one", Auth: true,
+		Body: openapi.Fields{"sourceId": int64(0)}, Response: models.ClientDetail{}},
+		Legacy: openapi.Fields{"message": "", "client": models.ClientDetail{}}},
+	{Op: openapi.Op{Method: "GET", Path: "/blocklist", Tag: "clients", Summary: "List blocked clients", Auth: true,
+		Response: []models.BlockEntry{}},
+		Legacy: openapi.Fields{"entries": []models.BlockEntry{}}},
+	{Op: openapi.Op{Method: "POST", Path: "/blocklist", Tag: "clients", Summary: "Block a client", Auth: true,
+		Body: models.BlockEntry{}, Status: http.StatusCreated, Response: models.BlockEntry{}},
+		Legacy: openapi.Fields{"message": "", "entry": models.BlockEntry{}}},
+	{Op: openapi.Op{Method: "DELETE", Path: "/blocklist/:id", Tag: "clients", Summary: "Unblock a client", Auth: true},
+		Legacy: message},
+	{Op: openapi.Op{Method: "GET", Path: "/booking-rules", Tag: "clients", Summary: "Get your booking rules", Auth: true,
+		Response: models.BookingRules{}},
+		Legacy: openapi.Fields{"rules": models.BookingRules{}}},
+	{Op: openapi.Op{Method: "PUT", Path: "/booking-rules", Tag: "clients", Summary: "Save your booking rules", Auth: true,
+		Body: models.BookingRules{}, Response: models.BookingRules{}},
+		Legacy: openapi.Fields{"message": "", "rules": models.BookingRules{}}},
+
+	// Payments
+	{Op: openapi.Op{Method: "POST", Path: "/payments/webhook", Tag: "payments", Summary: "Payment gateway webhook; the body is the gateway's signed event"},
+		Legacy: openapi.Fields{"received": true}},
+	{Op: openapi.Op{Method: "GET", Path: "/payments/settings", Tag: "payments", Summary: "Get your deposit settings", Auth: true,
+		Response: openapi.Fields{"settings": models.PaymentSettings{}, "enabled": false}},
+		Legacy: openapi.Fields{"settings": models.PaymentSettings{}, "enabled": false}},
+	{Op: openapi.Op{Method: "PUT", Path: "/payments/settings", Tag: "payments", Summary: "Save your deposit settings", Auth: true,
+		Body: models.PaymentSettings{}, Response: openapi.Fields{"settings": models.PaymentSettings{}, "enabled": false}},
+		Legacy: openapi.Fields{"message": "", "settings": models.PaymentSettings{}}},
+}
+
+// apiSpec builds the OpenAPI document once, on first use
+var apiSpec = sync.OnceValue(func() *openapi.Document {
+	b := openapi.New(openapi.Info{
+		Title:   "Booking API",
+		Version: "1.0.0",
+		Description: "Errors are returned as RFC 7807 problem details with a stable `code`. " +
+			"Requests are rate limited: responses carry `RateLimit-*` headers, and a 429 `rate_limited` problem comes with `Retry-After`.",
+	})
+	b.Override(models.Decimal(""), &openapi.Schema{Type: "number", Description: "amount in major currency units, e.g. 12.50"})
+	b.Override(models.Money{}, &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"amount":   {Type: "number", Description: "amount in major currency units, e.g. 12.50"},
+			"currency": {Type: "string", Description: "ISO 4217 code"},
+		},
+	})
+	b.Security("token", &openapi.SecurityScheme{
+		Type:        "apiKey",
+		In:          "header",
+		Name:        "Authorization",
+		Description: "access token from /api/auth/login",
+	})
+	b.Problem(middlewares.Problem{})
+	b.Add(systemOperations...)
+	for _, op := range apiOperations {
+		v1 := op.Op
+		v1.Path = "/api/v1" + op.Path
+		if op.Page != nil {
+			v1.Query = append(append([]openapi.Parameter{}, op.Query...), pageParameters(op.Page)...)
+			v1.Response = openapi.Fields{"data": op.Response, "meta": pagination.Meta{}}
+		} else if op.Response != nil {
+			v1.Response = openapi.Fields{"data": op.Response}
+		} else if op.Status != http.StatusTemporaryRedirect {
+			v1.Status = http.StatusNoContent
+		}
+
+		legacy := op.Op
+		legacy.Path = "/api" + op.Path
+		legacy.Response = op.Legacy
+		if op.Page != nil {
+			legacy.Query = v1.Query
+		}
+		legacy.Deprecated = true
+		b.Add(v1, legacy)
+	}
+	return b.Document()
+})
+
+func getOpenAPISpec(c *gin.Context) {
+	c.JSON(http.StatusOK, apiSpec())
+}
+
+func getAPIDocs(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(apiDocsPage))
+}
+
+const apiDocsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Booking API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "openapi.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`
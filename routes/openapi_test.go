@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"example.com/models"
+	"example.com/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+func registeredRoutes(t *testing.T) map[string]bool {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	RegisterRoutes(server, NewHandlers(models.NewMemoryRepositories(), nil))
+
+	routes := map[string]bool{}
+	for _, route := range server.Routes() {
+		path, _ := openapi.Path(route.Path)
+		routes[strings.ToLower(route.Method)+" "+path] = true
+	}
+	return routes
+}
+
+func TestOpenAPICoversEveryRoute(t *testing.T) {
+	spec := apiSpec()
+	for route := range registeredRoutes(t) {
+		method, path, _ := strings.Cut(route, " ")
+		if spec.Paths[path][method] == nil {
+			t.Errorf("%s %s is registered but missing from the OpenAPI document", strings.ToUpper(method), path)
+		}
+	}
+}
+
+func TestOpenAPIHasNoStaleRoutes(t *testing.T) {
+	routes := registeredRoutes(t)
+	for path, item := range apiSpec().Paths {
+		for method := range item {
+			if !routes[method+" "+path] {
+				t.Errorf("%s %s is documented but not registered", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestOpenAPIReferencesResolve(t *testing.T) {
+	spec := apiSpec()
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatalf("marshal document: %v", err)
+	}
+
+	refs := regexp.MustCompile(`"\$ref":"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(string(raw), -1)
+	if len(refs) == 0 {
+		t.Fatal("document has no schema references")
+	}
+	for _, ref := range refs {
+		if _, ok := spec.Components.Schemas[ref[1]]; !ok {
+			t.Errorf("schema %q is referenced but not defined", ref[1])
+		}
+	}
+}
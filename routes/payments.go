@@ -0,0 +1,195 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"example.com/config"
+	"example.com/logging"
+	"example.com/metrics"
+	"example.com/models"
+	"example.com/payments"
+	"github.com/gin-gonic/gin"
+)
+
+// startCheckout opens a hosted checkout for the deposit of a pending appointment
+func (h *Handlers) startCheckout(c *gin.Context, alias string, appt *models.Appointment, deposit models.Money) (*models.Payment, error) {
+	returnURL := fmt.Sprintf("%s/booking/%s/payment?appointment=%s", config.FrontendURL, url.PathEscape(alias), url.QueryEscape(appt.ID))
+	checkout, err := payments.Default.CreateCheckout(c.Request.Context(), payments.CheckoutRequest{
+		AppointmentID: appt.ID,
+		Amount:        deposit.Amount,
+		Currency:      deposit.Currency,
+		Description:   fmt.Sprintf("Booking deposit %s %s", appt.Date, appt.StartTime),
+		CustomerEmail: appt.Email,
+		SuccessURL:    returnURL + "&status=success",
+		CancelURL:     returnURL + "&status=cancelled",
+		ExpiresAt:     *appt.HoldExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payment := &models.Payment{
+		AppointmentID: appt.ID,
+		UserID:        appt.UserID,
+		Gateway:       payments.Default.Name(),
+		CheckoutID:    checkout.ID,
+		CheckoutURL:   checkout.URL,
+		Amount:        deposit,
+	}
+	if err := h.repos.Payments.Create(c.Request.Context(), payment); err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// refundDeposit refunds a payment the cancellation left refund_due, if
+// any. The cancellation stands when the gateway fails; the sweeper in main
+// retries the refund.
+func (h *Handlers) refundDeposit(c *gin.Context, due *models.Payment) {
+	if due == nil {
+		return
+	}
+	if err := payments.RefundDue(c.Request.Context(), h.repos.Payments, due); err != nil {
+		logging.FromContext(c.Request.Context()).WithError(err).WithField("paymentId", due.ID).
+			Error("failed to refund deposit, will retry")
+	}
+}
+
+func (h *Handlers) paymentWebhook(c *gin.Context) {
+	if payments.Default == nil {
+		c.Error(models.NotFound("payments_disabled", "online payments are disabled"))
+		return
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		c.Error(errInvalidBody.Wrap(err))
+		return
+	}
+
+	event, err := payments.Default.ParseWebhook(payload, c.Request.Header)
+	if err != nil {
+		if errors.Is(err, payments.ErrInvalidSignature) {
+			c.Error(models.Unauthorized("invalid_signature", "webhook signature is invalid"))
+			return
+		}
+		c.Error(models.Invalid("invalid_webhook", "webhook payload could not be parsed").Wrap(err))
+		return
+	}
+
+	ctx := c.Request.Context()
+	switch event.Type {
+	case payments.EventPaymentSucceeded:
+		var payment *models.Payment
+		payment, _, err = h.repos.Payments.Confirm(ctx, event.CheckoutID, event.PaymentID)
+		// When the hold ran out before the money arrived, the slot may be gone
+		// and the payment was left refund_due. Refund it, on redeliveries too,
+		// and fail the webhook if that fails so the gateway sends it again.
+		if err == nil && payment.Status == models.PaymentRefundDue {
+			if err = payments.RefundDue(ctx, h.repos.Payments, payment); err != nil {
+				err = errPaymentGateway.Wrap(err)
+			}
+		}
+	case payments.EventPaymentFailed:
+		err = h.repos.Payments.Fail(ctx, event.CheckoutID, models.PaymentFailed)
+	case payments.EventCheckoutExpired:
+		err = h.repos.Payments.Fail(ctx, event.CheckoutID, models.PaymentExpired)
+	}
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, nil, gin.H{"received": true})
+}
+
+func (h *Handlers) getPaymentSettings(c *gin.Context) {
+	settings, err := h.repos.Payments.GetSettings(c.Request.Context(), c.GetInt64("userId"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	body := gin.H{"settings": settings, "enabled": payments.Default != nil}
+	respond(c, http.StatusOK, body, body)
+}
+
+func (h *Handlers) savePaymentSettings(c *gin.Context) {
+	var settings models.PaymentSettings
+	if !bindJSON(c, &settings) {
+		return
+	}
+
+	err := h.repos.Payments.SaveSettings(c.Request.Context(), c.GetInt64("userId"), settings)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{"settings": settings, "enabled": payments.Default != nil},
+		gin.H{"message": "payment settings saved", "settings": settings})
+}
+
+// cancelAppointmentByClient lets a client cancel with the token returned at booking,
+// up until the appointment starts.
+// The deposit is refunded when cancelling at least refundWindowHours before the start.
+// The refund is recorded as due along with the cancellation, then issued.
+func (h *Handlers) cancelAppointmentByClient(c *gin.Context) {
+	user, err := h.repos.Users.GetByAlias(c.Request.Context(), c.Param("alias"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var body struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	appt, err := h.repos.Appointments.GetForClient(ctx, c.Param("id"), user.ID, body.Token)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if err := appt.CheckClientCancel(); err != nil {
+		c.Error(err)
+		return
+	}
+
+	settings, err := h.repos.Payments.GetSettings(ctx, user.ID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	startsAt, err := appt.StartsAt()
+	refundable := err == nil && time.Until(startsAt) >= time.Duration(settings.RefundWindowHours)*time.Hour
+
+	var due *models.Payment
+	err = h.repos.InTx(ctx, func(tx models.Repositories) error {
+		if refundable {
+			var err error
+			if due, err = tx.Payments.MarkRefundDue(ctx, appt.ID, user.ID); err != nil {
+				return err
+			}
+		}
+		return tx.Appointments.Delete(ctx, appt.ID, user.ID)
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	metrics.AppointmentsCancelled.WithLabelValues("client").Inc()
+	h.offerFreedSlots(c)
+	h.refundDeposit(c, due)
+	refunded := due != nil
+
+	respond(c, http.StatusOK, gin.H{"refunded": refunded}, gin.H{"message": "appointment cancelled", "refunded": refunded})
+}
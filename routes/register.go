@@ -2,51 +2,44 @@ package routes
 
 import (
 	"net/http"
-	"strconv"
 
-	"example.com/models"
 	"github.com/gin-gonic/gin"
 )
 
-func registerEvent(context *gin.Context) {
+func (h *Handlers) registerEvent(context *gin.Context) {
 	userId := context.GetInt64("userId")
-	eventId, err := strconv.ParseInt(context.Param("id"), 10, 64)
-	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Could not parse id: " + err.Error()})
+	eventId, ok := paramID(context, "id")
+	if !ok {
 		return
 	}
 
-	event, err := models.GetEventById(eventId)
+	event, err := h.repos.Events.GetByID(context.Request.Context(), eventId)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch event"})
+		context.Error(err)
 		return
 	}
 
-	err = event.Register(userId)
+	err = h.repos.Events.Register(context.Request.Context(), event.ID, userId)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Could not register event"})
+		context.Error(err)
 		return
 	}
 
-	context.JSON(http.StatusCreated, gin.H{"message": "Registered!"})
+	respond(context, http.StatusCreated, nil, gin.H{"message": "Registered!"})
 }
 
-func unregisterEvent(context *gin.Context) {
+func (h *Handlers) unregisterEvent(context *gin.Context) {
 	userId := context.GetInt64("userId")
-	eventId, err := strconv.ParseInt(context.Param("id"), 10, 64)
-	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Could not parse id: " + err.Error()})
+	eventId, ok := paramID(context, "id")
+	if !ok {
 		return
 	}
 
-	var event models.Event
-	event.ID = eventId
-
-	err = event.Unregister(userId)
+	err := h.repos.Events.Unregister(context.Request.Context(), eventId, userId)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Could not unregister event"})
+		context.Error(err)
 		return
 	}
 
-	context.JSON(http.StatusOK, gin.H{"message": "Unregistered!"})
+	respond(context, http.StatusOK, nil, gin.H{"message": "Unregistered!"})
 }
@@ -0,0 +1,72 @@
+package routes
+
+import (
+	"net/http"
+
+	"example.com/models"
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handlers) getBlocklist(c *gin.Context) {
+	entries, err := h.repos.Restrictions.ListBlocks(c.Request.Context(), c.GetInt64("userId"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if entries == nil {
+		entries = []models.BlockEntry{}
+	}
+	respond(c, http.StatusOK, entries, gin.H{"entries": entries})
+}
+
+func (h *Handlers) addToBlocklist(c *gin.Context) {
+	var entry models.BlockEntry
+	if !bindJSON(c, &entry) {
+		return
+	}
+	entry.UserID = c.GetInt64("userId")
+
+	err := h.repos.Restrictions.CreateBlock(c.Request.Context(), &entry)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	respond(c, http.StatusCreated, entry, gin.H{"message": "added to blocklist", "entry": entry})
+}
+
+func (h *Handlers) removeFromBlocklist(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	err := h.repos.Restrictions.DeleteBlock(c.Request.Context(), id, c.GetInt64("userId"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	respond(c, http.StatusOK, nil, gin.H{"message": "removed from blocklist"})
+}
+
+func (h *Handlers) getBookingRules(c *gin.Context) {
+	rules, err := h.repos.Restrictions.GetRules(c.Request.Context(), c.GetInt64("userId"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	respond(c, http.StatusOK, rules, gin.H{"rules": rules})
+}
+
+func (h *Handlers) saveBookingRules(c *gin.Context) {
+	var rules models.BookingRules
+	if !bindJSON(c, &rules) {
+		return
+	}
+
+	err := h.repos.Restrictions.SaveRules(c.Request.Context(), c.GetInt64("userId"), rules)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	respond(c, http.StatusOK, rules, gin.H{"message": "booking rules saved", "rules": rules})
+}
@@ -1,67 +1,150 @@
 package routes
 
 import (
+	"net/http"
+
 	"example.com/middlewares"
+	"example.com/models"
+	"example.com/ratelimit"
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(server *gin.Engine) {
-	// Health check endpoint
+// Handlers serves the endpoints backed by the repositories it was constructed with
+type Handlers struct {
+	repos   models.Repositories
+	limiter *ratelimit.Limiter
+}
+
+// NewHandlers builds the handlers. limiter may be nil to turn rate limiting
+// off.
+func NewHandlers(repos models.Repositories, limiter *ratelimit.Limiter) *Handlers {
+	return &Handlers{repos: repos, limiter: limiter}
+}
+
+func RegisterRoutes(server *gin.Engine, h *Handlers) {
+	// Liveness: the process is up, whether or not it can serve requests yet
 	server.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
+	server.GET("/ready", h.ready)
 
 	api := server.Group("/api")
-	api.GET("/events", getEvents)
-	api.GET("/events/:id", getEvent)
-	api.GET("/services/:alias", getServicesByAlias)
-	api.GET("/schedule/:alias/:date", getScheduleByAliasForDate)
-	api.POST("/appointments/:alias", createAppointment)
+	api.GET("/openapi.json", getOpenAPISpec)
+	api.GET("/docs", getAPIDocs)
+
+	h.registerAPI(api.Group("/v1", withAPIVersion(apiV1)))
+	// The unversioned routes predate /api/v1 and are kept until legacySunset
+	h.registerAPI(api.Group("", withAPIVersion(apiLegacy), deprecatedAPI))
+}
+
+// ready reports whether the server can serve requests: the database is
+// reachable and its tables exist
+func (h *Handlers) ready(c *gin.Context) {
+	if err := h.repos.Ping(c.Request.Context()); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// registerAPI mounts every endpoint on a versioned group. Handlers render
+// their version's envelope through respond.
+func (h *Handlers) registerAPI(api *gin.RouterGroup) {
+	api.POST("/payments/webhook", h.paymentWebhook)
+
+	// Public reads, limited per client
+	public := api.Group("", h.limiter.Limit("public", ratelimit.ByIP))
+	public.GET("/events", h.getEvents)
+	public.GET("/events/:id", h.getEvent)
+	public.GET("/services/:alias", h.getServicesByAlias)
+	public.GET("/schedule/:alias/:date", h.getScheduleByAliasForDate)
+	public.GET("/captcha/:alias", h.getCaptchaSettings)
+
+	// Public writes, limited per client, with a much higher ceiling per
+	// provider that only a flood from many clients reaches
+	booking := api.Group("",
+		h.limiter.Limit("booking", ratelimit.ByIP),
+		h.limiter.Limit("provider", ratelimit.ByParam("alias")))
+	booking.POST("/appointments/:alias", h.createAppointment)
+	booking.POST("/appointments/:alias/:id/cancel", h.cancelAppointmentByClient)
+	booking.POST("/holds/:alias", h.createSlotHold)
+	booking.DELETE("/holds/:alias/:id", h.releaseSlotHold)
+	booking.POST("/waitlist/:alias", h.joinWaitlist)
+	booking.DELETE("/waitlist/:alias/:id", h.leaveWaitlist)
+	booking.POST("/waitlist/:alias/:id/claim", h.claimWaitlistOffer)
 
 	auth := api.Group("/auth")
-	auth.POST("/signup", signup)
-	auth.POST("/login", login)
-	auth.POST("/refresh", refresh)
+	credentials := auth.Group("", h.limiter.Limit("auth", ratelimit.ByIP))
+	credentials.POST("/signup", h.signup)
+	credentials.POST("/login", h.login)
+	credentials.POST("/refresh", refresh)
 
 	// OAuth routes (web browser redirect flow)
 	auth.GET("/google", googleLogin)
-	auth.GET("/google/callback", googleCallback)
+	auth.GET("/google/callback", h.googleCallback)
 	auth.GET("/facebook", facebookLogin)
-	auth.GET("/facebook/callback", facebookCallback)
+	auth.GET("/facebook/callback", h.facebookCallback)
 
 	// OAuth routes (mobile token flow)
-	auth.POST("/google/token", googleTokenLogin)
-	auth.POST("/facebook/token", facebookTokenLogin)
-
-	authenticated := api.Group("/")
-	authenticated.Use(middlewares.Authenticate)
-	authenticated.POST("/events", createEvent)
-	authenticated.PUT("/events/:id", updateEvent)
-	authenticated.DELETE("/events/:id", deleteEvent)
-	authenticated.POST("/events/:id/register", registerEvent)
-	authenticated.DELETE("/events/:id/register", unregisterEvent)
-
-	authenticated.GET("/services", getServicesForUser)
-	authenticated.POST("/services", createService)
-	authenticated.PATCH("/services/:id/add-media", addServiceMedia)
-	authenticated.DELETE("/services/:id/delete-media/:mediaId", deleteServiceMedia)
-	authenticated.PATCH("/services/:id/update-media-order", updateMediaOrder)
-	authenticated.PUT("/services/:id", editService)
-	authenticated.DELETE("/services/:id", deleteService)
-
-	// authenticated.GET("/cloudinary-signature", cloud.GetCloudinarySignature)
-	// authenticated.POST("/upload", cloud.UploadHandler)
+	credentials.POST("/google/token", h.googleTokenLogin)
+	credentials.POST("/facebook/token", h.facebookTokenLogin)
+
+	authenticated := api.Group("")
+	authenticated.Use(middlewares.Authenticate, h.limiter.Limit("api", ratelimit.ByUser))
+	authenticated.POST("/events", h.createEvent)
+	authenticated.PUT("/events/:id", h.updateEvent)
+	authenticated.DELETE("/events/:id", h.deleteEvent)
+	authenticated.POST("/events/:id/register", h.registerEvent)
+	authenticated.DELETE("/events/:id/register", h.unregisterEvent)
+
+	authenticated.GET("/services", h.getServicesForUser)
+	authenticated.POST("/services", h.createService)
+	authenticated.PATCH("/services/:id/add-media", h.addServiceMedia)
+	authenticated.DELETE("/services/:id/delete-media/:mediaId", h.deleteServiceMedia)
+	authenticated.PATCH("/services/:id/update-media-order", h.updateMediaOrder)
+	authenticated.PUT("/services/:id", h.editService)
+	authenticated.DELETE("/services/:id", h.deleteService)
+
+	// Service variants and add-ons (authenticated)
+	authenticated.POST("/services/:id/variants", h.createServiceOption(models.OptionVariant))
+	authenticated.PUT("/services/:id/variants/:optionId", h.updateServiceOption(models.OptionVariant))
+	authenticated.DELETE("/services/:id/variants/:optionId", h.deleteServiceOption(models.OptionVariant))
+	authenticated.POST("/services/:id/addons", h.createServiceOption(models.OptionAddOn))
+	authenticated.PUT("/services/:id/addons/:optionId", h.updateServiceOption(models.OptionAddOn))
+	authenticated.DELETE("/services/:id/addons/:optionId", h.deleteServiceOption(models.OptionAddOn))
 
 	// User's own schedule endpoints (authenticated)
-	authenticated.GET("/schedule/me", getSchedule)
-	authenticated.GET("/schedule/me/:date", getScheduleForDate)
-	authenticated.POST("/schedule/me/:date", saveSchedule)
+	authenticated.GET("/schedule/me", h.getSchedule)
+	authenticated.GET("/schedule/me/:date", h.getScheduleForDate)
+	authenticated.POST("/schedule/me/:date", h.saveSchedule)
 
 	// Appointments (authenticated)
-	authenticated.GET("/appointments", getAppointments)
-	authenticated.DELETE("/appointments/:id", deleteAppointment)
+	authenticated.GET("/appointments", h.getAppointments)
+	authenticated.DELETE("/appointments/:id", h.deleteAppointment)
+	authenticated.PUT("/appointments/:id/no-show", h.markNoShow)
+
+	// Clients (authenticated)
+	authenticated.GET("/clients", h.getClients)
+	authenticated.GET("/clients/:id", h.getClient)
+	authenticated.PUT("/clients/:id", h.updateClient)
+	authenticated.POST("/clients/:id/merge", h.mergeClient)
+
+	// Waitlist (authenticated)
+	authenticated.GET("/waitlist", h.getWaitlist)
+
+	// Blocklist and booking rules (authenticated)
+	authenticated.GET("/blocklist", h.getBlocklist)
+	authenticated.POST("/blocklist", h.addToBlocklist)
+	authenticated.DELETE("/blocklist/:id", h.removeFromBlocklist)
+	authenticated.GET("/booking-rules", h.getBookingRules)
+	authenticated.PUT("/booking-rules", h.saveBookingRules)
+
+	// Deposit settings (authenticated)
+	authenticated.GET("/payments/settings", h.getPaymentSettings)
+	authenticated.PUT("/payments/settings", h.savePaymentSettings)
 
 	// Alias management (authenticated)
-	authenticated.GET("/alias", getAlias)
-	authenticated.PUT("/alias", updateAlias)
+	authenticated.GET("/alias", h.getAlias)
+	authenticated.PUT("/alias", h.updateAlias)
 }
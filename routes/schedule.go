@@ -3,13 +3,12 @@ package routes
 import (
 	"net/http"
 	"strconv"
-	"time"
 
 	"example.com/models"
 	"github.com/gin-gonic/gin"
 )
 
-func getSchedule(c *gin.Context) {
+func (h *Handlers) getSchedule(c *gin.Context) {
 	userID := c.GetInt64("userId")
 
 	// Parse `days` from query param, default = 1
@@ -21,87 +20,83 @@ func getSchedule(c *gin.Context) {
 		}
 	}
 
-	start := time.Now().UTC() // still UTC, adjust if you store tz
+	start := models.Today()
 
-	out, err := models.GetScheduleForRange(c.Request.Context(), userID, start, days)
+	out, err := h.repos.Schedules.GetRange(c.Request.Context(), userID, start, days)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "server error: " + err.Error()})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	respond(c, http.StatusOK, out, gin.H{
 		"start":  start.Format("2006-01-02"),
 		"days":   days,
 		"ranges": out, // map[date][]TimeRange
 	})
 }
 
-func getScheduleForDate(c *gin.Context) {
+func (h *Handlers) getScheduleForDate(c *gin.Context) {
 	userID := c.GetInt64("userId")
 	dateStr := c.Param("date") // expect /schedule/:date (YYYY-MM-DD)
-	date, err := time.Parse("2006-01-02", dateStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid date (use YYYY-MM-DD)"})
+	date, ok := paramDate(c, "date")
+	if !ok {
 		return
 	}
 
-	out, err := models.GetSchedule(c.Request.Context(), userID, date)
+	out, err := h.repos.Schedules.Get(c.Request.Context(), userID, date)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "server error: " + err.Error()})
+		c.Error(err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{
+	respond(c, http.StatusOK, out, gin.H{
 		"date":   dateStr,
 		"ranges": out,
 	})
 }
 
-func getScheduleByAliasForDate(c *gin.Context) {
+func (h *Handlers) getScheduleByAliasForDate(c *gin.Context) {
 	alias := c.Param("alias")
 
-	user, err := models.GetUserByAlias(alias)
+	user, err := h.repos.Users.GetByAlias(c.Request.Context(), alias)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"message": "user not found"})
+		c.Error(err)
 		return
 	}
 
-	dateStr := c.Param("date")
-	date, err := time.Parse("2006-01-02", dateStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid date (use YYYY-MM-DD)"})
+	date, ok := paramDate(c, "date")
+	if !ok {
 		return
 	}
 
-	out, err := models.GetSchedule(c.Request.Context(), user.ID, date)
+	out, err := h.repos.Schedules.Get(c.Request.Context(), user.ID, date)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "server error: " + err.Error()})
+		c.Error(err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"ranges": out})
+	respond(c, http.StatusOK, out, gin.H{"ranges": out})
 }
 
-func saveSchedule(c *gin.Context) {
+func (h *Handlers) saveSchedule(c *gin.Context) {
 	userID := c.GetInt64("userId")
 	dateStr := c.Param("date") // expect /schedule/:date
-	date, err := time.Parse("2006-01-02", dateStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid date (use YYYY-MM-DD)"})
+	date, ok := paramDate(c, "date")
+	if !ok {
 		return
 	}
 
 	var payload []models.TimeRangePayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid request body: " + err.Error()})
+	if !bindJSON(c, &payload) {
 		return
 	}
 
-	inserted, err := models.SaveSchedule(c.Request.Context(), userID, date, payload)
+	inserted, err := h.repos.Schedules.Save(c.Request.Context(), userID, date, payload)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()}) // validation errors included
+		c.Error(err)
 		return
 	}
+	h.offerFreedSlots(c)
 
-	c.JSON(http.StatusOK, gin.H{
+	respond(c, http.StatusOK, inserted, gin.H{
 		"message": "schedule saved",
 		"date":    dateStr,
 		"ranges":  inserted,
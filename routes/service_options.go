@@ -0,0 +1,80 @@
+package routes
+
+import (
+	"net/http"
+
+	"example.com/models"
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handlers) createServiceOption(kind models.OptionKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serviceID, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+
+		var option models.ServiceOption
+		if !bindJSON(c, &option) {
+			return
+		}
+		option.ServiceID = serviceID
+
+		err := h.repos.Services.CreateOption(c.Request.Context(), kind, &option, c.GetInt64("userId"))
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		respond(c, http.StatusCreated, option, gin.H{"message": string(kind) + " created", "option": option})
+	}
+}
+
+func (h *Handlers) updateServiceOption(kind models.OptionKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serviceID, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+		optionID, ok := paramID(c, "optionId")
+		if !ok {
+			return
+		}
+
+		var option models.ServiceOption
+		if !bindJSON(c, &option) {
+			return
+		}
+		option.ID = optionID
+		option.ServiceID = serviceID
+
+		err := h.repos.Services.UpdateOption(c.Request.Context(), kind, &option, c.GetInt64("userId"))
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		respond(c, http.StatusOK, option, gin.H{"message": string(kind) + " updated", "option": option})
+	}
+}
+
+func (h *Handlers) deleteServiceOption(kind models.OptionKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serviceID, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+		optionID, ok := paramID(c, "optionId")
+		if !ok {
+			return
+		}
+
+		err := h.repos.Services.DeleteOption(c.Request.Context(), kind, serviceID, optionID, c.GetInt64("userId"))
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		respond(c, http.StatusOK, nil, gin.H{"message": string(kind) + " deleted"})
+	}
+}
@@ -1,202 +1,298 @@
 package routes
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"example.com/cloud"
+	"example.com/logging"
 	"example.com/models"
-
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 )
 
-func getServicesForUser(context *gin.Context) {
+func (h *Handlers) getServicesForUser(context *gin.Context) {
 	userId := context.GetInt64("userId")
-	services, err := models.GetServicesForUser(userId)
+	page, ok := pageRequest(context, models.ServiceKeyset)
+	if !ok {
+		return
+	}
+
+	services, meta, err := h.repos.Services.List(context.Request.Context(), userId, page)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Server error: " + err.Error()})
+		context.Error(err)
 		return
 	}
-	context.JSON(http.StatusOK, services)
+	if services == nil {
+		services = []models.Service{}
+	}
+	respondPage(context, services, meta, services)
 }
 
-func getServicesByAlias(c *gin.Context) {
+func (h *Handlers) getServicesByAlias(c *gin.Context) {
 	alias := c.Param("alias")
+	page, ok := pageRequest(c, models.ServiceKeyset)
+	if !ok {
+		return
+	}
 
-	user, err := models.GetUserByAlias(alias)
+	user, err := h.repos.Users.GetByAlias(c.Request.Context(), alias)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"message": "user not found"})
+		c.Error(err)
 		return
 	}
 
-	services, err := models.GetServicesForUser(user.ID)
+	services, meta, err := h.repos.Services.List(c.Request.Context(), user.ID, page)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch services: " + err.Error()})
+		c.Error(err)
 		return
 	}
-	c.JSON(http.StatusOK, services)
+	if services == nil {
+		services = []models.Service{}
+	}
+	respondPage(c, services, meta, services)
 }
 
-func createService(context *gin.Context) {
+func (h *Handlers) createService(context *gin.Context) {
 	err := context.Request.ParseMultipartForm(10 << 20) // 10 MB max memory
 	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid multipart form"})
+		context.Error(models.Invalid("invalid_body", "request body is not a valid multipart form").Wrap(err))
 		return
 	}
 
-	name := context.PostForm("name")
-	description := context.PostForm("description")
-	currency := context.PostForm("currency")
-	priceStr := context.PostForm("price")
-	durationStr := context.PostForm("duration")
-	price, _ := strconv.ParseInt(priceStr, 10, 64)
-	duration, _ := strconv.ParseInt(durationStr, 10, 64)
+	duration, err := strconv.ParseInt(context.PostForm("duration"), 10, 64)
+	if err != nil {
+		context.Error(&models.ValidationError{Field: "duration", Message: "must be a whole number of minutes"})
+		return
+	}
 
 	userId := context.GetInt64("userId")
 
+	now := time.Now().UTC()
+	service := &models.Service{
+		Name:        context.PostForm("name"),
+		Description: context.PostForm("description"),
+		Price:       models.Decimal(strings.TrimSpace(context.PostForm("price"))),
+		Currency:    context.PostForm("currency"),
+		Duration:    duration,
+		Timestamp:   &now,
+		UserID:      userId,
+	}
+
+	// Validate everything before uploading any media
+	if err := service.Validate(); err != nil {
+		context.Error(err)
+		return
+	}
+
+	// Variants and add-ons may be sent as JSON arrays in the "variants"/"addOns" form fields
+	var variants, addOns []models.ServiceOption
+	if raw := context.PostForm("variants"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &variants); err != nil {
+			context.Error(&models.ValidationError{Field: "variants", Message: "must be a JSON array of options"})
+			return
+		}
+	}
+	if raw := context.PostForm("addOns"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &addOns); err != nil {
+			context.Error(&models.ValidationError{Field: "addOns", Message: "must be a JSON array of options"})
+			return
+		}
+	}
+	for i := range variants {
+		if err := variants[i].Validate(models.OptionVariant, service.Currency); err != nil {
+			context.Error(optionFieldError(err, "variants", i))
+			return
+		}
+	}
+	for i := range addOns {
+		if err := addOns[i].Validate(models.OptionAddOn, service.Currency); err != nil {
+			context.Error(optionFieldError(err, "addOns", i))
+			return
+		}
+	}
+
 	form, _ := context.MultipartForm()
 	files := form.File["media"]
 
 	var mediaItems []models.MediaItem
 	for _, fileHeader := range files {
-		item, err := cloud.HandleFile(fileHeader)
+		item, err := cloud.HandleFile(context.Request.Context(), fileHeader)
 		if err != nil {
-			context.JSON(http.StatusInternalServerError, gin.H{"error": "Upload failed: " + err.Error()})
+			discardMedia(context, mediaItems)
+			context.Error(uploadError(err))
 			return
 		}
 		mediaItems = append(mediaItems, item)
 	}
+	service.Media = mediaItems
 
-	now := time.Now().UTC()
-	service := &models.Service{
-		Name:        name,
-		Description: description,
-		Price:       price,
-		Currency:    currency,
-		Duration:    duration,
-		Timestamp:   &now,
-		UserID:      userId,
-		Media:       mediaItems,
-	}
-
-	service, err = service.CreateService()
+	// The service and its options are created together, and the media
+	// uploaded for it removed again if that fails
+	err = h.repos.InTx(context.Request.Context(), func(tx models.Repositories) error {
+		if err := tx.Services.Create(context.Request.Context(), service); err != nil {
+			return err
+		}
+		service.Variants = []models.ServiceOption{}
+		service.AddOns = []models.ServiceOption{}
+		for i := range variants {
+			variants[i].ServiceID = service.ID
+			variants[i].Position = i
+			if err := tx.Services.CreateOption(context.Request.Context(), models.OptionVariant, &variants[i], userId); err != nil {
+				return err
+			}
+			service.Variants = append(service.Variants, variants[i])
+		}
+		for i := range addOns {
+			addOns[i].ServiceID = service.ID
+			addOns[i].Position = i
+			if err := tx.Services.CreateOption(context.Request.Context(), models.OptionAddOn, &addOns[i], userId); err != nil {
+				return err
+			}
+			service.AddOns = append(service.AddOns, addOns[i])
+		}
+		return nil
+	})
 	if err != nil {
-		log.Printf("CreateService error - Failed to create service: %v", err)
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Server error: " + err.Error()})
+		discardMedia(context, mediaItems)
+		context.Error(err)
 		return
 	}
 
-	context.JSON(http.StatusCreated, gin.H{"message": service})
+	respond(context, http.StatusCreated, service, gin.H{"message": service})
 }
 
-func editService(context *gin.Context) {
-	id, err := strconv.ParseInt(context.Param("id"), 10, 64)
-	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Could not parse id: " + err.Error()})
+// discardMedia removes media uploaded for a service that was not saved
+func discardMedia(c *gin.Context, items []models.MediaItem) {
+	for _, item := range items {
+		if err := cloud.DeleteMedia(c.Request.Context(), item); err != nil {
+			logging.FromContext(c.Request.Context()).WithError(err).WithField("publicId", item.PublicID).Warn("failed to delete media of unsaved service")
+		}
+	}
+}
+
+func (h *Handlers) editService(context *gin.Context) {
+	id, ok := paramID(context, "id")
+	if !ok {
 		return
 	}
 
 	userId := context.GetInt64("userId")
-	service, err := models.GetServiceById(id, userId)
+	service, err := h.repos.Services.GetByID(context.Request.Context(), id, userId)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch service by id: " + err.Error()})
+		context.Error(err)
 		return
 	}
 
 	if userId != service.UserID {
-		context.JSON(http.StatusUnauthorized, gin.H{"message": "Could not authorize user"})
+		context.Error(errNotOwner)
 		return
 	}
 
 	var updatedService models.Service
-	err = context.ShouldBindJSON(&updatedService)
-	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "can't parse the request: " + err.Error()})
+	if !bindJSON(context, &updatedService) {
 		return
 	}
 
 	updatedService.ID = id
 	updatedService.UserID = userId
 	updatedService.Media = service.Media
-	err = updatedService.UpdateService()
+	updatedService.Variants = service.Variants
+	updatedService.AddOns = service.AddOns
+	err = h.repos.Services.Update(context.Request.Context(), &updatedService)
 	if err != nil {
-		fmt.Println(err.Error())
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Could not update event by id: " + err.Error()})
+		context.Error(err)
 		return
 	}
 
-	context.JSON(http.StatusOK, gin.H{"message": "Success!", "service": updatedService})
+	respond(context, http.StatusOK, updatedService, gin.H{"message": "Success!", "service": updatedService})
 }
 
-func deleteServiceMedia(c *gin.Context) {
-	serviceID, err := strconv.ParseInt(c.Param("id"), 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid service ID: " + err.Error()})
+func (h *Handlers) deleteServiceMedia(c *gin.Context) {
+	serviceID, ok := paramID(c, "id")
+	if !ok {
 		return
 	}
 
 	publicID := c.Param("mediaId")
 	if publicID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Missing media id"})
+		c.Error(&models.ValidationError{Field: "mediaId", Message: "is required"})
 		return
 	}
 
 	userID := c.GetInt64("userId")
 
-	service, err := models.GetServiceById(serviceID, userID)
+	service, err := h.repos.Services.GetByID(c.Request.Context(), serviceID, userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"message": "Service not found"})
+		c.Error(err)
 		return
 	}
 
 	if service.UserID != userID {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "You are not allowed to modify this service"})
+		c.Error(errNotOwner)
 		return
 	}
 
-	cloud.DeleteMedia(c, publicID)
+	// The stored item says whether it's a photo or a clip, which decides
+	// what there is to delete
+	i := slices.IndexFunc(service.Media, func(m models.MediaItem) bool { return m.PublicID == publicID })
+	if i < 0 {
+		c.Error(errMediaNotFound)
+		return
+	}
 
-	updatedMedia := []models.MediaItem{}
-	for _, mediaItem := range service.Media {
-		if mediaItem.PublicID != publicID {
-			updatedMedia = append(updatedMedia, mediaItem)
-		}
+	if err := cloud.DeleteMedia(c.Request.Context(), service.Media[i]); err != nil {
+		c.Error(models.Unavailable("media_delete_failed", "the media could not be deleted").Wrap(err))
+		return
 	}
-	service.Media = updatedMedia
 
-	_, err = service.SaveMedia()
+	service.Media = slices.Delete(service.Media, i, i+1)
+
+	err = h.repos.Services.SaveMedia(c.Request.Context(), service)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to update service media: " + err.Error()})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Media deleted successfully"})
+	respond(c, http.StatusOK, service, gin.H{"message": "Media deleted successfully"})
+
+}
 
+// uploadError reports a refused file as it is, and anything else as a
+// failed upload
+func uploadError(err error) error {
+	var fieldErr *models.ValidationError
+	if errors.As(err, &fieldErr) {
+		return fieldErr
+	}
+	return errUploadFailed.Wrap(err)
 }
 
 type UpdateServiceMedia struct {
 	Media []models.MediaItem `json:"media"`
 }
 
-func addServiceMedia(c *gin.Context) {
-	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+func (h *Handlers) addServiceMedia(c *gin.Context) {
+	id, ok := paramID(c, "id")
 	userID := c.GetInt64("userId")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid service ID: " + err.Error()})
+	if !ok {
 		return
 	}
 
-	service, err := models.GetServiceById(id, userID)
+	service, err := h.repos.Services.GetByID(c.Request.Context(), id, userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"message": "Service not found " + err.Error()})
+		c.Error(err)
 		return
 	}
 
 	if service.UserID != userID {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "You are not allowed to modify this service"})
+		c.Error(errNotOwner)
 		return
 	}
 
@@ -205,9 +301,9 @@ func addServiceMedia(c *gin.Context) {
 
 	var mediaItems []models.MediaItem
 	for _, fileHeader := range files {
-		item, err := cloud.HandleFile(fileHeader)
+		item, err := cloud.HandleFile(c.Request.Context(), fileHeader)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Upload failed: " + err.Error()})
+			c.Error(uploadError(err))
 			return
 		}
 		mediaItems = append(mediaItems, item)
@@ -215,81 +311,92 @@ func addServiceMedia(c *gin.Context) {
 
 	service.Media = append(service.Media, mediaItems...)
 
-	service, err = service.SaveMedia()
+	err = h.repos.Services.SaveMedia(c.Request.Context(), service)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to update service media: " + err.Error()})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Media added successfully", "service": service})
+	respond(c, http.StatusOK, service, gin.H{"message": "Media added successfully", "service": service})
 }
 
-func updateMediaOrder(c *gin.Context) {
-	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+func (h *Handlers) updateMediaOrder(c *gin.Context) {
+	id, ok := paramID(c, "id")
 	userID := c.GetInt64("userId")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid service ID: " + err.Error()})
+	if !ok {
 		return
 	}
 
-	service, err := models.GetServiceById(id, userID)
+	service, err := h.repos.Services.GetByID(c.Request.Context(), id, userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"message": "Service not found " + err.Error()})
+		c.Error(err)
 		return
 	}
 
 	if service.UserID != userID {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "You are not allowed to modify this service"})
+		c.Error(errNotOwner)
 		return
 	}
 
 	var updatedMedia UpdateServiceMedia
-	err = c.BindJSON(&updatedMedia)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request body: " + err.Error()})
+	if !bindJSON(c, &updatedMedia) {
 		return
 	}
 
 	service.Media = updatedMedia.Media
-	service, err = service.SaveMedia()
+	err = h.repos.Services.SaveMedia(c.Request.Context(), service)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to update service media: " + err.Error()})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Media added successfully", "service": service})
+	respond(c, http.StatusOK, service, gin.H{"message": "Media added successfully", "service": service})
 }
 
-func deleteService(c *gin.Context) {
-	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid service ID: " + err.Error()})
+func (h *Handlers) deleteService(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
 		return
 	}
 
 	userID := c.GetInt64("userId")
 
-	service, err := models.GetServiceById(id, userID)
+	service, err := h.repos.Services.GetByID(c.Request.Context(), id, userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"message": "Service not found: " + err.Error()})
+		c.Error(err)
 		return
 	}
 
 	if service.UserID != userID {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "You are not authorized to delete this service"})
+		c.Error(errNotOwner)
 		return
 	}
 
-	// Delete all media from Cloudinary before deleting the service
+	// Delete all media from storage before deleting the service
 	for _, mediaItem := range service.Media {
-		cloud.DeleteMedia(c, mediaItem.PublicID)
+		if err := cloud.DeleteMedia(c.Request.Context(), mediaItem); err != nil {
+			logging.FromContext(c.Request.Context()).WithError(err).WithFields(logrus.Fields{
+				"publicId":  mediaItem.PublicID,
+				"serviceId": service.ID,
+			}).Warn("failed to delete service media")
+		}
 	}
 
-	err = service.DeleteService()
+	err = h.repos.Services.Delete(c.Request.Context(), service.ID, service.UserID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to delete service: " + err.Error()})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Service deleted successfully"})
+	respond(c, http.StatusOK, nil, gin.H{"message": "Service deleted successfully"})
+}
+
+// optionFieldError points a variant or add-on validation error at its
+// position in the submitted list
+func optionFieldError(err error, list string, i int) error {
+	var fieldErr *models.ValidationError
+	if !errors.As(err, &fieldErr) {
+		return err
+	}
+	return &models.ValidationError{Field: fmt.Sprintf("%s[%d].%s", list, i, fieldErr.Field), Message: fieldErr.Message}
 }
@@ -1,99 +1,77 @@
 package routes
 
 import (
-	"log"
 	"net/http"
-	"strings"
 
+	"example.com/logging"
 	"example.com/models"
 	"example.com/utils"
 	"github.com/gin-gonic/gin"
 )
 
-func getAlias(c *gin.Context) {
+func (h *Handlers) getAlias(c *gin.Context) {
 	userID := c.GetInt64("userId")
 
-	alias, err := models.GetAlias(userID)
+	alias, err := h.repos.Users.GetAlias(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "failed to get alias: " + err.Error()})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"alias": alias})
+	respond(c, http.StatusOK, gin.H{"alias": alias}, gin.H{"alias": alias})
 }
 
-func updateAlias(c *gin.Context) {
+func (h *Handlers) updateAlias(c *gin.Context) {
 	userID := c.GetInt64("userId")
 
 	var body struct {
 		Alias string `json:"alias" binding:"required"`
 	}
-	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid request body: " + err.Error()})
+	if !bindJSON(c, &body) {
 		return
 	}
 
-	err := models.UpdateAlias(userID, body.Alias)
+	err := h.repos.Users.UpdateAlias(c.Request.Context(), userID, body.Alias)
 	if err != nil {
-		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "unique constraint") {
-			c.JSON(http.StatusConflict, gin.H{"message": "alias already taken"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "failed to update alias: " + err.Error()})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "alias updated", "alias": body.Alias})
+	respond(c, http.StatusOK, gin.H{"alias": body.Alias}, gin.H{"message": "alias updated", "alias": body.Alias})
 }
 
-func signup(context *gin.Context) {
+func (h *Handlers) signup(context *gin.Context) {
 	var user models.User
-	err := context.ShouldBindJSON(&user)
-
-	if err != nil {
-		log.Printf("Signup error - Failed to parse request: %v", err)
-		context.JSON(http.StatusBadRequest, gin.H{"message": "can't parse the request: " + err.Error()})
+	if !bindJSON(context, &user) {
 		return
 	}
 
-	err = user.Save()
+	err := h.repos.Users.Create(context.Request.Context(), &user)
 	if err != nil {
-		log.Printf("Signup error - Failed to save user: %v", err)
-		// Check if it's a duplicate email error
-		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
-			context.JSON(http.StatusConflict, gin.H{"message": "Email already exists"})
-			return
-		}
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Server error: " + err.Error()})
+		context.Error(err)
 		return
 	}
 
-	log.Printf("User created successfully: %s", user.Email)
-	context.JSON(http.StatusOK, gin.H{"message": "User created"})
+	logging.FromContext(context.Request.Context()).WithField("userId", user.ID).Info("user signed up")
+	respond(context, http.StatusOK, nil, gin.H{"message": "User created"})
 }
 
-func login(context *gin.Context) {
+func (h *Handlers) login(context *gin.Context) {
 	var user models.User
-	err := context.ShouldBindJSON(&user)
-
-	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "can't parse the request: " + err.Error()})
+	if !bindJSON(context, &user) {
 		return
 	}
 
-	err = user.ValidateCredentials()
+	err := h.repos.Users.ValidateCredentials(context.Request.Context(), &user)
 
 	if err != nil {
-		context.JSON(http.StatusUnauthorized, gin.H{
-			"message":    "Could not authorize user: invalid login and/or password",
-			"error_type": "invalidLogin",
-		})
+		context.Error(err)
 		return
 	}
 
 	token, refreshToken, err := utils.GenerateTokens(user.Email, user.ID)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Could not authenticate the user: " + err.Error()})
+		context.Error(err)
 		return
 	}
 
@@ -108,7 +86,7 @@ func login(context *gin.Context) {
 	// })
 
 	context.SetCookie("refresh_token", refreshToken, int(utils.REFRESH_TOKEN_LIFETIME), "/", "localhost", false, true)
-	context.JSON(http.StatusOK, gin.H{
+	respond(context, http.StatusOK, tokenPair{AccessToken: token, RefreshToken: refreshToken}, gin.H{
 		"message":              "Auth success",
 		"token":                token,
 		"refresh_token":        refreshToken,
@@ -120,26 +98,25 @@ func refresh(context *gin.Context) {
 	var body struct {
 		RefreshToken string `json:"refreshToken"`
 	}
-	if err := context.BindJSON(&body); err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request body"})
+	if !bindJSON(context, &body) {
 		return
 	}
 	refreshToken := body.RefreshToken
 
 	userId, email, err := utils.VerifyToken(refreshToken)
 	if err != nil {
-		context.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid refresh token"})
+		context.Error(models.Unauthorized("invalid_refresh_token", "refresh token is invalid or expired"))
 		return
 	}
 
 	accessToken, refreshToken, err := utils.GenerateTokens(email, userId)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Token generation error"})
+		context.Error(err)
 		return
 	}
 
 	context.SetCookie("refresh_token", refreshToken, int(utils.REFRESH_TOKEN_LIFETIME), "/", "localhost", false, true)
-	context.JSON(http.StatusOK, gin.H{
+	respond(context, http.StatusOK, tokenPair{AccessToken: accessToken, RefreshToken: refreshToken}, gin.H{
 		"accessToken": accessToken,
 	})
 }
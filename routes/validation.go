@@ -0,0 +1,102 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/models"
+	"example.com/pagination"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// Report binding errors by their JSON field names
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+var errInvalidBody = models.Invalid("invalid_body", "request body is not valid JSON")
+
+// bindJSON binds the request body, recording per-field errors when it is
+// malformed or misses required fields
+func bindJSON(c *gin.Context, obj any) bool {
+	err := c.ShouldBindJSON(obj)
+	if err == nil {
+		return true
+	}
+
+	var fieldErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &fieldErrs):
+		var errs models.ValidationErrors
+		for _, fe := range fieldErrs {
+			if fe.Tag() == "required" {
+				errs.Add(fe.Field(), "is required")
+			} else {
+				errs.Add(fe.Field(), "is invalid")
+			}
+		}
+		c.Error(errs)
+	case errors.As(err, &typeErr):
+		c.Error(&models.ValidationError{Field: typeErr.Field, Message: "must be a " + typeErr.Type.String()})
+	default:
+		c.Error(errInvalidBody.Wrap(err))
+	}
+	return false
+}
+
+// paramID parses a numeric path parameter, recording a validation error when
+// it is malformed
+func paramID(c *gin.Context, name string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil {
+		c.Error(&models.ValidationError{Field: name, Message: "must be a numeric id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// paramDate parses a "YYYY-MM-DD" path parameter, recording a validation
+// error when it is malformed
+func paramDate(c *gin.Context, name string) (time.Time, bool) {
+	date, err := models.ParseDate(c.Param(name))
+	if err != nil {
+		c.Error(&models.ValidationError{Field: name, Message: err.Error()})
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// pageRequest parses the limit, sort and cursor query parameters of a list
+// endpoint, recording a validation error when they are malformed
+func pageRequest(c *gin.Context, ks pagination.Keyset) (pagination.Request, bool) {
+	page, err := ks.Parse(c.Query("limit"), c.Query("sort"), c.Query("cursor"))
+	if err != nil {
+		var fieldErr *pagination.FieldError
+		if errors.As(err, &fieldErr) {
+			err = &models.ValidationError{Field: fieldErr.Field, Message: fieldErr.Message}
+		}
+		c.Error(err)
+		return pagination.Request{}, false
+	}
+	// The legacy routes listed everything before /api/v1 was paginated, and
+	// keep doing so until their sunset unless a client asks for a page size
+	if v, _ := c.Get(apiVersionKey); v != apiV1 && c.Query("limit") == "" {
+		page = page.Unlimited()
+	}
+	return page, true
+}
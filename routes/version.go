@@ -0,0 +1,93 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/models"
+	"example.com/pagination"
+	"github.com/gin-gonic/gin"
+)
+
+type apiVersion int
+
+const (
+	// apiLegacy is the unversioned /api, kept until legacySunset
+	apiLegacy apiVersion = iota
+	apiV1
+)
+
+const apiVersionKey = "apiVersion"
+
+var (
+	legacyDeprecatedAt = time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	legacySunset       = time.Date(2027, 4, 30, 0, 0, 0, 0, time.UTC)
+)
+
+// withAPIVersion tags requests with the version of the group serving them
+func withAPIVersion(v apiVersion) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(apiVersionKey, v)
+		c.Next()
+	}
+}
+
+// deprecatedAPI announces the removal of the unversioned routes
+// (RFC 9745 Deprecation, RFC 8594 Sunset) and points at their successor
+func deprecatedAPI(c *gin.Context) {
+	c.Header("Deprecation", fmt.Sprintf("@%d", legacyDeprecatedAt.Unix()))
+	c.Header("Sunset", legacySunset.Format(http.TimeFormat))
+	successor := "/api/v1" + strings.TrimPrefix(c.Request.URL.Path, "/api")
+	c.Header("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+	c.Next()
+}
+
+// respond writes a handler's result in the envelope of the API version that
+// serves the request. v1 wraps data as {"data": ...} and answers 204 when
+// there is none; the legacy routes keep the body they always returned.
+func respond(c *gin.Context, status int, data any, legacy any) {
+	if v, _ := c.Get(apiVersionKey); v != apiV1 {
+		c.JSON(status, legacy)
+		return
+	}
+	if data == nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.JSON(status, gin.H{"data": data})
+}
+
+// respondPage writes one page of a list. v1 adds the page metadata to the
+// envelope; the legacy routes report it in X-Total-Count and Link headers.
+func respondPage(c *gin.Context, data any, meta pagination.Meta, legacy any) {
+	if v, _ := c.Get(apiVersionKey); v == apiV1 {
+		c.JSON(http.StatusOK, gin.H{"data": data, "meta": meta})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(meta.Total, 10))
+	if meta.NextCursor != "" {
+		next := *c.Request.URL
+		query := next.Query()
+		query.Set("cursor", meta.NextCursor)
+		next.RawQuery = query.Encode()
+		c.Writer.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+	}
+	c.JSON(http.StatusOK, legacy)
+}
+
+// tokenPair is the v1 body of every endpoint that signs a user in
+type tokenPair struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// bookingResult is the v1 body of endpoints that create an appointment
+type bookingResult struct {
+	Appointment *models.Appointment `json:"appointment"`
+	// Payment is the deposit checkout, present while payment is pending
+	Payment *models.Payment `json:"payment,omitempty"`
+}
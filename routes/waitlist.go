@@ -0,0 +1,142 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"example.com/logging"
+	"example.com/models"
+	"example.com/notify"
+	"github.com/gin-gonic/gin"
+)
+
+// offers tracks the waitlist runs started by offerFreedSlots
+var offers sync.WaitGroup
+
+// offerFreedSlots notifies waitlisted clients about availability that just
+// opened up, without making the request wait for it. The sweeper in main
+// picks up anything missed here.
+func (h *Handlers) offerFreedSlots(c *gin.Context) {
+	// Keep the request's log fields and trace, but not its cancellation
+	ctx := context.WithoutCancel(c.Request.Context())
+	offers.Add(1)
+	go func() {
+		defer offers.Done()
+		if _, err := notify.ProcessWaitlist(ctx, h.repos.Waitlist); err != nil {
+			logging.FromContext(ctx).WithError(err).Error("failed to process waitlist")
+		}
+	}()
+}
+
+// WaitForOffers blocks until waitlist runs started by requests have
+// finished, so shutdown can close the database after them
+func WaitForOffers() {
+	offers.Wait()
+}
+
+func (h *Handlers) joinWaitlist(c *gin.Context) {
+	user, err := h.repos.Users.GetByAlias(c.Request.Context(), c.Param("alias"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var entry models.WaitlistEntry
+	if !bindJSON(c, &entry) {
+		return
+	}
+	entry.UserID = user.ID
+
+	err = h.repos.Waitlist.Create(c.Request.Context(), &entry)
+	if err != nil {
+		if errors.Is(err, models.ErrServiceNotFound) || errors.Is(err, models.ErrOptionNotFound) {
+			c.Error(models.Invalid("invalid_selection", "service or option not found for this user"))
+			return
+		}
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusCreated, entry, gin.H{"message": "joined waitlist", "entry": entry})
+}
+
+func (h *Handlers) leaveWaitlist(c *gin.Context) {
+	user, err := h.repos.Users.GetByAlias(c.Request.Context(), c.Param("alias"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	err = h.repos.Waitlist.Leave(c.Request.Context(), c.Param("id"), user.ID, c.Query("token"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, nil, gin.H{"message": "left waitlist"})
+}
+
+// claimWaitlistOffer books the offered slot for the client. The slot is only
+// offered to them, but stays open to regular bookings until claimed, so it
+// may be taken by then.
+func (h *Handlers) claimWaitlistOffer(c *gin.Context) {
+	alias := c.Param("alias")
+	user, err := h.repos.Users.GetByAlias(c.Request.Context(), alias)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var body struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	entry, err := h.repos.Waitlist.GetOffer(c.Request.Context(), c.Param("id"), user.ID, body.Token)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	appt := models.Appointment{
+		ServiceID: entry.ServiceID,
+		VariantID: entry.VariantID,
+		AddOnIDs:  entry.AddOnIDs,
+		Date:      entry.Offer.Date,
+		StartTime: entry.Offer.StartTime,
+		FirstName: entry.FirstName,
+		LastName:  entry.LastName,
+		Email:     entry.Email,
+		Phone:     entry.Phone,
+	}
+	// The entry is closed with the booking, so an offer that lapsed in
+	// between can't be booked as well as passed on
+	payment, ok := h.bookAppointment(c, alias, user.ID, &appt, func(tx models.Repositories) error {
+		return tx.Waitlist.MarkBooked(c.Request.Context(), entry.ID, body.Token, appt.ID)
+	})
+	if !ok {
+		return
+	}
+
+	respond(c, http.StatusCreated, bookingResult{Appointment: &appt, Payment: payment}, gin.H{
+		"message":     "slot claimed",
+		"appointment": appt,
+		"payment":     payment,
+	})
+}
+
+func (h *Handlers) getWaitlist(c *gin.Context) {
+	entries, err := h.repos.Waitlist.List(c.Request.Context(), c.GetInt64("userId"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if entries == nil {
+		entries = []models.WaitlistEntry{}
+	}
+	respond(c, http.StatusOK, entries, gin.H{"entries": entries})
+}
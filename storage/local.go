@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Local keeps media in a directory on disk, for development without a
+// network. The server serves the directory at the URL it was given.
+type Local struct {
+	dir     string
+	baseURL string
+}
+
+func NewLocal(dir, baseURL string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("local storage init failed: %w", err)
+	}
+	return &Local{dir: dir, baseURL: baseURL}, nil
+}
+
+func (s *Local) Name() string { return "local" }
+
+// Dir is the directory files are kept in
+func (s *Local) Dir() string { return s.dir }
+
+// Put writes r to a temporary file first, so a failed upload never leaves a
+// partial file under key
+func (s *Local) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) (Object, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return Object{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return Object{}, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return Object{}, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return Object{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return Object{}, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return Object{}, err
+	}
+	return Object{Key: key, URL: s.URL(key), ContentType: opts.ContentType}, nil
+}
+
+func (s *Local) Delete(ctx context.Context, key string, opts DeleteOptions) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *Local) URL(key string) string {
+	return s.baseURL + "/" + escapeKey(key)
+}
+
+// path maps key into the directory, refusing keys that would escape it
+func (s *Local) path(key string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
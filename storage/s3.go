@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"example.com/config"
+	"example.com/tracing"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3 keeps media in a bucket of an S3-compatible object store, such as AWS
+// S3, Cloudflare R2 or MinIO. The bucket must allow public reads of its
+// objects, or be fronted by S3_PUBLIC_URL.
+type S3 struct {
+	client    *minio.Client
+	bucket    string
+	publicURL string
+}
+
+func NewS3(cfg config.S3Config) (*S3, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+	secure := endpoint.Scheme == "https"
+	transport, err := minio.DefaultTransport(secure)
+	if err != nil {
+		return nil, fmt.Errorf("s3 init failed: %w", err)
+	}
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:     credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		Secure:    secure,
+		Region:    cfg.Region,
+		Transport: tracing.NewTransport(transport),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3 init failed: %w", err)
+	}
+	return &S3{client: client, bucket: cfg.Bucket, publicURL: cfg.PublicURL}, nil
+}
+
+func (s *S3) Name() string { return "s3" }
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) (Object, error) {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, opts.Size, minio.PutObjectOptions{
+		ContentType: opts.ContentType,
+	})
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{Key: key, URL: s.URL(key), ContentType: opts.ContentType}, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string, opts DeleteOptions) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3) URL(key string) string {
+	return s.publicURL + "/" + escapeKey(key)
+}
+
+// escapeKey escapes each segment of a key, keeping its slashes
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,68 @@
+// Package storage keeps uploaded media. Storage is implemented by Cloudinary,
+// any S3-compatible object store and the local filesystem; Init picks one
+// from the configuration.
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"example.com/config"
+)
+
+// Storage keeps objects under keys chosen by the caller
+type Storage interface {
+	Name() string
+	// Put stores r under key, replacing any object already there
+	Put(ctx context.Context, key string, r io.Reader, opts PutOptions) (Object, error)
+	// Delete removes the object stored under key. Deleting a missing object
+	// is not an error.
+	Delete(ctx context.Context, key string, opts DeleteOptions) error
+	// URL is where clients fetch the object stored under key
+	URL(key string) string
+}
+
+type PutOptions struct {
+	ContentType string
+	// Size is the length of the content in bytes, or -1 when unknown
+	Size int64
+}
+
+type DeleteOptions struct {
+	// ContentType is the type the object was stored with, or empty when it
+	// isn't known; such objects are taken to be images
+	ContentType string
+}
+
+// Object is a stored object
+type Object struct {
+	Key         string
+	URL         string
+	ContentType string
+}
+
+// Default is the configured storage, set by Init
+var Default Storage
+
+func Init(cfg config.StorageConfig) error {
+	s, err := New(cfg)
+	if err != nil {
+		return err
+	}
+	Default = s
+	return nil
+}
+
+func New(cfg config.StorageConfig) (Storage, error) {
+	switch cfg.Driver {
+	case "cloudinary":
+		return NewCloudinary(cfg.Cloudinary)
+	case "s3":
+		return NewS3(cfg.S3)
+	case "local":
+		return NewLocal(cfg.Local.Dir, cfg.Local.URL)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+}
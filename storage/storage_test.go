@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"example.com/config"
+)
+
+func TestLocal(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewLocal(dir, "http://localhost:8080/media")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := s.Put(context.Background(), "photo 1", strings.NewReader("jpeg"), PutOptions{ContentType: "image/jpeg", Size: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.URL != "http://localhost:8080/media/photo%201" {
+		t.Errorf("URL = %q", obj.URL)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "photo 1")); string(b) != "jpeg" {
+		t.Errorf("stored %q, want jpeg", b)
+	}
+
+	if err := s.Delete(context.Background(), "photo 1", DeleteOptions{ContentType: "image/jpeg"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(context.Background(), "photo 1", DeleteOptions{ContentType: "image/jpeg"}); err != nil {
+		t.Errorf("deleting a missing file = %v, want nil", err)
+	}
+	if _, err := s.Put(context.Background(), "../escape", strings.NewReader("x"), PutOptions{Size: 1}); err == nil {
+		t.Error("Put outside the directory succeeded")
+	}
+}
+
+// fakeS3 is an S3-compatible stand-in holding objects in memory. It serves
+// the path-style PUT and DELETE object calls the driver makes.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]string
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+		http.Error(w, "unsigned request", http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			body = decodeChunked(body)
+		}
+		f.objects[r.URL.Path] = string(body)
+		f.types[r.URL.Path] = r.Header.Get("Content-Type")
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unsupported", http.StatusNotImplemented)
+	}
+}
+
+// decodeChunked strips the "<size>;chunk-signature=<sig>" framing of
+// aws-chunked bodies, which clients send over plain HTTP
+func decodeChunked(body []byte) []byte {
+	var out []byte
+	for len(body) > 0 {
+		header, rest, _ := bytes.Cut(body, []byte("\r\n"))
+		size, _ := strconv.ParseInt(string(bytes.SplitN(header, []byte(";"), 2)[0]), 16, 64)
+		if size == 0 || int64(len(rest)) < size {
+			break
+		}
+		out = append(out, rest[:size]...)
+		body = bytes.TrimPrefix(rest[size:], []byte("\r\n"))
+	}
+	return out
+}
+
+func TestS3(t *testing.T) {
+	fake := &fakeS3{objects: map[string]string{}, types: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s, err := New(config.StorageConfig{Driver: "s3", S3: config.S3Config{
+		Endpoint:        server.URL,
+		Region:          "us-east-1",
+		Bucket:          "media",
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		PublicURL:       "https://cdn.example.com",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := s.Put(context.Background(), "abc", strings.NewReader("jpeg"), PutOptions{ContentType: "image/jpeg", Size: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.URL != "https://cdn.example.com/abc" {
+		t.Errorf("URL = %q", obj.URL)
+	}
+	if fake.objects["/media/abc"] != "jpeg" || fake.types["/media/abc"] != "image/jpeg" {
+		t.Errorf("stored %v %v", fake.objects, fake.types)
+	}
+
+	if err := s.Delete(context.Background(), "abc", DeleteOptions{ContentType: "image/jpeg"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.objects) != 0 {
+		t.Errorf("objects after delete = %v", fake.objects)
+	}
+}
@@ -0,0 +1,105 @@
+// Package tracing sets up OpenTelemetry tracing: the tracer provider and its
+// exporter, an HTTP client whose requests become client spans, and a logrus
+// hook stamping log lines with the trace they were written in.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"example.com/config"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer creates the spans the server starts by hand, around work that isn't
+// an HTTP request or an SQL query
+var Tracer = otel.Tracer("example.com")
+
+// HTTPClient sends outbound requests as client spans, propagating the trace
+// to services that support it
+var HTTPClient = &http.Client{
+	Transport: NewTransport(http.DefaultTransport),
+	Timeout:   15 * time.Second,
+}
+
+// NewTransport wraps base so each request it sends is traced
+func NewTransport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base)
+}
+
+// Init installs the global tracer provider described by cfg and returns a
+// function flushing and stopping it. Tracing stays disabled (a no-op) when
+// no exporter is configured.
+func Init(ctx context.Context, cfg config.TracingConfig) (func(context.Context) error, error) {
+	if cfg.Exporter == "" || cfg.Exporter == "none" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var opts []otlptracehttp.Option
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := NewProvider(exporter, cfg.ServiceName, cfg.SampleRatio)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// NewProvider returns a provider batching spans to exporter and sets the
+// W3C trace context propagator. Tests pass an in-memory exporter.
+func NewProvider(exporter sdktrace.SpanExporter, serviceName string, sampleRatio float64) *sdktrace.TracerProvider {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+}
+
+// untraced are the probe and scrape endpoints, polled too often to be worth
+// a span each
+var untraced = map[string]bool{"/health": true, "/ready": true, "/metrics": true}
+
+// Middleware starts a server span for each request, continuing the caller's
+// trace when the request carries one
+func Middleware(serviceName string) gin.HandlerFunc {
+	return otelgin.Middleware(serviceName, otelgin.WithFilter(func(r *http.Request) bool {
+		return !untraced[r.URL.Path]
+	}))
+}
+
+// LogHook adds the trace and span IDs of an entry's context to the entry, so
+// log lines written with WithContext can be found from a trace
+type LogHook struct{}
+
+func (LogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (LogHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	span := trace.SpanContextFromContext(entry.Context)
+	if !span.IsValid() {
+		return nil
+	}
+	entry.Data["traceId"] = span.TraceID().String()
+	entry.Data["spanId"] = span.SpanID().String()
+	return nil
+}
@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRequestTraceCoversOutboundCallsAndLogs(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := NewProvider(exporter, "booking-test", 1)
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("traceparent") == "" {
+			t.Error("outbound request carries no traceparent header")
+		}
+	}))
+	defer upstream.Close()
+
+	var logs bytes.Buffer
+	logger := logrus.New()
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.SetOutput(&logs)
+	logger.AddHook(LogHook{})
+
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	server.Use(Middleware("booking-test"))
+	server.GET("/events/:id", func(c *gin.Context) {
+		req, _ := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, upstream.URL, nil)
+		resp, err := HTTPClient.Do(req)
+		if err != nil {
+			t.Errorf("outbound request: %v", err)
+		} else {
+			resp.Body.Close()
+		}
+		logger.WithContext(c.Request.Context()).Info("handled")
+		c.Status(http.StatusOK)
+	})
+	server.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/events/1", nil))
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	provider.ForceFlush(context.Background())
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want the server span and the client span", len(spans))
+	}
+	var serverSpan, clientSpan trace.SpanContext
+	for _, s := range spans {
+		switch s.SpanKind {
+		case trace.SpanKindServer:
+			serverSpan = s.SpanContext
+			if s.Name != "GET /events/:id" {
+				t.Errorf("server span name = %q", s.Name)
+			}
+		case trace.SpanKindClient:
+			clientSpan = s.SpanContext
+		}
+	}
+	if !serverSpan.IsValid() || clientSpan.TraceID() != serverSpan.TraceID() {
+		t.Errorf("client span %v isn't in the server span's trace %v", clientSpan, serverSpan)
+	}
+
+	var entry map[string]string
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("decode log %q: %v", logs.String(), err)
+	}
+	if entry["traceId"] != serverSpan.TraceID().String() {
+		t.Errorf("log traceId = %q, want %s", entry["traceId"], serverSpan.TraceID())
+	}
+}
@@ -7,10 +7,17 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-const secretKey = "dummy_key"
+// secretKey signs and verifies tokens, set from the configuration by
+// SetSecretKey at startup
+var secretKey = []byte("dummy_key")
+
 const ACCESS_TOKEN_LIFETIME = time.Minute * 2
 const REFRESH_TOKEN_LIFETIME = time.Hour * 24 * 7
 
+func SetSecretKey(key string) {
+	secretKey = []byte(key)
+}
+
 func CreateJWT(email string, userId int64, ttl time.Duration) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"email":  email,
@@ -18,7 +25,7 @@ func CreateJWT(email string, userId int64, ttl time.Duration) (string, error) {
 		"exp":    time.Now().Add(ttl).Unix(),
 	})
 
-	return token.SignedString([]byte(secretKey))
+	return token.SignedString(secretKey)
 }
 
 func GenerateTokens(email string, userId int64) (accessToken string, refreshToken string, err error) {
@@ -36,7 +43,7 @@ func VerifyToken(token string) (int64, string, error) {
 		if !ok {
 			return nil, errors.New("unexpected signing method")
 		}
-		return []byte(secretKey), nil
+		return secretKey, nil
 	})
 	if err != nil {
 		return 0, "", errors.New("Could not parse the token: " + err.Error())
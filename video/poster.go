@@ -0,0 +1,66 @@
+package video
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// posterTimeout bounds how long ffmpeg may take over a frame, so a clip it
+// chokes on can't hold up the upload
+const posterTimeout = 30 * time.Second
+
+// ErrNoFFmpeg means ffmpeg isn't installed, so no poster can be made
+var ErrNoFFmpeg = errors.New("ffmpeg not found")
+
+// Poster extracts the frame shown at the given time as a PNG, using the
+// ffmpeg binary at path (looked up in PATH when it has no slash)
+func Poster(ctx context.Context, ffmpeg string, r io.Reader, at time.Duration) ([]byte, error) {
+	bin, err := exec.LookPath(ffmpeg)
+	if err != nil {
+		return nil, ErrNoFFmpeg
+	}
+
+	// ffmpeg needs to seek, as MP4 files often keep their index at the end
+	tmp, err := os.CreateTemp("", "video-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, posterTimeout)
+	defer cancel()
+
+	var out, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, bin,
+		"-hide_banner", "-loglevel", "error",
+		"-ss", strconv.FormatFloat(at.Seconds(), 'f', 3, 64),
+		// Read no more than a second past the frame
+		"-t", "1",
+		"-i", tmp.Name(),
+		"-frames:v", "1",
+		"-f", "image2pipe", "-c:v", "png", "-",
+	)
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if out.Len() == 0 {
+		return nil, errors.New("ffmpeg produced no frame")
+	}
+	return out.Bytes(), nil
+}
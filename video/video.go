@@ -0,0 +1,220 @@
+// Package video checks uploaded clips. Probe reads the container of MP4 and
+// QuickTime (MOV) files to enforce size and duration limits without decoding
+// them, and Poster extracts a still frame with ffmpeg for galleries.
+package video
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Limits bound what Probe accepts
+type Limits struct {
+	MaxBytes    int64
+	MaxDuration time.Duration
+}
+
+// Info describes a clip
+type Info struct {
+	ContentType string
+	Duration    time.Duration
+	Width       int
+	Height      int
+}
+
+// RejectedError explains why a clip was refused, in terms fit for the
+// uploader
+type RejectedError struct {
+	Reason string
+}
+
+func (e *RejectedError) Error() string { return e.Reason }
+
+func rejected(format string, args ...any) error {
+	return &RejectedError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// maxMovieBox bounds the metadata read into memory; short clips have a few
+// hundred kilobytes at most
+const maxMovieBox = 16 << 20
+
+// Detect reports the content type of a clip from its first 12 bytes: the
+// ftyp box every MP4 and MOV file starts with. ok is false for anything
+// else, including HEIC photos, which share the container.
+func Detect(head []byte) (contentType string, ok bool) {
+	if len(head) < 12 || string(head[4:8]) != "ftyp" {
+		return "", false
+	}
+	switch string(head[8:12]) {
+	case "qt  ":
+		return "video/quicktime", true
+	case "isom", "iso2", "iso4", "iso5", "iso6", "mp41", "mp42", "avc1", "M4V ", "M4VP", "dash", "MSNV":
+		return "video/mp4", true
+	}
+	return "", false
+}
+
+// Probe checks a clip of the given size against limits and returns what it
+// found. It returns a *RejectedError when the clip isn't acceptable.
+func Probe(r io.ReaderAt, size int64, limits Limits) (Info, error) {
+	if size > limits.MaxBytes {
+		return Info{}, rejected("videos must be at most %d MB", limits.MaxBytes>>20)
+	}
+	head := make([]byte, 12)
+	if _, err := r.ReadAt(head, 0); err != nil && !errors.Is(err, io.EOF) {
+		return Info{}, err
+	}
+	contentType, ok := Detect(head)
+	if !ok {
+		return Info{}, rejected("only MP4 and MOV videos can be uploaded")
+	}
+
+	moov, err := findBox(r, 0, size, "moov")
+	if err != nil {
+		return Info{}, err
+	}
+	if moov == nil {
+		return Info{}, rejected("the video could not be read")
+	}
+	info, err := parseMovie(moov)
+	if err != nil {
+		return Info{}, rejected("the video could not be read")
+	}
+	info.ContentType = contentType
+
+	if info.Duration > limits.MaxDuration {
+		return Info{}, rejected("videos must be at most %s long", limits.MaxDuration)
+	}
+	return info, nil
+}
+
+// findBox reads the body of the first box of the given type between offset
+// and end, or returns nil when there is none
+func findBox(r io.ReaderAt, offset, end int64, boxType string) ([]byte, error) {
+	header := make([]byte, 16)
+	for offset+8 <= end {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, nil
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		headerLen := int64(8)
+		switch size {
+		case 0: // extends to the end of the file
+			size = end - offset
+		case 1: // 64-bit size follows the type
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, nil
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:]))
+			headerLen = 16
+		}
+		if size < headerLen || offset+size > end {
+			return nil, nil
+		}
+
+		if string(header[4:8]) == boxType {
+			if size-headerLen > maxMovieBox {
+				return nil, rejected("the video's metadata is too large")
+			}
+			body := make([]byte, size-headerLen)
+			if _, err := r.ReadAt(body, offset+headerLen); err != nil && !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			return body, nil
+		}
+		offset += size
+	}
+	return nil, nil
+}
+
+// parseMovie reads the duration from the movie header (mvhd) and the
+// dimensions from the first visual track header (tkhd) of a moov box
+func parseMovie(moov []byte) (Info, error) {
+	var info Info
+	foundHeader := false
+	err := eachBox(moov, func(boxType string, body []byte) error {
+		switch boxType {
+		case "mvhd":
+			d, err := movieDuration(body)
+			if err != nil {
+				return err
+			}
+			info.Duration = d
+			foundHeader = true
+		case "trak":
+			if info.Width != 0 {
+				return nil
+			}
+			return eachBox(body, func(boxType string, body []byte) error {
+				if boxType == "tkhd" && len(body) >= 8 {
+					// Width and height are the last 8 bytes, as 16.16 fixed point
+					info.Width = int(binary.BigEndian.Uint32(body[len(body)-8:]) >> 16)
+					info.Height = int(binary.BigEndian.Uint32(body[len(body)-4:]) >> 16)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err == nil && !foundHeader {
+		err = errors.New("no movie header")
+	}
+	return info, err
+}
+
+func movieDuration(mvhd []byte) (time.Duration, error) {
+	if len(mvhd) < 4 {
+		return 0, errors.New("short mvhd")
+	}
+	var timescale, duration uint64
+	switch mvhd[0] {
+	case 0:
+		if len(mvhd) < 20 {
+			return 0, errors.New("short mvhd")
+		}
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[12:]))
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:]))
+	case 1:
+		if len(mvhd) < 32 {
+			return 0, errors.New("short mvhd")
+		}
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[20:]))
+		duration = binary.BigEndian.Uint64(mvhd[24:])
+	default:
+		return 0, errors.New("unknown mvhd version")
+	}
+	if timescale == 0 {
+		return 0, errors.New("zero timescale")
+	}
+	seconds := duration / timescale
+	if seconds > uint64(24*time.Hour/time.Second) {
+		return 24 * time.Hour, nil
+	}
+	return time.Duration(seconds)*time.Second + time.Duration(duration%timescale)*time.Second/time.Duration(timescale), nil
+}
+
+// eachBox calls fn with the type and body of each box in data
+func eachBox(data []byte, fn func(boxType string, body []byte) error) error {
+	for offset := int64(0); offset+8 <= int64(len(data)); {
+		size := int64(binary.BigEndian.Uint32(data[offset:]))
+		boxType := string(data[offset+4 : offset+8])
+		headerLen := int64(8)
+		if size == 1 && offset+16 <= int64(len(data)) {
+			size = int64(binary.BigEndian.Uint64(data[offset+8:]))
+			headerLen = 16
+		} else if size == 0 {
+			size = int64(len(data)) - offset
+		}
+		if size < headerLen || offset+size > int64(len(data)) {
+			return errors.New("malformed box")
+		}
+		if err := fn(boxType, data[offset+headerLen:offset+size]); err != nil {
+			return err
+		}
+		offset += size
+	}
+	return nil
+}
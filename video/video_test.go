@@ -0,0 +1,89 @@
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+var limits = Limits{MaxBytes: 50 << 20, MaxDuration: time.Minute}
+
+func box(boxType string, body ...[]byte) []byte {
+	content := bytes.Join(body, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(content)))
+	out = append(out, boxType...)
+	return append(out, content...)
+}
+
+func mvhd(timescale, duration uint32) []byte {
+	body := make([]byte, 100)
+	binary.BigEndian.PutUint32(body[12:], timescale)
+	binary.BigEndian.PutUint32(body[16:], duration)
+	return box("mvhd", body)
+}
+
+func tkhd(width, height int) []byte {
+	body := make([]byte, 84)
+	binary.BigEndian.PutUint32(body[76:], uint32(width)<<16)
+	binary.BigEndian.PutUint32(body[80:], uint32(height)<<16)
+	return box("tkhd", body)
+}
+
+// testMovie lays a clip out as cameras do, with the media data ahead of
+// the movie box and an audio track ahead of the video one
+func testMovie(brand string, duration time.Duration, width, height int) []byte {
+	return bytes.Join([][]byte{
+		box("ftyp", []byte(brand), make([]byte, 4)),
+		box("mdat", make([]byte, 4096)),
+		box("moov",
+			mvhd(600, uint32(duration*600/time.Second)),
+			box("trak", tkhd(0, 0)),
+			box("trak", tkhd(width, height)),
+		),
+	}, nil)
+}
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		brand       string
+		contentType string
+	}{
+		{"isom", "video/mp4"},
+		{"qt  ", "video/quicktime"},
+	}
+	for _, tt := range tests {
+		data := testMovie(tt.brand, 12500*time.Millisecond, 1920, 1080)
+		info, err := Probe(bytes.NewReader(data), int64(len(data)), limits)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.brand, err)
+		}
+		want := Info{ContentType: tt.contentType, Duration: 12500 * time.Millisecond, Width: 1920, Height: 1080}
+		if info != want {
+			t.Errorf("%s: Probe() = %+v, want %+v", tt.brand, info, want)
+		}
+	}
+}
+
+func TestProbeRejects(t *testing.T) {
+	clip := testMovie("mp42", 10*time.Second, 640, 360)
+	tests := []struct {
+		name   string
+		data   []byte
+		limits Limits
+	}{
+		{"HEIC photo", testMovie("heic", 0, 640, 360), limits},
+		{"not a video", []byte("RIFF....AVI LIST"), limits},
+		{"no movie box", clip[:len(clip)-200], limits},
+		{"too long", testMovie("mp42", 61*time.Second, 640, 360), limits},
+		{"too many bytes", clip, Limits{MaxBytes: 100, MaxDuration: time.Minute}},
+	}
+	for _, tt := range tests {
+		_, err := Probe(bytes.NewReader(tt.data), int64(len(tt.data)), tt.limits)
+		var rejected *RejectedError
+		if !errors.As(err, &rejected) {
+			t.Errorf("%s: Probe() = %v, want a RejectedError", tt.name, err)
+		}
+	}
+}